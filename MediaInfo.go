@@ -2,6 +2,8 @@ package main
 
 type MediaInfo struct {
 	Id               MediaId
+	ImdbId           string
+	TvdbId           string
 	Title            string
 	OriginalTitle    string
 	AlternativeTitle string
@@ -11,7 +13,10 @@ type MediaInfo struct {
 	Url              string
 	PosterUrl        string
 	BackdropUrl      string
+	LogoUrl          string
 	Genres           []string
+	// minutes, of an episode for TV shows; 0 if unknown
+	Runtime int
 }
 
 type IdType int
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/url"
@@ -33,6 +34,8 @@ type TMDbMovie struct {
 	PosterPath    string `json:"poster_path,omitempty"`
 	BackdropPath  string `json:"backdrop_path,omitempty"`
 	GenreIDs      []int  `json:"genre_ids"`
+	// minutes, in details only
+	Runtime int `json:"runtime,omitempty"`
 }
 
 type TMDbSearchResults struct {
@@ -63,6 +66,7 @@ type TMDbSeriesDetails struct {
 	OriginCountry    []string    `json:"origin_country"`
 	OriginalLanguage string      `json:"original_language"`
 	Genres           []TMDbGenre `json:"genres"`
+	EpisodeRunTime   []int       `json:"episode_run_time"`
 }
 
 type TMDbSeries struct {
@@ -119,6 +123,10 @@ func (series TMDbSeries) MediaInfo(api TMDbAPI) MediaInfo {
 }
 
 func (series TMDbSeriesDetails) MediaInfo(api TMDbAPI) MediaInfo {
+	runtime := 0
+	if len(series.EpisodeRunTime) > 0 {
+		runtime = series.EpisodeRunTime[0]
+	}
 	var genres []string
 	for _, tmdbGenre := range series.Genres {
 		genre := api.FindTvGenreById(tmdbGenre.ID)
@@ -137,6 +145,7 @@ func (series TMDbSeriesDetails) MediaInfo(api TMDbAPI) MediaInfo {
 		PosterUrl:     series.PosterURL(),
 		BackdropUrl:   series.BackdropURL(),
 		Genres:        genres,
+		Runtime:       runtime,
 	}
 }
 
@@ -232,6 +241,7 @@ func (movie TMDbMovie) MediaInfo(api TMDbAPI) MediaInfo {
 		PosterUrl:     movie.PosterURL(),
 		BackdropUrl:   movie.BackdropURL(),
 		Genres:        genres,
+		Runtime:       movie.Runtime,
 	}
 }
 
@@ -293,18 +303,36 @@ func (tmdb TMDbSeriesDetails) BackdropURL() string {
 
 // - API
 
-func (api TMDbAPI) FindMovies(title string, year string, page int) (MovieSearchResult, error) {
+// fetch requests the TMDb API: v4 read access tokens are sent in the Authorization header,
+// v3 keys in the `api_key` parameter, which is kept out of cache keys and logs
+func (api TMDbAPI) fetch(ctx context.Context, rawURL string) ([]byte, error) {
+	if isTMDbAccessToken(api.ApiKey) {
+		return FetchURL(ctx, rawURL, map[string]string{"Authorization": "Bearer " + api.ApiKey})
+	}
+	separator := "?"
+	if strings.Contains(rawURL, "?") {
+		separator = "&"
+	}
+	return FetchURL(ctx, rawURL+separator+"api_key="+url.QueryEscape(api.ApiKey), nil)
+}
+
+// v4 read access tokens are JWTs, v3 keys are hex strings
+func isTMDbAccessToken(key string) bool {
+	return strings.HasPrefix(key, "eyJ")
+}
+
+func (api TMDbAPI) FindMovies(ctx context.Context, title string, year string, page int) (MovieSearchResult, error) {
 	if api.TVShowSearch {
-		return api.PerformFindSeries(title, year, page)
+		return api.PerformFindSeries(ctx, title, year, page)
 	} else {
-		return api.PerformFindMovies(title, year, page)
+		return api.PerformFindMovies(ctx, title, year, page)
 	}
 }
 
-func (api TMDbAPI) PerformFindMovies(titlestr string, year string, page int) (MovieSearchResult, error) {
+func (api TMDbAPI) PerformFindMovies(ctx context.Context, titlestr string, year string, page int) (MovieSearchResult, error) {
 	title := strings.ReplaceAll(titlestr, "'", "")
 	query := url.QueryEscape(title)
-	url := fmt.Sprintf("https://api.themoviedb.org/3/search/multi?api_key=%s&page=%d&query=%s&language=%s", api.ApiKey, page, query, api.Language)
+	url := fmt.Sprintf("https://api.themoviedb.org/3/search/multi?page=%d&query=%s&language=%s", page, query, api.Language)
 
 	y := ""
 	// If year is provided, add it to the URL
@@ -319,7 +347,7 @@ func (api TMDbAPI) PerformFindMovies(titlestr string, year string, page int) (Mo
 	Log("fetching tmdb", title, y, p, url)
 
 	// Log(url)
-	response, err := FetchURL(url, map[string]string{})
+	response, err := api.fetch(ctx, url)
 
 	if err != nil {
 		return MovieSearchResult{}, err
@@ -373,12 +401,12 @@ func (api TMDbAPI) FindTvGenreById(genreId int) string {
 	panic(fmt.Sprintf("TV Genre with id %d not found", genreId))
 }
 
-func (api TMDbAPI) LoadMovieDetails(id string) (MediaInfo, error) {
-	url := fmt.Sprintf("https://api.themoviedb.org/3/movie/%s?api_key=%s&language=ru-RU", id, api.ApiKey)
+func (api TMDbAPI) LoadMovieDetails(ctx context.Context, id string) (MediaInfo, error) {
+	url := fmt.Sprintf("https://api.themoviedb.org/3/movie/%s?language=ru-RU", id)
 
 	Log("fetching tmdb movie details", id, url)
 
-	response, err := FetchURL(url, map[string]string{})
+	response, err := api.fetch(ctx, url)
 	if err != nil {
 		return MediaInfo{}, err
 	}
@@ -391,10 +419,10 @@ func (api TMDbAPI) LoadMovieDetails(id string) (MediaInfo, error) {
 	return result.MediaInfo(api), nil
 }
 
-func (api TMDbAPI) PerformFindSeries(titlestr string, year string, page int) (MovieSearchResult, error) {
+func (api TMDbAPI) PerformFindSeries(ctx context.Context, titlestr string, year string, page int) (MovieSearchResult, error) {
 	title := strings.ReplaceAll(titlestr, "'", "")
 	query := url.QueryEscape(title)
-	url := fmt.Sprintf("https://api.themoviedb.org/3/search/tv?api_key=%s&page=%d&query=%s&language=ru-RU", api.ApiKey, page, query)
+	url := fmt.Sprintf("https://api.themoviedb.org/3/search/tv?page=%d&query=%s&language=ru-RU", page, query)
 
 	y := ""
 	// If year is provided, add it to the URL
@@ -410,7 +438,7 @@ func (api TMDbAPI) PerformFindSeries(titlestr string, year string, page int) (Mo
 	}
 	Log("fetching tmdb series", title, y, p, url)
 
-	response, err := FetchURL(url, map[string]string{})
+	response, err := api.fetch(ctx, url)
 	if err != nil {
 		return MovieSearchResult{}, err
 	}
@@ -429,10 +457,10 @@ func (api TMDbAPI) PerformFindSeries(titlestr string, year string, page int) (Mo
 	}, nil
 }
 
-func (api TMDbAPI) getSeriesEpisodes(id MediaId) ([]TMDbEpisode, error) {
+func (api TMDbAPI) getSeriesEpisodes(ctx context.Context, id MediaId) ([]TMDbEpisode, error) {
 	tmdbID := 0
 	if id.idType == IMDB {
-		tvShow, err := api.findTMDbByIMDbID(id.id)
+		tvShow, err := api.findTMDbByIMDbID(ctx, id.id)
 		if err != nil {
 			return nil, err
 		}
@@ -446,14 +474,14 @@ func (api TMDbAPI) getSeriesEpisodes(id MediaId) ([]TMDbEpisode, error) {
 	} else {
 		return nil, nil
 	}
-	return api.getTMDbSeriesEpisodes(tmdbID)
+	return api.getTMDbSeriesEpisodes(ctx, tmdbID)
 }
 
-func (api TMDbAPI) findTMDbByIMDbID(imdbID string) (MediaInfo, error) {
-	url := fmt.Sprintf("https://api.themoviedb.org/3/find/%s?api_key=%s&external_source=imdb_id&language=ru-RU", imdbID, api.ApiKey)
+func (api TMDbAPI) findTMDbByIMDbID(ctx context.Context, imdbID string) (MediaInfo, error) {
+	url := fmt.Sprintf("https://api.themoviedb.org/3/find/%s?external_source=imdb_id&language=ru-RU", imdbID)
 
 	// Send HTTP GET request
-	response, err := FetchURL(url, map[string]string{})
+	response, err := api.fetch(ctx, url)
 	if err != nil {
 		return MediaInfo{}, err
 	}
@@ -474,9 +502,9 @@ func (api TMDbAPI) findTMDbByIMDbID(imdbID string) (MediaInfo, error) {
 	}
 }
 
-func (api TMDbAPI) getTMDbSeriesEpisodes(seriesID int) ([]TMDbEpisode, error) {
+func (api TMDbAPI) getTMDbSeriesEpisodes(ctx context.Context, seriesID int) ([]TMDbEpisode, error) {
 	// Fetch details of the TV series
-	seriesDetails, err := api.LoadSeriesDetails(seriesID)
+	seriesDetails, err := api.LoadSeriesDetails(ctx, seriesID)
 	if err != nil {
 		return nil, err
 	}
@@ -486,7 +514,7 @@ func (api TMDbAPI) getTMDbSeriesEpisodes(seriesID int) ([]TMDbEpisode, error) {
 	// Iterate over each season and fetch episodes
 	for seasonNumber := 1; seasonNumber <= seriesDetails.NumberOfSeasons; seasonNumber++ {
 		// Fetch episodes for the current season
-		episodes, err := getTMDbSeasonEpisodes(seriesID, seasonNumber, api.ApiKey)
+		episodes, err := api.getTMDbSeasonEpisodes(ctx, seriesID, seasonNumber)
 		if err != nil {
 			return nil, err
 		}
@@ -496,10 +524,10 @@ func (api TMDbAPI) getTMDbSeriesEpisodes(seriesID int) ([]TMDbEpisode, error) {
 	return allEpisodes, nil
 }
 
-func (api TMDbAPI) LoadSeriesDetails(seriesID int) (TMDbSeriesDetails, error) {
-	url := fmt.Sprintf("https://api.themoviedb.org/3/tv/%d?api_key=%s&language=ru-RU", seriesID, api.ApiKey)
+func (api TMDbAPI) LoadSeriesDetails(ctx context.Context, seriesID int) (TMDbSeriesDetails, error) {
+	url := fmt.Sprintf("https://api.themoviedb.org/3/tv/%d?language=ru-RU", seriesID)
 
-	response, err := FetchURL(url, map[string]string{})
+	response, err := api.fetch(ctx, url)
 	if err != nil {
 		return TMDbSeriesDetails{}, err
 	}
@@ -512,22 +540,22 @@ func (api TMDbAPI) LoadSeriesDetails(seriesID int) (TMDbSeriesDetails, error) {
 	return seriesDetails, nil
 }
 
-func (api TMDbAPI) LoadSeriesMediaInfo(seriesID string) (MediaInfo, error) {
+func (api TMDbAPI) LoadSeriesMediaInfo(ctx context.Context, seriesID string) (MediaInfo, error) {
 	id, err := strconv.Atoi(seriesID)
 	if err != nil {
 		return MediaInfo{}, err
 	}
-	details, err := api.LoadSeriesDetails(id)
+	details, err := api.LoadSeriesDetails(ctx, id)
 	if err != nil {
 		return MediaInfo{}, err
 	}
 	return details.MediaInfo(api), nil
 }
 
-func getTMDbSeasonEpisodes(seriesID, seasonNumber int, TMDbApiKey string) ([]TMDbEpisode, error) {
-	url := fmt.Sprintf("https://api.themoviedb.org/3/tv/%d/season/%d?api_key=%s&language=ru-RU", seriesID, seasonNumber, TMDbApiKey)
+func (api TMDbAPI) getTMDbSeasonEpisodes(ctx context.Context, seriesID, seasonNumber int) ([]TMDbEpisode, error) {
+	url := fmt.Sprintf("https://api.themoviedb.org/3/tv/%d/season/%d?language=ru-RU", seriesID, seasonNumber)
 
-	response, err := FetchURL(url, map[string]string{})
+	response, err := api.fetch(ctx, url)
 	if err != nil {
 		return nil, err
 	}
@@ -539,3 +567,85 @@ func getTMDbSeasonEpisodes(seriesID, seasonNumber int, TMDbApiKey string) ([]TMD
 
 	return seasonDetails.Episodes, nil
 }
+
+type TMDbImage struct {
+	FilePath    string  `json:"file_path"`
+	Language    string  `json:"iso_639_1"`
+	Width       int     `json:"width"`
+	Height      int     `json:"height"`
+	VoteAverage float64 `json:"vote_average"`
+}
+
+type TMDbImages struct {
+	Backdrops []TMDbImage `json:"backdrops"`
+	Logos     []TMDbImage `json:"logos"`
+	Posters   []TMDbImage `json:"posters"`
+}
+
+type TMDbExternalIds struct {
+	IMDbId string `json:"imdb_id"`
+	TVDbId int    `json:"tvdb_id"`
+}
+
+func (image TMDbImage) URL() string {
+	return fmt.Sprintf("https://image.tmdb.org/t/p/original%s", image.FilePath)
+}
+
+// load posters, backdrops and logos for a movie or TV show in the preferred languages
+func (api TMDbAPI) LoadImages(ctx context.Context, id string, isTvShow bool, languages []string) ([]Artwork, error) {
+	mediaType := "movie"
+	if isTvShow {
+		mediaType = "tv"
+	}
+	// images without text have `null` language
+	imageLanguages := mapSlice(languages, func(lang string) string { return Coalesce(lang, "null") })
+	url := fmt.Sprintf("https://api.themoviedb.org/3/%s/%s/images?include_image_language=%s", mediaType, id, strings.Join(imageLanguages, ","))
+
+	Log("fetching tmdb images", id, url)
+
+	response, err := api.fetch(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+
+	var images TMDbImages
+	if err := json.Unmarshal(response, &images); err != nil {
+		return nil, err
+	}
+
+	var artwork []Artwork
+	appendImages := func(artworkType ArtworkType, images []TMDbImage) {
+		for _, image := range images {
+			// Kodi can't display svg logos
+			if strings.HasSuffix(image.FilePath, ".svg") {
+				continue
+			}
+			artwork = append(artwork, Artwork{Type: artworkType, Url: image.URL(), Language: image.Language, Rating: image.VoteAverage})
+		}
+	}
+	appendImages(ArtworkPoster, images.Posters)
+	appendImages(ArtworkFanart, images.Backdrops)
+	appendImages(ArtworkClearLogo, images.Logos)
+
+	return artwork, nil
+}
+
+func (api TMDbAPI) LoadExternalIds(ctx context.Context, id string, isTvShow bool) (TMDbExternalIds, error) {
+	mediaType := "movie"
+	if isTvShow {
+		mediaType = "tv"
+	}
+	url := fmt.Sprintf("https://api.themoviedb.org/3/%s/%s/external_ids", mediaType, id)
+
+	response, err := api.fetch(ctx, url)
+	if err != nil {
+		return TMDbExternalIds{}, err
+	}
+
+	var externalIds TMDbExternalIds
+	if err := json.Unmarshal(response, &externalIds); err != nil {
+		return TMDbExternalIds{}, err
+	}
+
+	return externalIds, nil
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+type ArtworkType string
+
+const (
+	ArtworkPoster    ArtworkType = "poster"
+	ArtworkFanart    ArtworkType = "fanart"
+	ArtworkClearLogo ArtworkType = "clearlogo"
+	ArtworkClearArt  ArtworkType = "clearart"
+	ArtworkBanner    ArtworkType = "banner"
+	ArtworkLandscape ArtworkType = "landscape"
+	ArtworkDiscArt   ArtworkType = "discart"
+)
+
+var allArtworkTypes []ArtworkType = []ArtworkType{ArtworkPoster, ArtworkFanart, ArtworkClearLogo, ArtworkClearArt, ArtworkBanner, ArtworkLandscape, ArtworkDiscArt}
+
+type Artwork struct {
+	Type     ArtworkType
+	Url      string
+	Language string
+	// votes/likes of the image at its source, used to pick the best one
+	Rating float64
+}
+
+type ArtworkConfig struct {
+	// artwork types to download, all by default
+	Types []ArtworkType `json:"types,omitempty"`
+	// preferred image languages in order, "" stands for images without text
+	Languages []string `json:"languages,omitempty"`
+
+	// downloaded images exceeding the resolution are downscaled, 0 means no limit
+	MaxWidth  int `json:"max_width,omitempty"`
+	MaxHeight int `json:"max_height,omitempty"`
+	// quality of re-encoded JPEG images, 90 by default
+	JpegQuality int `json:"jpeg_quality,omitempty"`
+	// number of download attempts on network and server errors, 3 by default
+	DownloadAttempts int `json:"download_attempts,omitempty"`
+}
+
+func (c ArtworkConfig) enabledTypes(isTvShow bool) []ArtworkType {
+	types := c.Types
+	if len(types) == 0 {
+		types = allArtworkTypes
+	}
+	if isTvShow {
+		// there are no discs for TV Shows in Kodi
+		types = filterSlice(types, func(t ArtworkType) bool { return t != ArtworkDiscArt })
+	}
+	return types
+}
+
+func (c ArtworkConfig) preferredLanguages() []string {
+	if len(c.Languages) == 0 {
+		return []string{"ru", "en", ""}
+	}
+	return c.Languages
+}
+
+func (c ArtworkConfig) jpegQuality() int {
+	if c.JpegQuality <= 0 || c.JpegQuality > 100 {
+		return 90
+	}
+	return c.JpegQuality
+}
+
+func (c ArtworkConfig) downloadAttempts() int {
+	if c.DownloadAttempts <= 0 {
+		return 3
+	}
+	return c.DownloadAttempts
+}
+
+// transparent artwork is stored as png, photos as jpg
+func (t ArtworkType) fileExtension() string {
+	switch t {
+	case ArtworkClearLogo, ArtworkClearArt, ArtworkDiscArt:
+		return "png"
+	default:
+		return "jpg"
+	}
+}
+
+// Kodi artwork file name suffix for a movie, e.g. `-clearlogo.png`
+func (t ArtworkType) movieFileSuffix() string {
+	return "-" + string(t) + "." + t.fileExtension()
+}
+
+// Kodi artwork file name in a TV Show folder, e.g. `clearlogo.png`
+func (t ArtworkType) tvShowFileName() string {
+	return string(t) + "." + t.fileExtension()
+}
+
+// collect the best artwork of every enabled type for a media item
+// images already present in MediaInfo take precedence over TMDb and fanart.tv ones
+func findArtwork(ctx context.Context, info MediaInfo, config Config) []Artwork {
+	types := config.Artwork.enabledTypes(info.IsTvShow)
+	languages := config.Artwork.preferredLanguages()
+
+	selected := make(map[ArtworkType]Artwork)
+	for _, artwork := range []Artwork{
+		{Type: ArtworkPoster, Url: info.PosterUrl},
+		{Type: ArtworkFanart, Url: info.BackdropUrl},
+		{Type: ArtworkClearLogo, Url: info.LogoUrl},
+	} {
+		if artwork.Url != "" {
+			selected[artwork.Type] = artwork
+		}
+	}
+
+	var candidates []Artwork
+	if info.Id.idType == TMDB && config.TMDbApiKey != "" {
+		tmdbApi := TMDbAPI{ApiKey: config.TMDbApiKey}
+		images, err := tmdbApi.LoadImages(ctx, info.Id.id, info.IsTvShow, languages)
+		if err != nil {
+			Log("could not load TMDb images:", err)
+		}
+		candidates = append(candidates, images...)
+	}
+	if config.FanartTvApiKey != "" {
+		fanartApi := FanartTvAPI{ApiKey: config.FanartTvApiKey}
+		images, err := fanartApi.LoadArtwork(ctx, info.Id, info.IsTvShow, TMDbAPI{ApiKey: config.TMDbApiKey})
+		if err != nil {
+			Log("could not load fanart.tv images:", err)
+		}
+		candidates = append(candidates, images...)
+	}
+	for _, artwork := range selectBestArtwork(candidates, languages) {
+		if _, ok := selected[artwork.Type]; !ok {
+			selected[artwork.Type] = artwork
+		}
+	}
+
+	var result []Artwork
+	for _, t := range types {
+		if artwork, ok := selected[t]; ok {
+			result = append(result, artwork)
+		}
+	}
+	return result
+}
+
+// pick one image per artwork type by language preference, then by rating
+func selectBestArtwork(candidates []Artwork, languages []string) []Artwork {
+	languageRank := func(lang string) int {
+		for idx, l := range languages {
+			if strings.EqualFold(l, lang) {
+				return idx
+			}
+		}
+		return len(languages)
+	}
+	sorted := append([]Artwork{}, candidates...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		ri, rj := languageRank(sorted[i].Language), languageRank(sorted[j].Language)
+		if ri != rj {
+			return ri < rj
+		}
+		return sorted[i].Rating > sorted[j].Rating
+	})
+
+	var result []Artwork
+	taken := make(map[ArtworkType]bool)
+	for _, artwork := range sorted {
+		if taken[artwork.Type] || artwork.Url == "" || languageRank(artwork.Language) == len(languages) {
+			continue
+		}
+		taken[artwork.Type] = true
+		result = append(result, artwork)
+	}
+	return result
+}
+
+// download artwork files into a directory, already existing files are kept
+// returns the artwork present in the directory after download
+func downloadArtwork(ctx context.Context, artwork []Artwork, dir Path, fileName func(ArtworkType) string, config ArtworkConfig) []Artwork {
+	var downloaded []Artwork
+	for _, art := range artwork {
+		path := dir.appendingPathComponent(fileName(art.Type))
+		if !path.exists() {
+			if err := downloadImage(ctx, art.Url, path, config); err != nil {
+				Log("Could not download", art.Type, err)
+				continue
+			}
+			journal.record(JournalEntry{Action: ImageAction, Path: path, Source: Path(art.Url)})
+		}
+		downloaded = append(downloaded, art)
+	}
+	return downloaded
+}
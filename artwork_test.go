@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestSelectBestArtwork(t *testing.T) {
+	tests := []struct {
+		name       string
+		candidates []Artwork
+		languages  []string
+		expected   []string
+	}{
+		{
+			name: "preferred language first",
+			candidates: []Artwork{
+				{Type: ArtworkPoster, Url: "en", Language: "en", Rating: 10},
+				{Type: ArtworkPoster, Url: "ru", Language: "ru", Rating: 1},
+				{Type: ArtworkPoster, Url: "textless", Language: "", Rating: 5},
+			},
+			languages: []string{"ru", "en", ""},
+			expected:  []string{"ru"},
+		},
+		{
+			name: "textless fallback",
+			candidates: []Artwork{
+				{Type: ArtworkFanart, Url: "en", Language: "en", Rating: 10},
+				{Type: ArtworkFanart, Url: "textless", Language: "", Rating: 5},
+			},
+			languages: []string{"ru", ""},
+			expected:  []string{"textless"},
+		},
+		{
+			name: "most voted of the language",
+			candidates: []Artwork{
+				{Type: ArtworkClearLogo, Url: "few", Language: "EN", Rating: 2},
+				{Type: ArtworkClearLogo, Url: "many", Language: "en", Rating: 12},
+				{Type: ArtworkClearLogo, Url: "some", Language: "en", Rating: 7},
+			},
+			languages: []string{"en"},
+			expected:  []string{"many"},
+		},
+		{
+			name: "one image per type",
+			candidates: []Artwork{
+				{Type: ArtworkPoster, Url: "poster", Language: "en", Rating: 3},
+				{Type: ArtworkBanner, Url: "banner", Language: "en", Rating: 1},
+				{Type: ArtworkPoster, Url: "other poster", Language: "en", Rating: 2},
+				{Type: ArtworkDiscArt, Url: "", Language: "en", Rating: 9},
+				{Type: ArtworkDiscArt, Url: "disc", Language: "en", Rating: 1},
+			},
+			languages: []string{"en"},
+			expected:  []string{"poster", "banner", "disc"},
+		},
+		{
+			name: "unlisted languages skipped",
+			candidates: []Artwork{
+				{Type: ArtworkPoster, Url: "de", Language: "de", Rating: 10},
+			},
+			languages: []string{"ru", ""},
+			expected:  []string{},
+		},
+	}
+	for _, test := range tests {
+		urls := mapSlice(selectBestArtwork(test.candidates, test.languages), func(artwork Artwork) string { return artwork.Url })
+		if !reflect.DeepEqual(urls, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, urls)
+		}
+	}
+}
+
+func TestFanartTvArtworkTypes(t *testing.T) {
+	describe := func(artwork []Artwork) []string {
+		var descriptions []string
+		for _, image := range artwork {
+			descriptions = append(descriptions, string(image.Type)+" "+image.Url+" "+image.Language)
+		}
+		sort.Strings(descriptions)
+		return descriptions
+	}
+
+	var movieImages FanartTvMovieImages
+	err := json.Unmarshal([]byte(`{
+		"name": "Inception",
+		"tmdb_id": "27205",
+		"hdmovielogo": [{"id": "1", "url": "hdmovielogo", "lang": "en", "likes": "5"}],
+		"movielogo": [{"id": "2", "url": "movielogo", "lang": "ru", "likes": "1"}],
+		"hdmovieclearart": [{"id": "3", "url": "hdmovieclearart", "lang": "en", "likes": "2"}],
+		"moviebanner": [{"id": "4", "url": "moviebanner", "lang": "en", "likes": "0"}],
+		"moviethumb": [{"id": "5", "url": "moviethumb", "lang": "en", "likes": "3"}],
+		"moviedisc": [{"id": "6", "url": "moviedisc", "lang": "en", "likes": "1", "disc": "1", "disc_type": "bluray"}],
+		"movieposter": [{"id": "7", "url": "movieposter", "lang": "00", "likes": "4"}],
+		"moviebackground": [{"id": "8", "url": "moviebackground", "lang": "", "likes": "6"}]
+	}`), &movieImages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	movieArtwork := movieImages.Artwork()
+	expected := []string{
+		"banner moviebanner en",
+		"clearart hdmovieclearart en",
+		"clearlogo hdmovielogo en",
+		"clearlogo movielogo ru",
+		"discart moviedisc en",
+		"fanart moviebackground ",
+		"landscape moviethumb en",
+		"poster movieposter ",
+	}
+	if descriptions := describe(movieArtwork); !reflect.DeepEqual(descriptions, expected) {
+		t.Errorf("unexpected movie artwork %v", descriptions)
+	}
+	for _, artwork := range movieArtwork {
+		if artwork.Url == "moviebackground" && artwork.Rating != 6 {
+			t.Errorf("likes aren't taken as the rating: %v", artwork)
+		}
+	}
+
+	var showImages FanartTvShowImages
+	err = json.Unmarshal([]byte(`{
+		"name": "Game of Thrones",
+		"thetvdb_id": "121361",
+		"hdtvlogo": [{"id": "11", "url": "hdtvlogo", "lang": "en", "likes": "9"}],
+		"clearlogo": [{"id": "12", "url": "clearlogo", "lang": "en", "likes": "1"}],
+		"hdclearart": [{"id": "13", "url": "hdclearart", "lang": "en", "likes": "2"}],
+		"tvbanner": [{"id": "14", "url": "tvbanner", "lang": "en", "likes": "3"}],
+		"tvthumb": [{"id": "15", "url": "tvthumb", "lang": "en", "likes": "4"}],
+		"tvposter": [{"id": "16", "url": "tvposter", "lang": "ru", "likes": "5"}],
+		"showbackground": [{"id": "17", "url": "showbackground", "lang": "00", "likes": "6"}]
+	}`), &showImages)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{
+		"banner tvbanner en",
+		"clearart hdclearart en",
+		"clearlogo clearlogo en",
+		"clearlogo hdtvlogo en",
+		"fanart showbackground ",
+		"landscape tvthumb en",
+		"poster tvposter ru",
+	}
+	if descriptions := describe(showImages.Artwork()); !reflect.DeepEqual(descriptions, expected) {
+		t.Errorf("unexpected TV Show artwork %v", descriptions)
+	}
+}
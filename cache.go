@@ -0,0 +1,366 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheConfig controls the response cache in `cache/responses`
+type CacheConfig struct {
+	// the oldest responses are evicted above this size, 1024 MB by default
+	MaxSizeMB int `json:"max_size_mb,omitempty"`
+	// hours a response of the provider is fresh, merged over the defaults; 0 keeps responses forever
+	TTLHours map[string]int `json:"ttl_hours,omitempty"`
+}
+
+// freshness of provider responses: search results change, rutracker topics and prompt answers don't
+var defaultCacheTTLHours = map[string]int{
+	"tmdb":      7 * 24,
+	"imdb":      30 * 24,
+	"kinopoisk": 30 * 24,
+	"fanarttv":  7 * 24,
+	"rutracker": 0,
+	"openai":    0,
+	"ollama":    0,
+}
+
+// providers by API host, other hosts are cached under their host name
+var cacheProviders = map[string]string{
+	"api.themoviedb.org":   "tmdb",
+	"www.imdb.com":         "imdb",
+	"api.kinopoisk.dev":    "kinopoisk",
+	"webservice.fanart.tv": "fanarttv",
+	"rutracker.org":        "rutracker",
+	"api.openai.com":       "openai",
+}
+
+// query parameters never written to the cache
+var secretQueryParams = []string{"api_key", "apikey", "key", "token", "access_token"}
+
+const responsesDirName = "responses"
+
+var cacheConfig CacheConfig
+
+// guards eviction and purging against concurrent writes
+var cacheMutex sync.Mutex
+
+// configureCache applies `cache` from the config
+func configureCache(config CacheConfig) {
+	cacheConfig = config
+}
+
+func (c CacheConfig) ttl(provider string) time.Duration {
+	hours, ok := c.TTLHours[provider]
+	if !ok {
+		hours = defaultCacheTTLHours[provider]
+	}
+	return time.Duration(hours) * time.Hour
+}
+
+func (c CacheConfig) maxSize() int64 {
+	if c.MaxSizeMB <= 0 {
+		return 1024 * 1024 * 1024
+	}
+	return int64(c.MaxSizeMB) * 1024 * 1024
+}
+
+// CachedResponse is the metadata of a cached response, the body is stored next to it
+type CachedResponse struct {
+	// URL without secrets, or a key like `openai:<prompt key>` for processed results
+	Key      string      `json:"key"`
+	Provider string      `json:"provider"`
+	Status   int         `json:"status"`
+	Header   http.Header `json:"header,omitempty"`
+	Stored   time.Time   `json:"stored"`
+	Size     int64       `json:"size"`
+
+	Body []byte `json:"-"`
+}
+
+func (r CachedResponse) isExpired(now time.Time) bool {
+	ttl := cacheConfig.ttl(r.Provider)
+	return ttl > 0 && now.Sub(r.Stored) > ttl
+}
+
+func responsesDir() Path {
+	return Path(CacheDir).appendingPathComponent(responsesDirName)
+}
+
+// redactURL removes API keys and tokens from the URL
+func redactURL(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	query := parsed.Query()
+	for _, param := range secretQueryParams {
+		query.Del(param)
+	}
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
+}
+
+func cacheProviderForURL(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return "other"
+	}
+	host := strings.ToLower(parsed.Hostname())
+	if provider, ok := cacheProviders[host]; ok {
+		return provider
+	}
+	return host
+}
+
+// cachePaths returns the metadata and body paths of the key: `<provider>/<hash[:2]>/<hash>`
+func cachePaths(provider string, key string) (Path, Path) {
+	hash := sha256.Sum256([]byte(key))
+	name := hex.EncodeToString(hash[:])
+	base := responsesDir().appendingPathComponent(sanitizeFileName(provider)).appendingPathComponent(name[:2]).appendingPathComponent(name)
+	return Path(string(base) + ".json"), Path(string(base) + ".body")
+}
+
+// loadCachedResponse returns a fresh cached response
+func loadCachedResponse(provider string, key string) (CachedResponse, bool) {
+	metaPath, bodyPath := cachePaths(provider, key)
+	response, err := readCachedResponseMeta(metaPath)
+	if err != nil || response.Key != key {
+		return CachedResponse{}, false
+	}
+	if response.isExpired(time.Now()) {
+		Log("⌛ cached response expired:", key)
+		return CachedResponse{}, false
+	}
+	body, err := os.ReadFile(string(bodyPath))
+	if err != nil {
+		return CachedResponse{}, false
+	}
+	response.Body = body
+	return response, true
+}
+
+// storeCachedResponse writes the body first, so metadata never points to a missing body
+func storeCachedResponse(response CachedResponse) error {
+	metaPath, bodyPath := cachePaths(response.Provider, response.Key)
+	if err := os.MkdirAll(string(metaPath.removingLastPathComponent()), 0755); err != nil {
+		return err
+	}
+	response.Stored = time.Now()
+	response.Size = int64(len(response.Body))
+	meta, err := json.MarshalIndent(response, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomically(bodyPath, response.Body); err != nil {
+		return err
+	}
+	return writeFileAtomically(metaPath, meta)
+}
+
+func readCachedResponseMeta(metaPath Path) (CachedResponse, error) {
+	data, err := os.ReadFile(string(metaPath))
+	if err != nil {
+		return CachedResponse{}, err
+	}
+	var response CachedResponse
+	err = json.Unmarshal(data, &response)
+	return response, err
+}
+
+// cachedResponseFile is a cached response found on disk
+type cachedResponseFile struct {
+	CachedResponse
+	metaPath Path
+}
+
+func (f cachedResponseFile) remove() {
+	os.Remove(string(f.metaPath))
+	os.Remove(strings.TrimSuffix(string(f.metaPath), ".json") + ".body")
+}
+
+// listCachedResponses returns cached responses of the provider (all when empty), oldest first
+func listCachedResponses(provider string) ([]cachedResponseFile, error) {
+	root := responsesDir()
+	if provider != "" {
+		root = root.appendingPathComponent(sanitizeFileName(provider))
+	}
+	var files []cachedResponseFile
+	err := filepath.WalkDir(string(root), func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(path, ".json") {
+			return nil
+		}
+		response, err := readCachedResponseMeta(Path(path))
+		if err != nil {
+			Log("⚠️ removing broken cache entry", path, err)
+			cachedResponseFile{metaPath: Path(path)}.remove()
+			return nil
+		}
+		files = append(files, cachedResponseFile{CachedResponse: response, metaPath: Path(path)})
+		return nil
+	})
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].Stored.Before(files[j].Stored)
+	})
+	return files, err
+}
+
+// purgeCache removes responses of the provider (all when empty) stored more than olderThan ago (any age when 0)
+func purgeCache(provider string, olderThan time.Duration) (int, error) {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+	files, err := listCachedResponses(provider)
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, file := range files {
+		if olderThan == 0 || time.Since(file.Stored) > olderThan {
+			file.remove()
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+// evictCache removes expired responses and the oldest ones above the size limit
+func evictCache() error {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+	files, err := listCachedResponses("")
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	var total int64
+	var kept []cachedResponseFile
+	for _, file := range files {
+		if file.isExpired(now) {
+			file.remove()
+			continue
+		}
+		total += file.Size
+		kept = append(kept, file)
+	}
+	evicted := len(files) - len(kept)
+	for _, file := range kept {
+		if total <= cacheConfig.maxSize() {
+			break
+		}
+		file.remove()
+		total -= file.Size
+		evicted++
+	}
+	if evicted > 0 {
+		Log("🧹 evicted", evicted, "cached responses")
+	}
+	return nil
+}
+
+// invalidateCachedURL removes the cached response of the URL
+func invalidateCachedURL(rawURL string) bool {
+	metaPath, _ := cachePaths(cacheProviderForURL(rawURL), redactURL(rawURL))
+	if !metaPath.exists() {
+		return false
+	}
+	cachedResponseFile{metaPath: metaPath}.remove()
+	return true
+}
+
+// runCacheCommand handles `cache list [provider]`, `cache stats`, `cache purge [provider] [age]` and `cache invalidate <url>`
+func runCacheCommand(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: cache list [provider] | stats | purge [provider] [age, e.g. 720h] | invalidate <url>")
+	}
+	switch args[0] {
+	case "list":
+		provider := ""
+		if len(args) > 1 {
+			provider = args[1]
+		}
+		files, err := listCachedResponses(provider)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			Logf("%s %-10s %3d %8d %s\n", file.Stored.Format("2006-01-02 15:04"), file.Provider, file.Status, file.Size, file.Key)
+		}
+		return nil
+
+	case "stats":
+		files, err := listCachedResponses("")
+		if err != nil {
+			return err
+		}
+		type providerStats struct {
+			count   int
+			size    int64
+			expired int
+		}
+		stats := make(map[string]*providerStats)
+		var providers []string
+		now := time.Now()
+		for _, file := range files {
+			if stats[file.Provider] == nil {
+				stats[file.Provider] = &providerStats{}
+				providers = append(providers, file.Provider)
+			}
+			stats[file.Provider].count++
+			stats[file.Provider].size += file.Size
+			if file.isExpired(now) {
+				stats[file.Provider].expired++
+			}
+		}
+		sort.Strings(providers)
+		for _, provider := range providers {
+			s := stats[provider]
+			Logf("%-10s %6d responses %8.1f MB %6d expired, ttl %s\n", provider, s.count, float64(s.size)/1024/1024, s.expired, cacheConfig.ttl(provider))
+		}
+		return nil
+
+	case "purge":
+		provider := ""
+		var olderThan time.Duration
+		for _, arg := range args[1:] {
+			if age, err := time.ParseDuration(arg); err == nil {
+				olderThan = age
+			} else {
+				provider = arg
+			}
+		}
+		removed, err := purgeCache(provider, olderThan)
+		if err != nil {
+			return err
+		}
+		Logf("🧹 purged %d cached responses\n", removed)
+		return nil
+
+	case "invalidate":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: cache invalidate <url>")
+		}
+		if !invalidateCachedURL(args[1]) {
+			return fmt.Errorf("%s is not cached", redactURL(args[1]))
+		}
+		Log("🧹 invalidated", redactURL(args[1]))
+		return nil
+
+	default:
+		return fmt.Errorf("unknown cache command `%s`", args[0])
+	}
+}
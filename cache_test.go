@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func setupCacheTest(t *testing.T, config CacheConfig) {
+	originalCacheDir, originalConfig := CacheDir, cacheConfig
+	t.Cleanup(func() { CacheDir, cacheConfig = originalCacheDir, originalConfig })
+	CacheDir = t.TempDir()
+	cacheConfig = config
+}
+
+func TestFetchURLCachesWithoutSecrets(t *testing.T) {
+	setupCacheTest(t, CacheConfig{})
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write([]byte(`{"id": 1}`))
+	}))
+	defer server.Close()
+
+	url := server.URL + "/3/movie/1?api_key=SECRET&language=ru-RU"
+	for i := 0; i < 2; i++ {
+		body, err := FetchURL(context.Background(), url, nil)
+		if err != nil || string(body) != `{"id": 1}` {
+			t.Fatalf("unexpected response %q %v", body, err)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("expected the second fetch to be cached, got %d requests", requests)
+	}
+
+	filepath.Walk(CacheDir, func(path string, info os.FileInfo, err error) error {
+		data, _ := os.ReadFile(path)
+		if strings.Contains(path, "SECRET") || strings.Contains(string(data), "SECRET") {
+			t.Errorf("api key written to the cache: %s", path)
+		}
+		return nil
+	})
+
+	if !invalidateCachedURL(url) {
+		t.Fatalf("cached URL was not invalidated")
+	}
+	FetchURL(context.Background(), url, nil)
+	if requests != 2 {
+		t.Errorf("expected a request after invalidation, got %d requests", requests)
+	}
+}
+
+func TestCachedResponsesExpireAndEvict(t *testing.T) {
+	setupCacheTest(t, CacheConfig{TTLHours: map[string]int{"tmdb": 1}})
+	stale := CachedResponse{Key: "https://api.themoviedb.org/3/movie/1", Provider: "tmdb", Status: 200, Body: []byte("old")}
+	if err := storeCachedResponse(stale); err != nil {
+		t.Fatal(err)
+	}
+	// backdate the stored time
+	metaPath, _ := cachePaths(stale.Provider, stale.Key)
+	meta, _ := readCachedResponseMeta(metaPath)
+	meta.Stored = time.Now().Add(-2 * time.Hour)
+	data, _ := json.Marshal(meta)
+	os.WriteFile(string(metaPath), data, 0644)
+
+	if _, ok := loadCachedResponse(stale.Provider, stale.Key); ok {
+		t.Errorf("expired response was used")
+	}
+
+	cacheConfig.MaxSizeMB = 1
+	big := make([]byte, 700*1024)
+	for _, key := range []string{"openai:a", "openai:b"} {
+		if err := storeCachedResponse(CachedResponse{Key: key, Provider: "openai", Status: 200, Body: big}); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := evictCache(); err != nil {
+		t.Fatal(err)
+	}
+	files, _ := listCachedResponses("")
+	if len(files) != 1 || files[0].Key != "openai:b" {
+		t.Errorf("expected the newest response to be kept, got %v", files)
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"unicode/utf8"
+)
+
+// go test -run TestName -record re-records the cassette of the test with real API keys from the config
+var recordCassettes = flag.Bool("record", false, "record HTTP cassettes in testdata/cassettes instead of replaying them")
+
+// Interaction is a recorded request and its response, URLs are stored without API keys
+type Interaction struct {
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	RequestBody string      `json:"request_body,omitempty"`
+	Status      int         `json:"status"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        string      `json:"body,omitempty"`
+	// binary bodies like images are base64 encoded
+	BodyBase64 string `json:"body_base64,omitempty"`
+}
+
+func (i Interaction) matches(method string, redactedURL string, body []byte) bool {
+	return i.Method == method && i.URL == redactedURL && (i.RequestBody == "" || i.RequestBody == string(body))
+}
+
+func (i Interaction) response(req *http.Request) (*http.Response, error) {
+	body := []byte(i.Body)
+	if i.BodyBase64 != "" {
+		var err error
+		if body, err = base64.StdEncoding.DecodeString(i.BodyBase64); err != nil {
+			return nil, err
+		}
+	}
+	return &http.Response{
+		StatusCode:    i.Status,
+		Status:        fmt.Sprintf("%d %s", i.Status, http.StatusText(i.Status)),
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        i.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// Cassette replays the interactions of testdata/cassettes/<test>.json, or records them with -record;
+// requests to hosts routed to fake servers and to loopback addresses are passed through
+type Cassette struct {
+	path         string
+	recording    bool
+	routes       map[string]string
+	mutex        sync.Mutex
+	Interactions []Interaction `json:"interactions"`
+}
+
+// useCassette replaces the shared HTTP client with one using the test's cassette,
+// routes maps hosts like api.openai.com to fake servers
+func useCassette(t *testing.T, routes map[string]*httptest.Server) *Cassette {
+	t.Helper()
+	cassette := &Cassette{
+		path:      filepath.Join("testdata", "cassettes", t.Name()+".json"),
+		recording: *recordCassettes,
+		routes:    make(map[string]string),
+	}
+	for host, server := range routes {
+		target, _ := url.Parse(server.URL)
+		cassette.routes[host] = target.Host
+	}
+	if data, err := os.ReadFile(cassette.path); err == nil {
+		if err := json.Unmarshal(data, cassette); err != nil {
+			t.Fatalf("invalid cassette %s: %v", cassette.path, err)
+		}
+	} else if !cassette.recording {
+		t.Fatalf("no cassette %s, run the test with -record", cassette.path)
+	}
+	if cassette.recording {
+		cassette.Interactions = nil
+		t.Cleanup(func() {
+			if err := cassette.save(); err != nil {
+				t.Errorf("could not save cassette: %v", err)
+			}
+		})
+	}
+
+	originalClient := httpClient
+	t.Cleanup(func() { httpClient = originalClient })
+	httpClient = newHTTPClient(HTTPConfig{})
+	httpClient.retryDelay = 0
+	httpClient.client.Transport = cassette
+	return cassette
+}
+
+func (c *Cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	if host, ok := c.routes[req.URL.Hostname()]; ok {
+		req.URL.Scheme, req.URL.Host = "http", host
+		return http.DefaultTransport.RoundTrip(req)
+	}
+	if ip := net.ParseIP(req.URL.Hostname()); ip != nil && ip.IsLoopback() {
+		return http.DefaultTransport.RoundTrip(req)
+	}
+
+	var body []byte
+	if req.Body != nil {
+		var err error
+		if body, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	redactedURL := redactURL(req.URL.String())
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.recording {
+		for _, interaction := range c.Interactions {
+			if interaction.matches(req.Method, redactedURL, body) {
+				return interaction.response(req)
+			}
+		}
+		return nil, fmt.Errorf("cassette %s has no interaction for %s %s", c.path, req.Method, redactedURL)
+	}
+
+	resp, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	interaction := Interaction{Method: req.Method, URL: redactedURL, Status: resp.StatusCode, Header: http.Header{}}
+	if req.Method != http.MethodGet {
+		interaction.RequestBody = redactSecrets(string(body))
+	}
+	interaction.Header.Set("Content-Type", resp.Header.Get("Content-Type"))
+	if utf8.Valid(data) {
+		interaction.Body = redactSecrets(string(data))
+	} else {
+		interaction.BodyBase64 = base64.StdEncoding.EncodeToString(data)
+	}
+	c.Interactions = append(c.Interactions, interaction)
+	return interaction.response(req)
+}
+
+func (c *Cassette) save() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(c.path, data, 0644)
+}
+
+// useRecordingApiKeys replaces the test API keys with the real ones of the config while recording
+func useRecordingApiKeys(t *testing.T, config *Config) {
+	t.Helper()
+	if !*recordCassettes {
+		return
+	}
+	realConfig, err := LoadConfig("")
+	if err != nil {
+		t.Fatalf("recording needs the real config with API keys: %v", err)
+	}
+	registerConfigSecrets(*realConfig)
+	config.TMDbApiKey = realConfig.TMDbApiKey
+	config.KinopoiskApiKey = realConfig.KinopoiskApiKey
+	config.FanartTvApiKey = realConfig.FanartTvApiKey
+}
@@ -1,13 +1,10 @@
 package main
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
-	"os"
-	"path/filepath"
 )
 
 type Message struct {
@@ -36,95 +33,37 @@ type Usage struct {
 	TotalTokens      int `json:"total_tokens"`
 }
 
-func promptAI(prompt string, chatGptToken string, cacheKey string) (ChatGPTResponse, error) {
-	// Use provided cacheKey for the cache file name
-	cacheFilename := filepath.Join(CacheDir, "chatgpt", cacheKey+".json")
-	chatgptCacheDir := filepath.Join(CacheDir, "chatgpt")
-
-	// Ensure the chatgpt cache directory exists
-	if !Path(chatgptCacheDir).isDirectory() {
-		if err := os.MkdirAll(chatgptCacheDir, 0755); err != nil {
-			Log("Error creating ChatGPT cache directory:", err)
-		}
-	}
-
-	// Check if the cached data exists
-	if _, err := os.Stat(cacheFilename); err == nil {
-		// If cached data exists, read and return it
-		if os.Getenv("TEST_MODE") == "true" {
-			Log("🔄 TEST MODE: Using cached ChatGPT response for prompt", cacheKey)
-		} else {
-			Log("🔄 Using cached ChatGPT response for prompt", cacheKey)
-		}
-
-		data, err := os.ReadFile(cacheFilename)
-		if err != nil {
-			return ChatGPTResponse{}, err
-		}
-
+func promptAI(ctx context.Context, prompt string, llm LLMConfig, cacheKey string) (ChatGPTResponse, error) {
+	// the prompt key identifies the answer in the response cache
+	key := llm.cacheKey(cacheKey)
+	if cached, ok := loadCachedResponse(llm.Backend, key); ok {
+		Log("🔄 Using cached LLM response for prompt", cacheKey)
 		var response ChatGPTResponse
-		if err := json.Unmarshal(data, &response); err != nil {
+		if err := json.Unmarshal(cached.Body, &response); err != nil {
 			return ChatGPTResponse{}, err
 		}
-
 		return response, nil
 	}
 
-	// Cache miss - need to get a response
-	// In test mode, create a simplified mock response instead of making API call
-	if os.Getenv("TEST_MODE") == "true" {
-		Log("💥💥💥 Making real ChatGPT API request (cache miss)")
-	}
-
-	// Real API call for production
-	// Normal API call flow for non-test mode
-	requestData := map[string]interface{}{
-		"messages":    []Message{{Role: "user", Content: prompt}},
-		"model":       "gpt-3.5-turbo",
-		"max_tokens":  80,
-		"temperature": 0,
-	}
-
-	jsonData, err := json.Marshal(requestData)
-	if err != nil {
+	// cached answers are free, only new prompts count against the budget
+	if err := llmUsage.checkBudget(); err != nil {
 		return ChatGPTResponse{}, err
 	}
-
-	apiKey := chatGptToken
-	apiUrl := "https://api.openai.com/v1/chat/completions"
-	req, err := http.NewRequest("POST", apiUrl, bytes.NewBuffer(jsonData))
+	response, err := llm.complete(ctx, prompt)
 	if err != nil {
 		return ChatGPTResponse{}, err
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+apiKey)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return ChatGPTResponse{}, err
+	llmUsage.record(ctx, response.Usage)
+	if len(response.Choices) == 0 {
+		return ChatGPTResponse{}, fmt.Errorf("%s returned no answer", llm.Model)
 	}
-	defer resp.Body.Close()
 
-	// Read and parse the response
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return ChatGPTResponse{}, err
-	}
-
-	var response ChatGPTResponse
-	if err := json.Unmarshal(body, &response); err != nil {
-		return ChatGPTResponse{}, err
-	}
-
-	// Write the response to the cache file
+	// Write the response to the cache
 	responseData, err := json.Marshal(response)
 	if err != nil {
-		Log("Error marshaling ChatGPT response for cache:", err)
-	} else {
-		if err := os.WriteFile(cacheFilename, responseData, 0644); err != nil {
-			Log("Error writing ChatGPT cache file:", err)
-		}
+		Log("Error marshaling LLM response for cache:", err)
+	} else if err := storeCachedResponse(CachedResponse{Key: key, Provider: llm.Backend, Status: http.StatusOK, Body: responseData}); err != nil {
+		Log("Error writing LLM cache file:", err)
 	}
 
 	return response, nil
@@ -136,7 +75,7 @@ type GPTMovieInfo struct {
 	Error *string `json:"error"`
 }
 
-func promptAiForMovieNameAndYear(fileName string, chatGptToken string) (string, string, error) {
+func promptAiForMovieNameAndYear(ctx context.Context, fileName string, llm LLMConfig) (string, string, error) {
 	prompt := `
 	I need you to provide the corrected movie name that could be scraped by IMDb/TMDb and year if it's present or known.
 	The movie name may appear in Russian transliterated to latin form - in this case transliterate it to Russian/cyrillic.
@@ -154,7 +93,7 @@ func promptAiForMovieNameAndYear(fileName string, chatGptToken string) (string,
 	// Create a cache key based on request type and movie name
 	cacheKey := "movieNameAndYear-" + ReplaceInvalidFilenameChars(fileName)
 
-	response, err := promptAI(prompt, chatGptToken, cacheKey)
+	response, err := promptAI(ctx, prompt, llm, cacheKey)
 	if err != nil {
 		return "", "", err
 	}
@@ -174,7 +113,7 @@ func promptAiForMovieNameAndYear(fileName string, chatGptToken string) (string,
 	return movieInfo.Title, movieInfo.Year, nil
 }
 
-func promptAiForCorrectedYoLetterUsage(fileName string, chatGptToken string) (string, error) {
+func promptAiForCorrectedYoLetterUsage(ctx context.Context, fileName string, llm LLMConfig) (string, error) {
 	prompt := `
 	Provide the movie name in original Cyrillic/Russian encoding but with correct usage of the letter 'ё' where 'е' is used instead of it.
 	If there is no letter 'е' to 'ё' conversion needed, leave the original name intact. Don't modify other letters.
@@ -188,7 +127,7 @@ func promptAiForCorrectedYoLetterUsage(fileName string, chatGptToken string) (st
 	// Create a cache key based on request type and movie name
 	cacheKey := "correctYoUsage-" + ReplaceInvalidFilenameChars(fileName)
 
-	response, err := promptAI(prompt, chatGptToken, cacheKey)
+	response, err := promptAI(ctx, prompt, llm, cacheKey)
 	if err != nil {
 		return "", err
 	}
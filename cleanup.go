@@ -0,0 +1,409 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// CleanupConfig controls removal of orphaned output items
+type CleanupConfig struct {
+	// removed items are moved to dated folders here, `.trash` in every output directory by default;
+	// it must be on the filesystem of the output directories
+	TrashDir Path `json:"trash_dir,omitempty"`
+	// cleanup of an output directory is skipped when more of its items would be removed, 25% by default
+	MaxRemovePercent float64 `json:"max_remove_percent,omitempty"`
+	// set by the `-force-cleanup` flag to confirm removal above the threshold
+	Force bool `json:"-"`
+}
+
+const trashDirName = ".trash"
+const trashManifestName = "restore.jsonl"
+const trashFolderDateFormat = "2006-01-02_150405"
+
+func (c CleanupConfig) maxRemovePercent() float64 {
+	if c.MaxRemovePercent <= 0 {
+		return 25
+	}
+	return c.MaxRemovePercent
+}
+
+// validateTrashDir checks items of every output directory can be renamed into the trash dir, they are never copied
+func (c CleanupConfig) validateTrashDir(output OutputConfig) error {
+	if c.TrashDir == "" {
+		return nil
+	}
+	for _, outputDir := range append(append([]OutputDir(nil), output.Movies...), output.Series...) {
+		if !sameFilesystem(outputDir.Path, c.TrashDir) {
+			return fmt.Errorf("trash dir %s must be on the filesystem of output directory %s", c.TrashDir, outputDir.Path)
+		}
+	}
+	return nil
+}
+
+// trashFolder returns the dated folder removed items of the output directory are moved to
+func (c CleanupConfig) trashFolder(output OutputDir, started time.Time) Path {
+	folder := started.Format(trashFolderDateFormat)
+	if c.TrashDir != "" {
+		return c.TrashDir.appendingPathComponent(folder)
+	}
+	return output.Path.appendingPathComponent(trashDirName).appendingPathComponent(folder)
+}
+
+// trashedItem is a line of the trash folder manifest used by `restore`
+type trashedItem struct {
+	Path    Path   `json:"path"`
+	Trashed Path   `json:"trashed"`
+	Sources []Path `json:"sources,omitempty"`
+}
+
+// remove orphaned output items against existingItems, moving them to the trash
+func cleanupOrphanedItems(config Config, index *OutputIndex, existingItems map[string]bool) error {
+	started := time.Now()
+	for idx, outputDirs := range [][]OutputDir{config.Output.Movies, config.Output.Series} {
+		depth := 1
+		for _, output := range outputDirs {
+			if idx == 0 {
+				depth = output.movieItemDepth()
+			}
+			contents, err := listOutputItems(output.Path, depth)
+			if err != nil {
+				return err
+			}
+
+			var orphans []trashedItem
+			for _, path := range contents {
+				if _, ok := existingItems[strings.ToLower(string(path))]; ok {
+					continue
+				}
+				if orphaned, sources := isOrphanedOutputItem(path, output, config, index, existingItems); orphaned {
+					orphans = append(orphans, trashedItem{Path: path, Sources: sources})
+				}
+			}
+			// items may have been marked existing after being checked, e.g. artwork of an unavailable video
+			var confirmedOrphans []trashedItem
+			for _, orphan := range orphans {
+				if _, ok := existingItems[strings.ToLower(string(orphan.Path))]; !ok {
+					confirmedOrphans = append(confirmedOrphans, orphan)
+				}
+			}
+			if len(confirmedOrphans) == 0 {
+				continue
+			}
+
+			// the share is of videos and item folders, NFO and artwork files next to flat videos don't count
+			itemCount := countMediaItems(contents)
+			orphanCount := countMediaItems(mapSlice(confirmedOrphans, func(orphan trashedItem) Path { return orphan.Path }))
+			percent := 0.0
+			if itemCount > 0 {
+				percent = float64(orphanCount) * 100 / float64(itemCount)
+			}
+			if percent > config.Cleanup.maxRemovePercent() && !config.Cleanup.Force {
+				Logf("❌ cleanup of %s aborted: %d of %d items (%.0f%%) would be removed, the limit is %.0f%%; check the source disks are mounted and run with -force-cleanup to confirm\n",
+					output.Path, orphanCount, itemCount, percent, config.Cleanup.maxRemovePercent())
+				continue
+			}
+
+			trashFolder := config.Cleanup.trashFolder(output, started)
+			for _, orphan := range confirmedOrphans {
+				Log("🪓 removing orphaned item", orphan.Path, "to", trashFolder)
+				if err := moveToTrash(orphan, output, trashFolder, config.Cleanup.TrashDir != ""); err != nil {
+					Log("❌", err)
+				} else if err := index.forgetOutputItem(orphan.Path); err != nil {
+					Log("❌", err)
+				}
+				// upper folders of nested naming templates, e.g. `{year}/`, are removed once empty
+				for dir := orphan.Path.removingLastPathComponent(); len(dir) > len(output.Path); dir = dir.removingLastPathComponent() {
+					if os.Remove(string(dir)) != nil {
+						break
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// listOutputItems lists output items of the directory; folders shared by movies of nested naming templates,
+// e.g. `{year}/`, are listed down to the movie folders
+func listOutputItems(dir Path, depth int) ([]Path, error) {
+	contents, err := dir.getDirectoryContents()
+	if err != nil || depth <= 1 {
+		return contents, err
+	}
+	var items []Path
+	for _, path := range contents {
+		if !isSharedOutputFolder(path) {
+			items = append(items, path)
+			continue
+		}
+		nested, err := listOutputItems(path, depth-1)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, nested...)
+	}
+	return items, nil
+}
+
+// countMediaItems counts videos and item folders among output items
+func countMediaItems(paths []Path) int {
+	count := 0
+	for _, path := range paths {
+		if path.isVideoFile() || path.isDirectory() && !strings.HasPrefix(path.lastPathComponent(), ".") {
+			count++
+		}
+	}
+	return count
+}
+
+// isSharedOutputFolder tells an upper folder of a nested naming template from a movie folder having videos or a disc structure
+func isSharedOutputFolder(path Path) bool {
+	if !path.isDirectory() || path.isDiscFolder() {
+		return false
+	}
+	contents, _ := path.getDirectoryContents()
+	for _, item := range contents {
+		if !item.isDirectory() && item.isVideoFile() {
+			return false
+		}
+	}
+	return true
+}
+
+// isOrphanedOutputItem checks an unmatched output item, items of unavailable sources are kept.
+// Items recorded for several sources are orphaned once all of them are gone
+func isOrphanedOutputItem(path Path, output OutputDir, config Config, index *OutputIndex, existingItems map[string]bool) (bool, []Path) {
+	if sources := index.sourcesOfOutputItem(path); len(sources) > 0 {
+		for _, source := range sources {
+			if source.exists() {
+				Log("🚢", path.lastPathComponent(), "made for:", source)
+				return false, sources
+			} else if sourceDir := config.sourceDirectoryForPath(source); sourceDir == "" || !sourceDir.exists() {
+				Log("⏏️", path.lastPathComponent(), "made for an unavailable source:", source)
+				return false, sources
+			}
+		}
+		return true, sources
+	}
+
+	if videoSymlink := path.findRelatedVideoSymlink(); videoSymlink != "" {
+		targetPath, sourceDir, err := config.sourceDirectoryForVideoSymlink(videoSymlink)
+		if err != nil {
+			Log("❌", videoSymlink.lastPathComponent(), "error reading symlink:", err)
+		} else if !sourceDir.exists() {
+			Log("⏏️", videoSymlink.lastPathComponent(), "Symlink points to an unavailable source:", sourceDir)
+			markOutputItemExisting(existingItems, videoSymlink)
+			return false, nil
+		} else {
+			Log("🚢", videoSymlink.lastPathComponent(), "Symlink points to:", targetPath)
+			return false, []Path{targetPath}
+		}
+	}
+
+	if !output.linkMode().isSymlink() {
+		linkedFile := path.findRelatedVideoFile()
+		if linkedFile == "" && !path.isDirectory() {
+			linkedFile = path
+		}
+		// hard links, copies and reflinks are traced back by the identities recorded when linking
+		if source, ok := index.sourceOfLinkedFile(linkedFile); ok {
+			if source.exists() {
+				Log("🚢", linkedFile.lastPathComponent(), "made for:", source)
+			} else if sourceDir := config.sourceDirectoryForPath(source); sourceDir == "" || !sourceDir.exists() {
+				Log("⏏️", linkedFile.lastPathComponent(), "made for an unavailable source:", source)
+			} else {
+				return true, nil
+			}
+			markOutputItemExisting(existingItems, linkedFile)
+			return false, nil
+		}
+		// the source still exists while the file has other hard links
+		if identity, ok := fileIdentity(linkedFile); ok && output.linkMode() == HardlinkMode && identity.Links > 1 {
+			Log("🔗", linkedFile.lastPathComponent(), "is hardlinked to", identity.Links-1, "more files")
+			markOutputItemExisting(existingItems, linkedFile)
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// moveToTrash moves the item keeping its path relative to the output directory and records it in the manifest
+func moveToTrash(item trashedItem, output OutputDir, trashFolder Path, sharedTrash bool) error {
+	relPath, err := filepath.Rel(string(output.Path), string(item.Path))
+	if err != nil {
+		return err
+	}
+	if sharedTrash {
+		// keep items of different output directories apart
+		relPath = filepath.Join(sanitizeFileName(string(output.Path)), relPath)
+	}
+	item.Trashed = trashFolder.appendingPathComponent(relPath)
+	if err := os.MkdirAll(string(item.Trashed.removingLastPathComponent()), 0755); err != nil {
+		return err
+	}
+	// renaming keeps symlinks intact and is cheap; items are never copied across filesystems
+	if err := os.Rename(string(item.Path), string(item.Trashed)); err != nil {
+		return fmt.Errorf("can't move %s to the trash, keeping it: %w", item.Path, err)
+	}
+
+	manifest, err := os.OpenFile(string(trashFolder.appendingPathComponent(trashManifestName)), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer manifest.Close()
+	if err := json.NewEncoder(manifest).Encode(item); err != nil {
+		return err
+	}
+	journal.record(JournalEntry{Action: TrashAction, Path: item.Path, Target: item.Trashed, Sources: item.Sources, From: trashFolder})
+	return nil
+}
+
+// trashFolders lists dated trash folders of all output directories, oldest first
+func trashFolders(config Config) []Path {
+	var roots []Path
+	if config.Cleanup.TrashDir != "" {
+		roots = append(roots, config.Cleanup.TrashDir)
+	} else {
+		for _, outputDirs := range [][]OutputDir{config.Output.Movies, config.Output.Series} {
+			for _, output := range outputDirs {
+				roots = append(roots, output.Path.appendingPathComponent(trashDirName))
+			}
+		}
+	}
+
+	var folders []Path
+	for _, root := range roots {
+		contents, err := root.getDirectoryContents()
+		if err != nil {
+			continue
+		}
+		for _, folder := range contents {
+			if folder.appendingPathComponent(trashManifestName).exists() {
+				folders = append(folders, folder)
+			}
+		}
+	}
+	sort.SliceStable(folders, func(i, j int) bool {
+		return folders[i].lastPathComponent() < folders[j].lastPathComponent()
+	})
+	return folders
+}
+
+// runRestore puts items from the trash folders of a cleanup back; the latest cleanup is restored by default
+func runRestore(config Config, name string) error {
+	folders := trashFolders(config)
+	if len(folders) == 0 {
+		return fmt.Errorf("trash is empty")
+	}
+	if name == "" {
+		name = folders[len(folders)-1].lastPathComponent()
+	}
+
+	index, err := buildOutputIndex(config)
+	if err != nil {
+		return err
+	}
+	defer index.Close()
+
+	restored := 0
+	for _, folder := range folders {
+		if folder.lastPathComponent() != name {
+			continue
+		}
+		items, err := readTrashManifest(folder.appendingPathComponent(trashManifestName))
+		if err != nil {
+			return err
+		}
+		var remaining []trashedItem
+		for _, item := range items {
+			if item.Path.exists() {
+				Log("⚠️", item.Path, "already exists, keeping", item.Trashed, "in the trash")
+				remaining = append(remaining, item)
+				continue
+			}
+			if err := os.MkdirAll(string(item.Path.removingLastPathComponent()), 0755); err != nil {
+				return err
+			}
+			if err := os.Rename(string(item.Trashed), string(item.Path)); err != nil {
+				Log("❌", err)
+				remaining = append(remaining, item)
+				continue
+			}
+			Log("♻️ restored", item.Path)
+			restored++
+			for _, source := range item.Sources {
+				if err := index.recordOutputItem(source, item.Path); err != nil {
+					Log("❌ failed to record output item", item.Path, err)
+				}
+			}
+		}
+		if err := writeTrashManifest(folder, remaining); err != nil {
+			return err
+		}
+	}
+	if restored == 0 {
+		return fmt.Errorf("nothing restored from `%s`", name)
+	}
+	Logf("♻️ restored %d items from %s\n", restored, name)
+	return nil
+}
+
+func readTrashManifest(path Path) ([]trashedItem, error) {
+	file, err := os.Open(string(path))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var items []trashedItem
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var item trashedItem
+		if err := json.Unmarshal(scanner.Bytes(), &item); err != nil {
+			return nil, fmt.Errorf("broken trash manifest %s: %w", path, err)
+		}
+		items = append(items, item)
+	}
+	return items, scanner.Err()
+}
+
+// writeTrashManifest keeps items not restored, the folder is removed when everything is restored
+func writeTrashManifest(folder Path, items []trashedItem) error {
+	if len(items) == 0 {
+		if err := os.Remove(string(folder.appendingPathComponent(trashManifestName))); err != nil {
+			return err
+		}
+		removeEmptyDirectories(folder)
+		return nil
+	}
+	var data []byte
+	for _, item := range items {
+		line, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		data = append(append(data, line...), '\n')
+	}
+	return writeFileAtomically(folder.appendingPathComponent(trashManifestName), data)
+}
+
+// removeEmptyDirectories removes the folder and its subfolders if they contain no files
+func removeEmptyDirectories(folder Path) {
+	entries, err := os.ReadDir(string(folder))
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			removeEmptyDirectories(folder.appendingPathComponent(entry.Name()))
+		}
+	}
+	// fails for non-empty folders
+	os.Remove(string(folder))
+}
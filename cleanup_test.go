@@ -0,0 +1,358 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+// setupCleanupTest links movies from a media directory into a Kodi output directory
+func setupCleanupTest(t *testing.T, movies ...string) (Config, Path) {
+	dir := Path(t.TempDir())
+	mediaDir := dir.appendingPathComponent("media")
+	output := OutputDir{Path: dir.appendingPathComponent("kodi")}
+	for _, path := range []Path{mediaDir, output.Path} {
+		if err := os.MkdirAll(string(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, movie := range movies {
+		source := mediaDir.appendingPathComponent(movie)
+		if err := os.WriteFile(string(source), []byte("video"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := output.linkFile(source, output.Path.appendingPathComponent(movie)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config := Config{Directories: []Path{mediaDir}, Output: OutputConfig{Movies: []OutputDir{output}}}
+	return config, mediaDir
+}
+
+func TestCleanupMovesOrphansToTrash(t *testing.T) {
+	config, mediaDir := setupCleanupTest(t, "A.mkv", "B.mkv", "C.mkv", "D.mkv", "E.mkv")
+	output := config.Output.Movies[0].Path
+	if err := os.Remove(string(mediaDir.appendingPathComponent("B.mkv"))); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cleanupOrphanedItems(config, nil, map[string]bool{}); err != nil {
+		t.Fatal(err)
+	}
+	if output.appendingPathComponent("B.mkv").exists() {
+		t.Fatalf("orphaned item was not removed")
+	}
+	folders := trashFolders(config)
+	if len(folders) != 1 || !folders[0].appendingPathComponent("B.mkv").isSymlink() {
+		t.Fatalf("orphaned item not found in the trash %v", folders)
+	}
+	if contents, _ := output.getDirectoryContents(); len(contents) != 4 {
+		t.Errorf("expected 4 items left, got %v", contents)
+	}
+
+	if err := runRestore(config, ""); err != nil {
+		t.Fatal(err)
+	}
+	if !output.appendingPathComponent("B.mkv").isSymlink() {
+		t.Errorf("item was not restored")
+	}
+	if folders := trashFolders(config); len(folders) != 0 {
+		t.Errorf("trash folder should be removed after restoring, got %v", folders)
+	}
+}
+
+func TestCleanupAbortsAboveThreshold(t *testing.T) {
+	config, mediaDir := setupCleanupTest(t, "A.mkv", "B.mkv", "C.mkv", "D.mkv")
+	output := config.Output.Movies[0].Path
+	for _, movie := range []string{"A.mkv", "B.mkv"} {
+		if err := os.Remove(string(mediaDir.appendingPathComponent(movie))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := cleanupOrphanedItems(config, nil, map[string]bool{}); err != nil {
+		t.Fatal(err)
+	}
+	if contents, _ := output.getDirectoryContents(); len(contents) != 4 {
+		t.Errorf("cleanup of 50%% items should be aborted, got %v", contents)
+	}
+
+	config.Cleanup.Force = true
+	if err := cleanupOrphanedItems(config, nil, map[string]bool{}); err != nil {
+		t.Fatal(err)
+	}
+	if contents, _ := output.getDirectoryContents(); len(contents) != 2 {
+		t.Errorf("forced cleanup should remove orphans, got %v", contents)
+	}
+}
+
+func TestCleanupThresholdCountsVideosOnly(t *testing.T) {
+	config, mediaDir := setupCleanupTest(t, "A.mkv", "B.mkv", "C.mkv", "D.mkv")
+	output := config.Output.Movies[0].Path
+	// sidecars of the remaining movies don't dilute the share of removed movies
+	for _, sidecar := range []string{"C.nfo", "C-poster.jpg", "C-fanart.jpg", "D.nfo", "D-poster.jpg", "D-fanart.jpg"} {
+		if err := os.WriteFile(string(output.appendingPathComponent(sidecar)), []byte("sidecar"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, movie := range []string{"A.mkv", "B.mkv"} {
+		if err := os.Remove(string(mediaDir.appendingPathComponent(movie))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := cleanupOrphanedItems(config, nil, map[string]bool{}); err != nil {
+		t.Fatal(err)
+	}
+	if contents, _ := output.getDirectoryContents(); len(contents) != 10 {
+		t.Errorf("cleanup of 2 of 4 movies should be aborted, got %v", contents)
+	}
+}
+
+func TestCleanupKeepsItemsOfRemainingSources(t *testing.T) {
+	config, mediaDir := setupCleanupTest(t)
+	config.Database = mediaDir.removingLastPathComponent().appendingPathComponent("media.db")
+	config.Cleanup.Force = true
+	output := config.Output.Movies[0].Path
+	show := output.appendingPathComponent("Show (2010)")
+	seasons := []Path{mediaDir.appendingPathComponent("Show.S01.1080p"), mediaDir.appendingPathComponent("Show.S02.1080p")}
+
+	index, err := buildOutputIndex(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for idx, season := range seasons {
+		if err := os.MkdirAll(string(season), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(string(show.appendingPathComponent(fmt.Sprintf("Season %d", idx+1))), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := index.recordOutputItem(season, show); err != nil {
+			t.Fatal(err)
+		}
+	}
+	index.Close()
+
+	// the show folder stays while any of the season torrents is left
+	if err := os.RemoveAll(string(seasons[1])); err != nil {
+		t.Fatal(err)
+	}
+	index, err = buildOutputIndex(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer index.Close()
+	if sources := index.sourcesOfOutputItem(show); len(sources) != 2 {
+		t.Fatalf("expected both seasons recorded, got %v", sources)
+	}
+	if err := cleanupOrphanedItems(config, index, map[string]bool{}); err != nil {
+		t.Fatal(err)
+	}
+	if !show.isDirectory() {
+		t.Fatalf("show folder was removed while a season is left")
+	}
+
+	if err := os.RemoveAll(string(seasons[0])); err != nil {
+		t.Fatal(err)
+	}
+	if err := cleanupOrphanedItems(config, index, map[string]bool{}); err != nil {
+		t.Fatal(err)
+	}
+	if show.exists() {
+		t.Fatalf("orphaned show folder was not removed")
+	}
+	if sources := index.sourcesOfOutputItem(show); len(sources) != 0 {
+		t.Errorf("removed item is still recorded for %v", sources)
+	}
+
+	if err := runRestore(config, ""); err != nil {
+		t.Fatal(err)
+	}
+	if !show.isDirectory() {
+		t.Errorf("show folder was not restored")
+	}
+	restoredIndex, err := buildOutputIndex(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restoredIndex.Close()
+	if sources := restoredIndex.sourcesOfOutputItem(show); len(sources) != 2 {
+		t.Errorf("expected both seasons recorded after restoring, got %v", sources)
+	}
+}
+
+func TestCleanupOfNestedNamingTemplate(t *testing.T) {
+	config, mediaDir := setupCleanupTest(t)
+	config.Cleanup.Force = true
+	output := &config.Output.Movies[0]
+	output.Naming.Movie = "{year}/{title} ({year})/{title} ({year})"
+	yearDir := output.Path.appendingPathComponent("2010")
+	var movies []Path
+	for _, title := range []string{"Inception", "Shutter Island"} {
+		source := mediaDir.appendingPathComponent(title + ".2010.mkv")
+		movie := yearDir.appendingPathComponent(title + " (2010)")
+		if err := os.WriteFile(string(source), []byte("video"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.MkdirAll(string(movie), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := output.linkFile(source, movie.appendingPathComponent(title+" (2010).mkv")); err != nil {
+			t.Fatal(err)
+		}
+		movies = append(movies, movie)
+	}
+	if item := output.outputItemOfFile("2010/Inception (2010)/Inception (2010).mkv", false); item != movies[0] {
+		t.Errorf("unexpected output item %s", item)
+	}
+	if item := output.outputItemOfFile("Inception (2010)/trailers/Inception (2010).mkv", false); item != output.Path.appendingPathComponent("Inception (2010)") {
+		t.Errorf("unexpected output item of an extra %s", item)
+	}
+
+	// only the movie folder of the removed source goes to the trash
+	if err := os.Remove(string(mediaDir.appendingPathComponent("Inception.2010.mkv"))); err != nil {
+		t.Fatal(err)
+	}
+	if err := cleanupOrphanedItems(config, nil, map[string]bool{}); err != nil {
+		t.Fatal(err)
+	}
+	if movies[0].exists() || !movies[1].isDirectory() {
+		t.Fatalf("expected only %s removed", movies[0])
+	}
+
+	// the year folder is removed with its last movie
+	if err := os.Remove(string(mediaDir.appendingPathComponent("Shutter Island.2010.mkv"))); err != nil {
+		t.Fatal(err)
+	}
+	if err := cleanupOrphanedItems(config, nil, map[string]bool{}); err != nil {
+		t.Fatal(err)
+	}
+	if yearDir.exists() {
+		t.Errorf("empty year folder was not removed")
+	}
+}
+
+func TestCleanupKeepsSharedFolderOfRemainingEdition(t *testing.T) {
+	config, mediaDir := setupCleanupTest(t)
+	config.Cleanup.Force = true
+	output := &config.Output.Movies[0]
+	output.Profile = JellyfinProfile
+	index, err := buildOutputIndex(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var folders, sources, links []Path
+	for _, name := range []string{"Blade.Runner.1982.Directors.Cut.1080p.mkv", "Blade.Runner.1982.Theatrical.Cut.1080p.mkv"} {
+		source := mediaDir.appendingPathComponent(name)
+		if err := os.WriteFile(string(source), []byte("video"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		mediaInfo := MediaFilesInfo{Info: MediaInfo{Id: MediaId{id: "78", idType: TMDB}, Title: "Blade Runner", Year: "1982"}, Path: source, VideoFiles: []Path{source}}
+		dir, fileName, item := output.movieLocation(mediaInfo)
+		if err := os.MkdirAll(string(dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+		link := dir.appendingPathComponent(fileName + ".mkv")
+		if err := output.linkFile(source, link); err != nil {
+			t.Fatal(err)
+		}
+		if err := index.recordOutputItem(source, item); err != nil {
+			t.Fatal(err)
+		}
+		folders, sources, links = append(folders, item), append(sources, source), append(links, link)
+	}
+	if folders[0] != folders[1] || links[0] == links[1] {
+		t.Fatalf("editions should share the folder, got %v", folders)
+	}
+
+	// removing the last synced edition keeps the folder of the other one
+	if err := os.Remove(string(sources[1])); err != nil {
+		t.Fatal(err)
+	}
+	if err := cleanupOrphanedItems(config, index, map[string]bool{}); err != nil {
+		t.Fatal(err)
+	}
+	if !links[0].isSymlink() {
+		t.Fatalf("folder of the remaining edition was removed")
+	}
+
+	if err := os.Remove(string(sources[0])); err != nil {
+		t.Fatal(err)
+	}
+	if err := cleanupOrphanedItems(config, index, map[string]bool{}); err != nil {
+		t.Fatal(err)
+	}
+	if folders[0].exists() {
+		t.Errorf("folder of removed editions was not removed")
+	}
+}
+
+func TestCleanupOfCopiesByRecordedIdentities(t *testing.T) {
+	config, mediaDir := setupCleanupTest(t)
+	config.Database = mediaDir.removingLastPathComponent().appendingPathComponent("media.db")
+	config.Cleanup.Force = true
+	output := &config.Output.Movies[0]
+	output.LinkMode = CopyMode
+	source := mediaDir.appendingPathComponent("Heat.1995.1080p.mkv")
+	copied := output.Path.appendingPathComponent("Heat (1995).mkv")
+	if err := os.WriteFile(string(source), []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := output.linkFile(source, copied); err != nil {
+		t.Fatal(err)
+	}
+	index, err := buildOutputIndex(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := index.recordLinkedFiles(source, []LinkedFile{{Source: source, Link: copied, Mode: CopyMode}}); err != nil {
+		t.Fatal(err)
+	}
+	index.Close()
+
+	// copies share neither names nor inodes with their sources
+	index, err = buildOutputIndex(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer index.Close()
+	if items := index.findOutputItems(source, []Path{source}); len(items) != 1 || items[0] != copied {
+		t.Errorf("expected %s, got %v", copied, items)
+	}
+	if err := cleanupOrphanedItems(config, index, map[string]bool{}); err != nil {
+		t.Fatal(err)
+	}
+	if !copied.exists() {
+		t.Fatalf("copy of an existing source was removed")
+	}
+
+	if err := os.Remove(string(source)); err != nil {
+		t.Fatal(err)
+	}
+	if err := cleanupOrphanedItems(config, index, map[string]bool{}); err != nil {
+		t.Fatal(err)
+	}
+	if copied.exists() {
+		t.Errorf("copy of a removed source was not removed")
+	}
+}
+
+func TestTrashDirMustShareFilesystem(t *testing.T) {
+	dir := Path(t.TempDir())
+	output := OutputConfig{Movies: []OutputDir{{Path: dir.appendingPathComponent("kodi")}}}
+	if err := (CleanupConfig{TrashDir: dir.appendingPathComponent("trash")}).validateTrashDir(output); err != nil {
+		t.Errorf("unexpected error for trash dir on the same filesystem: %v", err)
+	}
+	other := Path(os.TempDir())
+	if _, err := os.Stat("/dev/shm"); err == nil {
+		other = "/dev/shm"
+	}
+	if sameFilesystem(dir, other) {
+		t.Skip("no other filesystem to check")
+	}
+	if err := (CleanupConfig{TrashDir: other.appendingPathComponent("trash")}).validateTrashDir(output); err == nil {
+		t.Errorf("expected an error for trash dir on another filesystem")
+	}
+}
@@ -7,8 +7,6 @@ import (
 	"path/filepath"
 	"regexp"
 	"strings"
-
-	"golang.org/x/text/unicode/norm"
 )
 
 // Config represents the configuration structure.
@@ -18,12 +16,33 @@ type Config struct {
 	TMDbApiKey      string `json:"tmdb_api_key,omitempty"`
 	OpenAiApiKey    string `json:"openai_api_key,omitempty"`
 	KinopoiskApiKey string `json:"kinopoisk_api_key,omitempty"`
+	FanartTvApiKey  string `json:"fanarttv_api_key,omitempty"`
+	// model used for title cleanup, OpenAI with `openai_api_key` by default
+	LLM LLMConfig `json:"llm,omitempty"`
+	// ask the LLM to choose between search results scoring close together
+	Disambiguation DisambiguationConfig `json:"disambiguation,omitempty"`
+
+	// release name tags by kind, canonical value and spellings, merged over the defaults
+	ReleaseTags map[string]map[string][]string `json:"release_tags,omitempty"`
+
+	Directories []Path       `json:"directories"`
+	Output      OutputConfig `json:"output"`
+
+	Artwork ArtworkConfig `json:"artwork,omitempty"`
+
+	// SQLite database remembering output items made for source media items
+	Database Path `json:"database,omitempty"`
 
-	Directories []Path `json:"directories"`
-	Output      struct {
-		Movies []Path `json:"movies"`
-		Series []Path `json:"series"`
-	} `json:"output"`
+	Cleanup CleanupConfig `json:"cleanup,omitempty"`
+
+	// number of media items processed at once, 4 by default
+	Concurrency int `json:"concurrency,omitempty"`
+	// request limits per API host, merged over the defaults
+	RateLimits map[string]RateLimit `json:"rate_limits,omitempty"`
+	// timeouts, proxy and retries of HTTP requests
+	HTTP HTTPConfig `json:"http,omitempty"`
+	// response cache TTLs and size limit
+	Cache CacheConfig `json:"cache,omitempty"`
 
 	TMDbMovieGenres []TMDbGenre       `json:"tmdb_movie_genres"`
 	TMDbTvGenres    []TMDbGenre       `json:"tmdb_tv_genres"`
@@ -46,6 +65,13 @@ type TorrentSortingRule struct {
 	Destination   Path `json:"destination,omitempty"`
 }
 
+func (c Config) concurrency() int {
+	if c.Concurrency <= 0 {
+		return 4
+	}
+	return c.Concurrency
+}
+
 // ConfigPath returns the path to the configuration file.
 func ConfigPath(path Path) Path {
 	if path == "" {
@@ -89,36 +115,95 @@ func LoadConfig(configFile Path) (*Config, error) {
 	if config.KinopoiskApiKey == "" {
 		config.KinopoiskApiKey = os.Getenv("KINOPOISK_API_KEY")
 	}
+	if config.FanartTvApiKey == "" {
+		config.FanartTvApiKey = os.Getenv("FANARTTV_API_KEY")
+	}
+	if config.Database == "" {
+		config.Database = configFile.removingLastPathComponent().appendingPathComponent("media.db")
+	}
 	for idx, rule := range config.Transmission.SortingRules {
 		config.Transmission.SortingRules[idx].GenreRegex, err = regexp.Compile(rule.GenreRegexStr)
 		if err != nil {
 			return nil, fmt.Errorf("could not compile regex `%s`: %s", rule.GenreRegexStr, err)
 		}
 	}
+	if err := config.Output.validateMappings(); err != nil {
+		return nil, err
+	}
+	if err := config.Cleanup.validateTrashDir(config.Output); err != nil {
+		return nil, err
+	}
 
 	return &config, nil
 }
 
 func (c Config) sourceDirectoryForVideoSymlink(symlink Path) (Path, Path, error) {
-	target, err := os.Readlink(string(symlink))
+	output := c.outputDirContaining(symlink)
+	targetPath, err := output.readLinkTarget(symlink)
 	if err != nil {
 		return "", "", err
 	}
+	if !output.isSourceNamedLink(symlink, targetPath, findOutputDir(c.Output.Series, output.Path) != nil) {
+		return "", "", fmt.Errorf("symlink valid but filename differs from %s", targetPath.lastPathComponent())
+	}
 
-	targetPath := Path(target)
-	fileName := targetPath.lastPathComponent()
-	if norm.NFC.String(fileName) != norm.NFC.String(symlink.lastPathComponent()) {
-		return "", "", fmt.Errorf("symlink valid but filename differs from %s", fileName)
+	// output file names may differ from the source (e.g. episode prefixes, Jellyfin naming)
+	if path := c.sourceDirectoryForPath(targetPath); path != "" {
+		if path.exists() && !targetPath.exists() {
+			return "", "", fmt.Errorf("file does not exist")
+		}
+		return targetPath, path, nil
 	}
+	return "", "", nil
+}
 
-	targetLower := strings.ToLower(target)
-	for _, path := range c.Directories {
-		if strings.HasPrefix(targetLower, strings.ToLower(strings.TrimSuffix(string(path.appendingPathComponent("a")), "a"))) {
-			if path.exists() && !targetPath.exists() {
-				return "", "", fmt.Errorf("file does not exist")
+// findSuitableOutputDir picks the output directory for a source media item:
+// explicitly mapped for the source directory, or on the same filesystem
+func (c Config) findSuitableOutputDir(path Path, isTvShow bool) OutputDir {
+	directories := c.Output.Movies
+	if isTvShow {
+		directories = c.Output.Series
+	}
+
+	pathLower := strings.ToLower(string(path))
+	for _, mapping := range c.Output.Mappings {
+		output := mapping.Movies
+		if isTvShow {
+			output = mapping.Series
+		}
+		sourcePrefix := strings.ToLower(strings.TrimSuffix(string(mapping.Source.appendingPathComponent("a")), "a"))
+		if output == "" || !strings.HasPrefix(pathLower, sourcePrefix) {
+			continue
+		}
+		// mapped outputs are validated to be configured output directories
+		if directory := findOutputDir(directories, output); directory != nil {
+			return *directory
+		}
+	}
+
+	return findSuitableDirectoryForSymlink(path, directories)
+}
+
+// outputDirContaining returns the configured output directory the path is in
+func (c Config) outputDirContaining(path Path) OutputDir {
+	pathLower := strings.ToLower(string(path))
+	for _, directories := range [][]OutputDir{c.Output.Movies, c.Output.Series} {
+		for _, directory := range directories {
+			if strings.HasPrefix(pathLower, strings.ToLower(strings.TrimSuffix(string(directory.Path.appendingPathComponent("a")), "a"))) {
+				return directory
 			}
-			return targetPath, path, nil
 		}
 	}
-	return "", "", nil
+	return OutputDir{}
+}
+
+// sourceDirectoryForPath returns the configured media directory containing the path
+func (c Config) sourceDirectoryForPath(sourcePath Path) Path {
+	sourceLower := strings.ToLower(string(sourcePath))
+	for _, path := range c.Directories {
+		if strings.HasPrefix(sourceLower, strings.ToLower(strings.TrimSuffix(string(path.appendingPathComponent("a")), "a"))) {
+			return path
+		}
+	}
+	return ""
 }
@@ -2,6 +2,11 @@ package main
 
 import (
 	"database/sql"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	_ "github.com/mattn/go-sqlite3"
 )
@@ -17,6 +22,9 @@ func initializeDB(dbPath string) (*sql.DB, error) {
 		return nil, err
 	}
 
+	// a single connection serializes writes of concurrent workers instead of failing with "database is locked"
+	db.SetMaxOpenConns(1)
+
 	// Ensure the necessary tables are created
 	err = createSQLiteTables(db)
 	if err != nil {
@@ -38,21 +46,248 @@ func createSQLiteTables(db *sql.DB) error {
 		return err
 	}
 
-	// Create files table
+	// Create files table: source files (relative to the entity path) placed into output dirs
 	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS files (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
 		entityId INTEGER,
 		relativePath TEXT COLLATE NOCASE,
 		linkPath TEXT COLLATE NOCASE NOT NULL,
+		linkMode TEXT,
+		device INTEGER,
+		inode INTEGER,
 		FOREIGN KEY (entityId) REFERENCES mediaEntities(id)
 	);`)
 	if err != nil {
 		return err
 	}
 
+	// Create outputItems table: top-level output items (movie file or folder, TV Show folder) of media entities,
+	// an item shared by several entities, e.g. a TV Show folder of season torrents, has a row per entity
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS outputItems (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		entityId INTEGER NOT NULL,
+		path TEXT NOT NULL COLLATE NOCASE,
+		FOREIGN KEY (entityId) REFERENCES mediaEntities(id),
+		CONSTRAINT idx_entity_path UNIQUE (entityId, path)
+	);`)
+	if err != nil {
+		return err
+	}
+	if err := migrateOutputItems(db); err != nil {
+		return err
+	}
+
+	// Create llmUsage table: tokens used by prompts per run and media item
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS llmUsage (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		runId TEXT,
+		path TEXT COLLATE NOCASE,
+		backend TEXT,
+		model TEXT,
+		promptTokens INTEGER,
+		completionTokens INTEGER,
+		cost REAL,
+		time TEXT
+	);`)
+	if err != nil {
+		return err
+	}
+
+	// Create llmDecisions table: the LLM's choices between close candidates, kept for review
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS llmDecisions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		path TEXT NOT NULL COLLATE NOCASE,
+		query TEXT,
+		candidates TEXT,
+		chosen TEXT,
+		reasoning TEXT,
+		time TEXT
+	);`)
+	if err != nil {
+		return err
+	}
+
 	return nil
 }
 
+type LLMUsageRecord struct {
+	RunId            string
+	Path             Path
+	Backend          string
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+	Cost             float64
+	Time             time.Time
+}
+
+func insertLLMUsage(db *sql.DB, record LLMUsageRecord) error {
+	_, err := db.Exec("INSERT INTO llmUsage (runId, path, backend, model, promptTokens, completionTokens, cost, time) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		record.RunId, string(record.Path), record.Backend, record.Model, record.PromptTokens, record.CompletionTokens, record.Cost, record.Time.UTC().Format(time.RFC3339))
+	return err
+}
+
+// sumLLMTokensSince returns prompt and completion tokens used since the time
+func sumLLMTokensSince(db *sql.DB, since time.Time) (int, error) {
+	var tokens int
+	err := db.QueryRow("SELECT IFNULL(SUM(promptTokens + completionTokens), 0) FROM llmUsage WHERE time >= ?", since.UTC().Format(time.RFC3339)).Scan(&tokens)
+	return tokens, err
+}
+
+func insertLLMDecision(db *sql.DB, decision LLMDecision) error {
+	candidates, err := json.Marshal(decision.Candidates)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("INSERT INTO llmDecisions (path, query, candidates, chosen, reasoning, time) VALUES (?, ?, ?, ?, ?, ?)",
+		string(decision.Path), decision.Query, string(candidates), decision.Chosen, decision.Reasoning, decision.Time.Format(time.RFC3339))
+	return err
+}
+
+// loadLLMDecisions returns recorded decisions, the latest first
+func loadLLMDecisions(db *sql.DB) ([]LLMDecision, error) {
+	rows, err := db.Query("SELECT path, IFNULL(query, ''), IFNULL(candidates, ''), IFNULL(chosen, ''), IFNULL(reasoning, ''), IFNULL(time, '') FROM llmDecisions ORDER BY id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var decisions []LLMDecision
+	for rows.Next() {
+		var decision LLMDecision
+		var path, candidates, decisionTime string
+		if err := rows.Scan(&path, &decision.Query, &candidates, &decision.Chosen, &decision.Reasoning, &decisionTime); err != nil {
+			return nil, err
+		}
+		decision.Path = Path(path)
+		if candidates != "" {
+			if err := json.Unmarshal([]byte(candidates), &decision.Candidates); err != nil {
+				return nil, err
+			}
+		}
+		decision.Time, _ = time.Parse(time.RFC3339, decisionTime)
+		decisions = append(decisions, decision)
+	}
+	return decisions, rows.Err()
+}
+
+// migrateOutputItems recreates the outputItems table of older databases where an item had a single entity
+func migrateOutputItems(db *sql.DB) error {
+	var schema string
+	if err := db.QueryRow("SELECT sql FROM sqlite_master WHERE type = 'table' AND name = 'outputItems'").Scan(&schema); err != nil {
+		return err
+	}
+	if strings.Contains(schema, "idx_entity_path") {
+		return nil
+	}
+	Log("migrating output items to multiple sources")
+	for _, statement := range []string{
+		"ALTER TABLE outputItems RENAME TO outputItemsOld",
+		`CREATE TABLE outputItems (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			entityId INTEGER NOT NULL,
+			path TEXT NOT NULL COLLATE NOCASE,
+			FOREIGN KEY (entityId) REFERENCES mediaEntities(id),
+			CONSTRAINT idx_entity_path UNIQUE (entityId, path)
+		);`,
+		"INSERT INTO outputItems (entityId, path) SELECT entityId, path FROM outputItemsOld",
+		"DROP TABLE outputItemsOld",
+	} {
+		if _, err := db.Exec(statement); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func insertOutputItem(db *sql.DB, entityId int64, outputPath string) error {
+	_, err := db.Exec("INSERT OR IGNORE INTO outputItems (entityId, path) VALUES (?, ?)", entityId, outputPath)
+	return err
+}
+
+// deleteOutputItem removes the output item with all its source entities
+func deleteOutputItem(db *sql.DB, outputPath string) error {
+	_, err := db.Exec("DELETE FROM outputItems WHERE path = ?", outputPath)
+	return err
+}
+
+// deleteOutputItemSource removes a single source entity of the output item
+func deleteOutputItemSource(db *sql.DB, sourcePath string, outputPath string) error {
+	_, err := db.Exec("DELETE FROM outputItems WHERE path = ? AND entityId IN (SELECT id FROM mediaEntities WHERE path = ?)", outputPath, sourcePath)
+	return err
+}
+
+// loadOutputItems returns output item paths mapped to their source media entity paths
+func loadOutputItems(db *sql.DB) (map[string][]string, error) {
+	rows, err := db.Query("SELECT outputItems.path, mediaEntities.path FROM outputItems JOIN mediaEntities ON mediaEntities.id = outputItems.entityId ORDER BY outputItems.id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make(map[string][]string)
+	for rows.Next() {
+		var outputPath, sourcePath string
+		if err := rows.Scan(&outputPath, &sourcePath); err != nil {
+			return nil, err
+		}
+		items[outputPath] = append(items[outputPath], sourcePath)
+	}
+	return items, rows.Err()
+}
+
+type LinkedFileRecord struct {
+	SourcePath string
+	LinkPath   string
+	LinkMode   string
+	Device     uint64
+	Inode      uint64
+}
+
+func insertLinkedFile(db *sql.DB, entityId int64, relativePath string, record LinkedFileRecord) error {
+	_, err := db.Exec("DELETE FROM files WHERE linkPath = ?", record.LinkPath)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("INSERT INTO files (entityId, relativePath, linkPath, linkMode, device, inode) VALUES (?, ?, ?, ?, ?, ?)",
+		entityId, relativePath, record.LinkPath, record.LinkMode, int64(record.Device), int64(record.Inode))
+	return err
+}
+
+// loadLinkedFiles returns files placed into output dirs with their absolute source paths
+func loadLinkedFiles(db *sql.DB) ([]LinkedFileRecord, error) {
+	rows, err := db.Query(`SELECT mediaEntities.path, files.relativePath, files.linkPath, IFNULL(files.linkMode, ''), IFNULL(files.device, 0), IFNULL(files.inode, 0)
+		FROM files JOIN mediaEntities ON mediaEntities.id = files.entityId`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []LinkedFileRecord
+	for rows.Next() {
+		var entityPath, relativePath string
+		var device, inode int64
+		var record LinkedFileRecord
+		if err := rows.Scan(&entityPath, &relativePath, &record.LinkPath, &record.LinkMode, &device, &inode); err != nil {
+			return nil, err
+		}
+		record.SourcePath = entityPath
+		if relativePath != "" {
+			record.SourcePath = filepath.Join(entityPath, relativePath)
+		}
+		record.Device, record.Inode = uint64(device), uint64(inode)
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// deleteLinkedFiles removes records of files inside the output item
+func deleteLinkedFiles(db *sql.DB, outputPath string) error {
+	prefix := strings.TrimSuffix(filepath.Join(outputPath, "a"), "a")
+	_, err := db.Exec("DELETE FROM files WHERE linkPath = ? OR substr(linkPath, 1, ?) = ? COLLATE NOCASE", outputPath, utf8.RuneCountInString(prefix), prefix)
+	return err
+}
+
 func insertMediaEntity(db *sql.DB, filePath string) (int64, error) {
 	var lastInsertID int64
 	err := db.QueryRow("INSERT OR IGNORE INTO mediaEntities (path) VALUES (?) RETURNING id", filePath).Scan(&lastInsertID)
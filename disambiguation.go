@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DisambiguationConfig enables asking the LLM to choose between search results scoring close together
+type DisambiguationConfig struct {
+	Enabled bool `json:"enabled,omitempty"`
+	// best candidates across TMDb, IMDb and Kinopoisk sent to the LLM, 5 by default
+	Candidates int `json:"candidates,omitempty"`
+	// candidates scoring within this many points of the best one are close, 10 by default
+	ScoreMargin int `json:"score_margin,omitempty"`
+}
+
+func (c DisambiguationConfig) candidates() int {
+	if c.Candidates <= 1 {
+		return 5
+	}
+	return c.Candidates
+}
+
+func (c DisambiguationConfig) scoreMargin() int {
+	if c.ScoreMargin <= 0 {
+		return 10
+	}
+	return c.ScoreMargin
+}
+
+// DecisionCandidate is a candidate as shown to the LLM and stored for review
+type DecisionCandidate struct {
+	Id            string `json:"id"`
+	Title         string `json:"title"`
+	OriginalTitle string `json:"original_title,omitempty"`
+	Year          string `json:"year,omitempty"`
+	IsTvShow      bool   `json:"is_tv_show,omitempty"`
+	Score         int    `json:"score"`
+}
+
+// LLMDecision is the LLM's choice between close candidates for a media item
+type LLMDecision struct {
+	Path       Path
+	Query      string
+	Candidates []DecisionCandidate
+	// id of the chosen candidate, empty if all were rejected
+	Chosen    string
+	Reasoning string
+	Time      time.Time
+}
+
+// LLMRejectedError is returned when the LLM rejected all candidates, the item is skipped
+type LLMRejectedError struct {
+	Decision *LLMDecision
+}
+
+func (e *LLMRejectedError) Error() string {
+	return fmt.Sprintf("no candidate for '%s' was accepted by the LLM: %s", e.Decision.Query, e.Decision.Reasoning)
+}
+
+func mediaIdString(id MediaId) string {
+	return id.getType() + ":" + id.id
+}
+
+// disambiguateMatch asks the LLM to choose between the match and other candidates scoring close to it,
+// the match is kept if disambiguation is disabled, candidates aren't close or the LLM fails
+func disambiguateMatch(ctx context.Context, path Path, torrentTitle string, title string, year string, match MediaInfo, score int, config Config) (MediaInfo, int, *LLMDecision, error) {
+	if !config.Disambiguation.Enabled {
+		return match, score, nil, nil
+	}
+	candidates := collectCandidates(ctx, title, year, match.IsTvShow, config)
+	candidates = includeCandidate(candidates, ScoredMediaInfo{Info: match, Score: score})
+	if len(candidates) > config.Disambiguation.candidates() {
+		candidates = candidates[:config.Disambiguation.candidates()]
+	}
+	if len(candidates) < 2 || candidates[0].Score-candidates[1].Score > config.Disambiguation.scoreMargin() {
+		return match, score, nil, nil
+	}
+
+	Log("🤔 asking the LLM to choose between", len(candidates), "candidates for", title)
+	decision, chosen, err := promptAiForBestCandidate(ctx, path, torrentTitle, title, candidates, config.llm())
+	if err != nil {
+		logAIError(err)
+		return match, score, nil, nil
+	}
+	if chosen == nil {
+		Log("🙅 LLM rejected all candidates:", decision.Reasoning)
+		return MediaInfo{}, 0, decision, &LLMRejectedError{Decision: decision}
+	}
+	Log("🤖 LLM chose", chosen.Info.Title, chosen.Info.Year, "–", decision.Reasoning)
+	if chosen.Info.Id == match.Id {
+		return match, score, decision, nil
+	}
+	return loadCandidateDetails(ctx, chosen.Info, config), chosen.Score, decision, nil
+}
+
+// collectCandidates searches all providers, candidates with the same title and year are merged keeping the best score
+func collectCandidates(ctx context.Context, title string, year string, isTvShow bool, config Config) []ScoredMediaInfo {
+	lang := "en-US"
+	if containsCyrillicCharacters(title) {
+		lang = "ru-RU"
+	}
+	var candidates []ScoredMediaInfo
+	tmdbApi := TMDbAPI{ApiKey: config.TMDbApiKey, Language: lang, TVShowSearch: isTvShow, MovieGenres: config.TMDbMovieGenres, TvGenres: config.TMDbTvGenres}
+	if found, err := findMovieCandidates(ctx, tmdbApi, title, year); err == nil {
+		candidates = append(candidates, found...)
+	} else {
+		Log("TMDB candidates err", err)
+	}
+	if found, err := findMovieCandidates(ctx, IMDbAPI{GenresMap: config.GenresMap}, title, year); err == nil {
+		candidates = append(candidates, found...)
+	} else {
+		Log("IMDB candidates err", err)
+	}
+	if config.KinopoiskApiKey != "" {
+		kpApi := KinopoiskAPI{ApiKey: config.KinopoiskApiKey, TvShowsOnly: isTvShow, GenresMap: config.GenresMap}
+		if found, err := findMovieCandidates(ctx, kpApi, title, year); err == nil {
+			candidates = append(candidates, found...)
+		} else {
+			Log("Kinopoisk candidates err", err)
+		}
+	}
+
+	var merged []ScoredMediaInfo
+	for _, candidate := range candidates {
+		merged = includeCandidate(merged, candidate)
+	}
+	return merged
+}
+
+// includeCandidate adds the candidate unless the same title and year is present with a higher score, keeps the best first order
+func includeCandidate(candidates []ScoredMediaInfo, candidate ScoredMediaInfo) []ScoredMediaInfo {
+	key := candidateKey(candidate.Info)
+	for idx, existing := range candidates {
+		if (existing.Info.Id.id != "" && existing.Info.Id == candidate.Info.Id) || candidateKey(existing.Info) == key {
+			if existing.Score >= candidate.Score {
+				return candidates
+			}
+			candidates = append(candidates[:idx], candidates[idx+1:]...)
+			break
+		}
+	}
+	candidates = append(candidates, candidate)
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Score > candidates[j].Score
+	})
+	return candidates
+}
+
+func candidateKey(info MediaInfo) string {
+	return strings.ToLower(Coalesce(info.OriginalTitle, info.Title)) + "|" + info.Year
+}
+
+// loadCandidateDetails loads full info of a chosen search result
+func loadCandidateDetails(ctx context.Context, info MediaInfo, config Config) MediaInfo {
+	tmdbApi := TMDbAPI{ApiKey: config.TMDbApiKey, MovieGenres: config.TMDbMovieGenres, TvGenres: config.TMDbTvGenres}
+	var details MediaInfo
+	var err error
+	switch info.Id.idType {
+	case TMDB:
+		if info.IsTvShow {
+			details, err = tmdbApi.LoadSeriesMediaInfo(ctx, info.Id.id)
+		} else {
+			details, err = tmdbApi.LoadMovieDetails(ctx, info.Id.id)
+		}
+	case IMDB:
+		details, err = IMDbAPI{GenresMap: config.GenresMap}.LoadMediaInfo(ctx, info.Id.id, tmdbApi)
+	case KPID:
+		kpApi := KinopoiskAPI{ApiKey: config.KinopoiskApiKey, TvShowsOnly: info.IsTvShow, GenresMap: config.GenresMap}
+		details, err = kpApi.LoadMovieDetails(ctx, info.Id.id)
+		if err == nil && details.Id.idType != KPID {
+			// Kinopoisk knows the TMDb or IMDb id by now, their details are fuller
+			return loadCandidateDetails(ctx, details, config)
+		}
+	default:
+		return info
+	}
+	if err != nil {
+		Log("error:", err)
+		return info
+	}
+	return details
+}
+
+// folderContents lists up to 20 file names of the media item
+func folderContents(path Path) []string {
+	if !path.isDirectory() {
+		return []string{path.lastPathComponent()}
+	}
+	files, err := path.getDirectoryContentsRecursively()
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, file := range files {
+		if len(names) == 20 {
+			names = append(names, "…")
+			break
+		}
+		if rel, err := filepath.Rel(string(path), string(file)); err == nil && !file.isDirectory() {
+			names = append(names, rel)
+		}
+	}
+	return names
+}
+
+func promptAiForBestCandidate(ctx context.Context, path Path, torrentTitle string, title string, candidates []ScoredMediaInfo, llm LLMConfig) (*LLMDecision, *ScoredMediaInfo, error) {
+	var list strings.Builder
+	decision := &LLMDecision{Path: path, Query: title, Time: time.Now()}
+	for idx, candidate := range candidates {
+		info := candidate.Info
+		kind := "movie"
+		if info.IsTvShow {
+			kind = "tv show"
+		}
+		overview := []rune(info.Description)
+		if len(overview) > 300 {
+			overview = append(overview[:300], '…')
+		}
+		fmt.Fprintf(&list, "\t%d. %s / %s (%s), %s, %s: %s\n", idx+1, info.Title, info.OriginalTitle, info.Year, kind, mediaIdString(info.Id), string(overview))
+		decision.Candidates = append(decision.Candidates, DecisionCandidate{
+			Id:            mediaIdString(info.Id),
+			Title:         info.Title,
+			OriginalTitle: info.OriginalTitle,
+			Year:          info.Year,
+			IsTvShow:      info.IsTvShow,
+			Score:         candidate.Score,
+		})
+	}
+	files, _ := json.Marshal(folderContents(path))
+
+	prompt := `
+	I need you to choose the movie or TV show database entry matching the media files, or reject all entries if none of them matches.
+	Consider the year, the original title and the number of episodes.
+	Answer in json format: {
+		"choice": 1, // number of the matching entry or null if none matches
+		"reasoning": "short explanation of the choice"
+	}
+	file name: "` + path.lastPathComponent() + `"
+	files: ` + string(files) + `
+	torrent title: "` + torrentTitle + `"
+	entries:
+` + list.String()
+
+	// the candidates are part of the prompt, a different set of candidates is a different question
+	hash := sha256.Sum256([]byte(prompt))
+	cacheKey := "chooseCandidate-" + ReplaceInvalidFilenameChars(path.lastPathComponent()) + "-" + hex.EncodeToString(hash[:8])
+
+	// the reasoning needs a longer answer than a title
+	llm.MaxTokens = max(llm.MaxTokens, 300)
+	response, err := promptAI(ctx, prompt, llm, cacheKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var answer struct {
+		Choice    *int   `json:"choice"`
+		Reasoning string `json:"reasoning"`
+	}
+	if err := json.Unmarshal([]byte(response.Choices[0].Message.Content), &answer); err != nil {
+		return nil, nil, err
+	}
+	decision.Reasoning = answer.Reasoning
+	if answer.Choice == nil {
+		return decision, nil, nil
+	}
+	if *answer.Choice < 1 || *answer.Choice > len(candidates) {
+		return nil, nil, fmt.Errorf("LLM chose a missing candidate %d", *answer.Choice)
+	}
+	chosen := candidates[*answer.Choice-1]
+	decision.Chosen = mediaIdString(chosen.Info.Id)
+	return decision, &chosen, nil
+}
+
+// runDecisionsCommand lists recorded LLM decisions for review
+func runDecisionsCommand(config Config) error {
+	if config.Database == "" {
+		return fmt.Errorf("decisions are recorded in the database, set `database` in the config")
+	}
+	db, err := initializeDB(string(config.Database))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	decisions, err := loadLLMDecisions(db)
+	if err != nil {
+		return err
+	}
+	for _, decision := range decisions {
+		Logf("%s %s\n", decision.Time.Format("2006-01-02 15:04"), decision.Path)
+		for _, candidate := range decision.Candidates {
+			mark := " "
+			if candidate.Id == decision.Chosen {
+				mark = "✓"
+			}
+			Logf("  %s %3d %-16s %s / %s (%s)\n", mark, candidate.Score, candidate.Id, candidate.Title, candidate.OriginalTitle, candidate.Year)
+		}
+		if decision.Chosen == "" {
+			Logf("  rejected: %s\n", decision.Reasoning)
+		} else {
+			Logf("  %s\n", decision.Reasoning)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLLMChoosesBetweenCloseCandidates(t *testing.T) {
+	originalCacheDir := CacheDir
+	defer func() { CacheDir = originalCacheDir }()
+	CacheDir = t.TempDir()
+
+	var candidates []ScoredMediaInfo
+	for _, candidate := range []ScoredMediaInfo{
+		{Info: MediaInfo{Id: MediaId{"10", TMDB}, Title: "Солярис", OriginalTitle: "Solaris", Year: "2002"}, Score: 88},
+		{Info: MediaInfo{Id: MediaId{"593", TMDB}, Title: "Солярис", OriginalTitle: "Солярис", Year: "1972"}, Score: 85},
+		// the same movie found on IMDb with a lower score is merged
+		{Info: MediaInfo{Id: MediaId{"tt0069293", IMDB}, Title: "Солярис", OriginalTitle: "Солярис", Year: "1972"}, Score: 80},
+	} {
+		candidates = includeCandidate(candidates, candidate)
+	}
+	if len(candidates) != 2 || candidates[0].Info.Id.id != "10" {
+		t.Fatalf("unexpected merged candidates %v", candidates)
+	}
+
+	answer := `{"choice": 2, "reasoning": "the folder name is in Russian and the files are from 1972"}`
+	openAI := newFakeOpenAI(t, func(prompt string) string { return answer })
+	llm := Config{OpenAiApiKey: "test-openai-key", LLM: LLMConfig{BaseURL: openAI.server.URL + "/v1"}}.llm()
+	path := Path(t.TempDir()).appendingPathComponent("Solaris.1972.BDRip")
+
+	decision, chosen, err := promptAiForBestCandidate(context.Background(), path, "Солярис (Андрей Тарковский) [1972, BDRip]", "Solaris", candidates, llm)
+	if err != nil || chosen == nil || chosen.Info.Id.id != "593" || decision.Chosen != "tmdb:593" {
+		t.Fatalf("unexpected choice %v %v %v", decision, chosen, err)
+	}
+	if prompt := openAI.prompts[0]; !strings.Contains(prompt, "[1972, BDRip]") || !strings.Contains(prompt, "2. Солярис / Солярис (1972)") {
+		t.Errorf("torrent title or candidates missing in prompt:\n%s", prompt)
+	}
+
+	answer = `{"choice": null, "reasoning": "none of the entries is a 1968 movie"}`
+	decision, chosen, err = promptAiForBestCandidate(context.Background(), path.appendingPathExtension("1968"), "", "Solaris", candidates, llm)
+	if err != nil || chosen != nil || decision.Chosen != "" {
+		t.Fatalf("expected a rejection, got %v %v %v", decision, chosen, err)
+	}
+
+	// decisions are kept in the database for review
+	db, err := initializeDB(filepath.Join(t.TempDir(), "media.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if err := insertLLMDecision(db, *decision); err != nil {
+		t.Fatal(err)
+	}
+	decisions, err := loadLLMDecisions(db)
+	if err != nil || len(decisions) != 1 || decisions[0].Reasoning != decision.Reasoning || len(decisions[0].Candidates) != 2 {
+		t.Errorf("unexpected recorded decisions %v %v", decisions, err)
+	}
+}
+
+func TestKinopoiskCandidateDetails(t *testing.T) {
+	originalCacheDir, originalClient := CacheDir, httpClient
+	defer func() { CacheDir, httpClient = originalCacheDir, originalClient }()
+	CacheDir = t.TempDir()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1.4/movie/43395":
+			w.Write([]byte(`{"id": 43395, "name": "Солярис", "type": "movie", "year": 1972, "externalId": {"tmdb": 593}}`))
+		case "/v1.4/movie/1":
+			w.Write([]byte(`{"id": 1, "name": "Солярис", "type": "movie", "year": 1968, "description": "Телеспектакль"}`))
+		case "/3/movie/593":
+			w.Write([]byte(`{"id": 593, "title": "Солярис", "original_title": "Солярис", "release_date": "1972-03-20", "runtime": 167}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	httpClient = newHTTPClient(HTTPConfig{})
+	httpClient.client.Transport = redirectTransport{server}
+	config := Config{TMDbApiKey: "key", KinopoiskApiKey: "key"}
+
+	// TMDb details are loaded once Kinopoisk tells the id
+	details := loadCandidateDetails(context.Background(), MediaInfo{Id: MediaId{"43395", KPID}, Title: "Солярис", Year: "1972"}, config)
+	if details.Id != (MediaId{"593", TMDB}) || details.Runtime != 167 {
+		t.Errorf("unexpected details %+v", details)
+	}
+	details = loadCandidateDetails(context.Background(), MediaInfo{Id: MediaId{"1", KPID}, Title: "Солярис"}, config)
+	if details.Id != (MediaId{"1", KPID}) || details.Description != "Телеспектакль" || details.Year != "1968" {
+		t.Errorf("unexpected Kinopoisk details %+v", details)
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// folders of a disc structure linked into the movie folder
+var discStructureFolders = []string{"BDMV", "CERTIFICATE", "VIDEO_TS", "AUDIO_TS"}
+
+// BlurayTitle is a playlist of a Blu-ray disc with its stream files
+type BlurayTitle struct {
+	Playlist Path
+	Duration time.Duration
+	Streams  []Path
+	Size     int64
+}
+
+// isBlurayFolder tells whether the folder contains a Blu-ray disc structure
+func (p Path) isBlurayFolder() bool {
+	bdmv := p.appendingPathComponent("BDMV")
+	return bdmv.isDirectory() && bdmv.appendingPathComponent("index.bdmv").exists()
+}
+
+// isDiscFolder tells whether the folder contains a DVD or Blu-ray disc structure
+func (p Path) isDiscFolder() bool {
+	return p.appendingPathComponent("VIDEO_TS").isDirectory() || p.isBlurayFolder()
+}
+
+// parseMPLS reads the clip names and the duration of a Blu-ray playlist
+func parseMPLS(data []byte) ([]string, time.Duration, error) {
+	if len(data) < 20 || string(data[:4]) != "MPLS" {
+		return nil, 0, fmt.Errorf("not a Blu-ray playlist")
+	}
+	offset := int(binary.BigEndian.Uint32(data[8:]))
+	if offset+10 > len(data) {
+		return nil, 0, fmt.Errorf("invalid Blu-ray playlist offset %d", offset)
+	}
+	count := int(binary.BigEndian.Uint16(data[offset+6:]))
+	offset += 10
+
+	var clips []string
+	var ticks uint64
+	for idx := 0; idx < count; idx++ {
+		if offset+22 > len(data) {
+			return nil, 0, fmt.Errorf("truncated Blu-ray playlist")
+		}
+		length := int(binary.BigEndian.Uint16(data[offset:]))
+		// name and codec id, flags and STC id are followed by IN and OUT times of 45 kHz
+		clips = append(clips, string(data[offset+2:offset+7]))
+		inTime := binary.BigEndian.Uint32(data[offset+14:])
+		outTime := binary.BigEndian.Uint32(data[offset+18:])
+		if outTime > inTime {
+			ticks += uint64(outTime - inTime)
+		}
+		offset += 2 + length
+	}
+	return clips, time.Duration(ticks) * time.Second / 45000, nil
+}
+
+// mainBlurayTitle picks the longest playlist, or the largest stream file if playlists can't be read
+func mainBlurayTitle(disc Path) (BlurayTitle, error) {
+	bdmv := disc.appendingPathComponent("BDMV")
+	streamDir := bdmv.appendingPathComponent("STREAM")
+	playlists, _ := bdmv.appendingPathComponent("PLAYLIST").getDirectoryContents()
+
+	var main BlurayTitle
+	for _, playlist := range playlists {
+		if !strings.EqualFold(playlist.extension(), "mpls") {
+			continue
+		}
+		data, err := os.ReadFile(string(playlist))
+		if err != nil {
+			continue
+		}
+		clips, duration, err := parseMPLS(data)
+		if err != nil {
+			Log("⚠️", playlist, err)
+			continue
+		}
+		title := BlurayTitle{Playlist: playlist, Duration: duration}
+		for _, clip := range clips {
+			stream := streamDir.appendingPathComponent(clip + ".m2ts")
+			title.Streams = appendUnique(title.Streams, stream)
+		}
+		for _, stream := range title.Streams {
+			if info, err := os.Stat(string(stream)); err == nil {
+				title.Size += info.Size()
+			}
+		}
+		if title.Duration > main.Duration || (title.Duration == main.Duration && title.Size > main.Size) {
+			main = title
+		}
+	}
+	if main.Playlist != "" {
+		return main, nil
+	}
+
+	streams, err := streamDir.getDirectoryContents()
+	if err != nil {
+		return BlurayTitle{}, err
+	}
+	for _, stream := range streams {
+		if info, err := os.Stat(string(stream)); err == nil && info.Size() > main.Size {
+			main = BlurayTitle{Streams: []Path{stream}, Size: info.Size()}
+		}
+	}
+	if len(main.Streams) == 0 {
+		return BlurayTitle{}, fmt.Errorf("no Blu-ray streams found in %s", disc)
+	}
+	return main, nil
+}
+
+// probeDisc reads the duration of the Blu-ray main title
+func probeDisc(disc Path) (StreamDetails, error) {
+	if !disc.isBlurayFolder() {
+		return StreamDetails{}, fmt.Errorf("unsupported disc structure of %s", disc.lastPathComponent())
+	}
+	title, err := mainBlurayTitle(disc)
+	if err != nil {
+		return StreamDetails{}, err
+	}
+	Log("💿 main title", title.Playlist.lastPathComponent(), title.Duration.Round(time.Second), len(title.Streams), "streams")
+	return StreamDetails{Duration: title.Duration}, nil
+}
+
+// videoSize returns the file size, of the main title for Blu-ray folders and of the largest title set for DVD folders
+func videoSize(path Path) int64 {
+	if path.isBlurayFolder() {
+		if title, err := mainBlurayTitle(path); err == nil {
+			return title.Size
+		}
+		return 0
+	}
+	if videoTS := path.appendingPathComponent("VIDEO_TS"); videoTS.isDirectory() {
+		// `VTS_01_1.VOB`, `VTS_01_2.VOB` make the title set 01
+		titleSets := make(map[string]int64)
+		largest := int64(0)
+		files, _ := videoTS.getDirectoryContents()
+		for _, file := range files {
+			name := strings.ToUpper(file.lastPathComponent())
+			if info, err := os.Stat(string(file)); err == nil && strings.HasPrefix(name, "VTS_") && strings.HasSuffix(name, ".VOB") && len(name) > 6 {
+				titleSets[name[:6]] += info.Size()
+				largest = max64(largest, titleSets[name[:6]])
+			}
+		}
+		return largest
+	}
+	if info, err := os.Stat(string(path)); err == nil && !info.IsDir() {
+		return info.Size()
+	}
+	return 0
+}
+
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// linkDiscFolder places the disc structure folders into the output directory: folders are symlinked,
+// other link modes recreate the folders and link the files
+func linkDiscFolder(disc Path, outputDir Path, output OutputDir) ([]LinkedFile, error) {
+	if !outputDir.exists() {
+		if err := mkdirAllJournaled(outputDir); err != nil {
+			return nil, err
+		}
+	}
+	var linkedFiles []LinkedFile
+	for _, folder := range discStructureFolders {
+		source := disc.appendingPathComponent(folder)
+		target := outputDir.appendingPathComponent(folder)
+		if !source.isDirectory() || target.exists() {
+			continue
+		}
+		if output.linkMode().isSymlink() {
+			Log("creating", output.linkMode(), "for", source, "at", target)
+			if err := output.linkFile(source, target); err != nil {
+				return linkedFiles, err
+			}
+			linkedFiles = append(linkedFiles, LinkedFile{Source: source, Link: target, Mode: output.linkMode()})
+			continue
+		}
+		err := filepath.Walk(string(source), func(s string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			relative, err := filepath.Rel(string(source), s)
+			if err != nil {
+				return err
+			}
+			path := target.appendingPathComponent(relative)
+			if info.IsDir() {
+				return mkdirAllJournaled(path)
+			}
+			if err := output.linkFile(Path(s), path); err != nil {
+				return err
+			}
+			linkedFiles = append(linkedFiles, LinkedFile{Source: Path(s), Link: path, Mode: output.linkMode()})
+			return nil
+		})
+		if err != nil {
+			journal.recordLinks(linkedFiles)
+			return linkedFiles, err
+		}
+		Log("created", output.linkMode(), "for", source, "at", target)
+	}
+	journal.recordLinks(linkedFiles)
+	return linkedFiles, nil
+}
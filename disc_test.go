@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/binary"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// mplsPlaylist builds a Blu-ray playlist of clips with durations
+func mplsPlaylist(clips []string, durations []time.Duration) []byte {
+	data := append([]byte("MPLS0200"), binary.BigEndian.AppendUint32(nil, 20)...)
+	data = append(data, make([]byte, 8)...)
+	// length, reserved, number of play items and sub paths
+	data = append(data, make([]byte, 6)...)
+	data = binary.BigEndian.AppendUint16(data, uint16(len(clips)))
+	data = append(data, 0, 0)
+	for idx, clip := range clips {
+		item := append([]byte(clip), "M2TS"...)
+		item = append(item, 0, 0, 0)
+		item = binary.BigEndian.AppendUint32(item, 45000)
+		item = binary.BigEndian.AppendUint32(item, 45000+uint32(durations[idx]/time.Second)*45000)
+		data = binary.BigEndian.AppendUint16(data, uint16(len(item)))
+		data = append(data, item...)
+	}
+	return data
+}
+
+func writeBluray(t *testing.T, disc Path) {
+	files := map[string][]byte{
+		"BDMV/index.bdmv":          []byte("INDX0200"),
+		"BDMV/PLAYLIST/00000.mpls": mplsPlaylist([]string{"00001"}, []time.Duration{time.Minute}),
+		"BDMV/PLAYLIST/00800.mpls": mplsPlaylist([]string{"00002", "00003"}, []time.Duration{time.Hour, 30 * time.Minute}),
+		"BDMV/STREAM/00001.m2ts":   make([]byte, 300),
+		"BDMV/STREAM/00002.m2ts":   make([]byte, 200),
+		"BDMV/STREAM/00003.m2ts":   make([]byte, 100),
+		"CERTIFICATE/id.bdmv":      nil,
+	}
+	for name, data := range files {
+		path := disc.appendingPathComponent(name)
+		if err := os.MkdirAll(string(path.removingLastPathComponent()), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(string(path), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestBlurayFolder(t *testing.T) {
+	item := Path(t.TempDir()).appendingPathComponent("Movie.2010.BluRay")
+	disc := item.appendingPathComponent("DISC")
+	writeBluray(t, disc)
+	iso := item.appendingPathComponent("Movie.2010.iso")
+	if err := os.WriteFile(string(iso), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if videoFiles := getVideoFiles(item); !reflect.DeepEqual(videoFiles, []Path{disc, iso}) {
+		t.Errorf("unexpected video files %v", videoFiles)
+	}
+	if videoFiles := getVideoFiles(disc); !reflect.DeepEqual(videoFiles, []Path{disc}) {
+		t.Errorf("unexpected video files of the disc %v", videoFiles)
+	}
+
+	title, err := mainBlurayTitle(disc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if title.Playlist.lastPathComponent() != "00800.mpls" || title.Duration != 90*time.Minute || title.Size != 300 {
+		t.Errorf("unexpected main title %+v", title)
+	}
+	if streams, err := probeStreams(disc); err != nil || streams.Duration != 90*time.Minute {
+		t.Errorf("unexpected disc streams %+v %v", streams, err)
+	}
+
+	symlinks := OutputDir{Path: Path(t.TempDir())}
+	linkedFiles, err := linkDiscFolder(disc, symlinks.Path.appendingPathComponent("Movie (2010)"), symlinks)
+	if err != nil || len(linkedFiles) != 2 {
+		t.Fatalf("unexpected links %v %v", linkedFiles, err)
+	}
+	movieDir := symlinks.Path.appendingPathComponent("Movie (2010)")
+	if !movieDir.appendingPathComponent("BDMV").isSymlink() || !movieDir.isDiscFolder() {
+		t.Errorf("BDMV isn't symlinked")
+	}
+	if related := movieDir.findRelatedVideoFile(); related != movieDir.appendingPathComponent("BDMV") {
+		t.Errorf("unexpected related video %s", related)
+	}
+
+	hardlinks := OutputDir{Path: Path(t.TempDir()), LinkMode: HardlinkMode}
+	linkedFiles, err = linkDiscFolder(disc, hardlinks.Path, hardlinks)
+	if err != nil || len(linkedFiles) != 7 {
+		t.Fatalf("unexpected links %v %v", linkedFiles, err)
+	}
+	if !hardlinks.Path.appendingPathComponent("BDMV").appendingPathComponent("STREAM").appendingPathComponent("00002.m2ts").exists() {
+		t.Errorf("streams aren't hardlinked")
+	}
+}
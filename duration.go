@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+const (
+	// shorter files are samples when the item has long ones
+	sampleMaxDuration = 5 * time.Minute
+	// longer files are rather movies than episodes
+	episodeMaxDuration = 65 * time.Minute
+	// files of the item must be this long to tell samples by duration
+	featureMinDuration = 20 * time.Minute
+)
+
+// videoDurations reads durations of the files from container headers, 0 if unknown
+func videoDurations(videoFiles []Path) []time.Duration {
+	durations := make([]time.Duration, len(videoFiles))
+	for idx, videoFile := range videoFiles {
+		if streams, err := probeStreams(videoFile); err == nil {
+			durations[idx] = streams.Duration
+		}
+	}
+	return durations
+}
+
+// totalDuration sums the durations up, 0 if any is unknown
+func totalDuration(durations []time.Duration) time.Duration {
+	var total time.Duration
+	for _, duration := range durations {
+		if duration == 0 {
+			return 0
+		}
+		total += duration
+	}
+	return total
+}
+
+// medianDuration returns the median of known durations
+func medianDuration(durations []time.Duration) time.Duration {
+	known := filterSlice(durations, func(duration time.Duration) bool { return duration > 0 })
+	if len(known) == 0 {
+		return 0
+	}
+	sort.Slice(known, func(i, j int) bool { return known[i] < known[j] })
+	return known[len(known)/2]
+}
+
+// seemMultipleMovies tells whether all files of an item are movie-length
+func seemMultipleMovies(durations []time.Duration) bool {
+	if len(durations) < 2 {
+		return false
+	}
+	for _, duration := range durations {
+		if duration < episodeMaxDuration {
+			return false
+		}
+	}
+	return true
+}
+
+// scoreRuntime adjusts a match score by how the runtime in minutes fits the duration
+func scoreRuntime(score int, runtime int, duration time.Duration) int {
+	if runtime <= 0 || duration <= 0 {
+		return score
+	}
+	expected := time.Duration(runtime) * time.Minute
+	difference := duration - expected
+	if difference < 0 {
+		difference = -difference
+	}
+	switch {
+	case difference <= expected/10:
+		return min(score+5, 100)
+	case difference <= expected/4:
+		return score
+	default:
+		Logf("⏱️ runtime %d min doesn't fit %s, lowering score\n", runtime, duration.Round(time.Minute))
+		return score - 20
+	}
+}
+
+// validateRuntime loads the runtime of a match if needed and adjusts its score
+func validateRuntime(ctx context.Context, info MediaInfo, score int, duration time.Duration, config Config) (MediaInfo, int) {
+	if duration <= 0 {
+		return info, score
+	}
+	if info.Runtime == 0 && info.Id.idType == TMDB {
+		// details have no `genre_ids` of search results, only the runtime is taken
+		info.Runtime = loadCandidateDetails(ctx, info, config).Runtime
+	}
+	return info, scoreRuntime(score, info.Runtime, duration)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestScoreRuntime(t *testing.T) {
+	tests := []struct {
+		runtime  int
+		duration time.Duration
+		expected int
+	}{
+		{120, 118 * time.Minute, 90},
+		{120, 100 * time.Minute, 85},
+		{120, 45 * time.Minute, 65},
+		{45, 42 * time.Minute, 90},
+		{0, 45 * time.Minute, 85},
+		{120, 0, 85},
+	}
+	for _, test := range tests {
+		if score := scoreRuntime(85, test.runtime, test.duration); score != test.expected {
+			t.Errorf("%d min for %s: expected %d, got %d", test.runtime, test.duration, test.expected, score)
+		}
+	}
+
+	if !seemMultipleMovies([]time.Duration{95 * time.Minute, 110 * time.Minute}) {
+		t.Error("expected multiple movies")
+	}
+	if seemMultipleMovies([]time.Duration{95 * time.Minute, 0}) || seemMultipleMovies([]time.Duration{44 * time.Minute, 43 * time.Minute}) {
+		t.Error("unexpected multiple movies")
+	}
+	if median := medianDuration([]time.Duration{44 * time.Minute, 0, 43 * time.Minute, 90 * time.Minute}); median != 44*time.Minute {
+		t.Errorf("unexpected median %s", median)
+	}
+}
+
+func TestValidateRuntimeKeepsSearchResultInfo(t *testing.T) {
+	originalCacheDir, originalClient := CacheDir, httpClient
+	defer func() { CacheDir, httpClient = originalCacheDir, originalClient }()
+	CacheDir = t.TempDir()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// details have `genres` instead of `genre_ids` of search results
+		w.Write([]byte(`{"id": 27205, "title": "Начало", "original_title": "Inception", "release_date": "2010-07-15", "runtime": 148, "genres": [{"id": 28, "name": "боевик"}]}`))
+	}))
+	defer server.Close()
+	httpClient = newHTTPClient(HTTPConfig{})
+	httpClient.client.Transport = redirectTransport{server}
+
+	videoFile := Path(t.TempDir()).appendingPathComponent("Inception.2010.1080p.mkv")
+	writeMatroska(t, videoFile, 147*time.Minute)
+	durations := videoDurations([]Path{videoFile})
+	if durations[0] != 147*time.Minute {
+		t.Fatalf("unexpected duration %s", durations[0])
+	}
+
+	info := MediaInfo{Id: MediaId{id: "27205", idType: TMDB}, Title: "Начало", Year: "2010", Genres: []string{"боевик", "фантастика"}}
+	validated, score := validateRuntime(context.Background(), info, 85, totalDuration(durations), Config{TMDbApiKey: "key"})
+	if score != 90 || validated.Runtime != 148 {
+		t.Errorf("unexpected score %d and runtime %d", score, validated.Runtime)
+	}
+	if !reflect.DeepEqual(validated.Genres, info.Genres) {
+		t.Errorf("genres of the search result are lost: %v", validated.Genres)
+	}
+}
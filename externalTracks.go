@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ExternalTrack is a subtitle or audio file kept apart from its video, e.g. in `Subs/` or `RUS Sound/`
+type ExternalTrack struct {
+	Path Path
+	// ISO 639-1, e.g. `ru`
+	Language string
+	Forced   bool
+	// tells tracks of one language apart, e.g. a dubbing studio folder
+	Label string
+}
+
+var (
+	subtitleExtensions = map[string]bool{"srt": true, "ass": true, "ssa": true, "sup": true, "sub": true, "idx": true, "vtt": true}
+	audioExtensions    = map[string]bool{"mka": true, "ac3": true, "eac3": true, "dts": true, "aac": true}
+)
+
+// name tokens of track languages
+var trackLanguages = map[string]string{
+	"ru": "ru", "rus": "ru", "russian": "ru", "рус": "ru", "русский": "ru", "русские": "ru", "russub": "ru",
+	"en": "en", "eng": "en", "english": "en", "англ": "en", "английский": "en", "английские": "en", "engsub": "en",
+	"uk": "uk", "ukr": "uk", "ukrainian": "uk", "укр": "uk", "украинский": "uk", "украинские": "uk",
+	"de": "de", "ger": "de", "german": "de", "fr": "fr", "fre": "fr", "french": "fr",
+	"es": "es", "spa": "es", "spanish": "es", "it": "it", "ita": "it", "italian": "it", "ja": "ja", "jpn": "ja", "japanese": "ja",
+}
+
+var forcedTrackTokens = map[string]bool{"forced": true, "signs": true, "надписи": true, "форсированные": true}
+
+// folder name tokens which don't tell tracks apart
+var genericTrackFolderTokens = map[string]bool{
+	"sub": true, "subs": true, "subtitle": true, "subtitles": true, "sound": true, "sounds": true, "audio": true, "dub": true,
+	"субтитры": true, "звук": true, "озвучка": true, "озвучки": true, "дорожки": true, "аудио": true,
+	"season": true, "сезон": true,
+}
+
+var trackTokenSeparatorRE = regexp.MustCompile(`[^\p{L}\p{N}]+`)
+
+func trackTokens(name string) []string {
+	return filterSlice(trackTokenSeparatorRE.Split(strings.ToLower(name), -1), func(token string) bool { return token != "" })
+}
+
+// findExternalTracks lists subtitle and audio files of a media item, tracks of extras are skipped
+func findExternalTracks(itemPath Path) []ExternalTrack {
+	if !itemPath.isDirectory() {
+		return nil
+	}
+	contents, err := itemPath.getDirectoryContentsRecursively()
+	if err != nil {
+		Log("⚠️ could not list", itemPath, err)
+		return nil
+	}
+	var tracks []ExternalTrack
+	for _, path := range contents {
+		ext := strings.ToLower(path.extension())
+		if !subtitleExtensions[ext] && !audioExtensions[ext] {
+			continue
+		}
+		if videoKindOfName(itemPath, path) != MainVideo || isInsideDiscStructure(itemPath, path) {
+			continue
+		}
+		tracks = append(tracks, externalTrack(itemPath, path))
+	}
+	return tracks
+}
+
+func isInsideDiscStructure(itemPath Path, path Path) bool {
+	relative, err := filepath.Rel(string(itemPath), string(path))
+	if err != nil {
+		return false
+	}
+	for _, folder := range strings.Split(relative, string(filepath.Separator)) {
+		for _, discFolder := range discStructureFolders {
+			if strings.EqualFold(folder, discFolder) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// externalTrack infers the language and the forced flag from the file and folder names
+func externalTrack(itemPath Path, path Path) ExternalTrack {
+	track := ExternalTrack{Path: path}
+	// title words like `It` aren't languages
+	tokens := trackTokens(path.removingPathExtension().lastPathComponent())
+	title := trackTokens(parseReleaseName(itemPath.lastPathComponent(), false).Title)
+	for len(title) > 0 && len(tokens) > 0 && tokens[0] == title[0] {
+		tokens, title = tokens[1:], title[1:]
+	}
+	track.Language, track.Forced = trackLanguage(tokens)
+	// folders from the closest, e.g. `RUS Sound/LostFilm/`
+	for dir := path.removingLastPathComponent(); dir != itemPath && len(dir) > len(itemPath); dir = dir.removingLastPathComponent() {
+		tokens := trackTokens(dir.lastPathComponent())
+		language, forced := trackLanguage(tokens)
+		track.Language = Coalesce(track.Language, language)
+		track.Forced = track.Forced || forced
+		generic := true
+		for _, token := range tokens {
+			if _, ok := trackLanguages[token]; !ok && !forcedTrackTokens[token] && !genericTrackFolderTokens[token] && atoi(token) == 0 {
+				generic = false
+			}
+		}
+		if !generic && track.Label == "" {
+			track.Label = sanitizeFileName(dir.lastPathComponent())
+		}
+	}
+	return track
+}
+
+// trackLanguage reads the language closest to the end of the name, two-letter codes are taken only
+// among trailing tokens, e.g. `ru` of `Movie.ru.forced` but not `it` of `It.2017.eng`
+func trackLanguage(tokens []string) (string, bool) {
+	language, forced := "", false
+	trailing := true
+	for idx := len(tokens) - 1; idx >= 0; idx-- {
+		token := tokens[idx]
+		if forcedTrackTokens[token] {
+			forced = true
+			continue
+		}
+		code, ok := trackLanguages[token]
+		if ok && language == "" && (trailing || utf8.RuneCountInString(token) > 2) {
+			language = code
+		}
+		trailing = trailing && ok
+	}
+	return language, forced
+}
+
+// tracksOfVideo picks the tracks named after the video or its episode; all tracks belong to a single video.
+// Siblings sharing the video name prefix are linked with the video itself
+func tracksOfVideo(tracks []ExternalTrack, videoFile Path, videoFiles []Path) []ExternalTrack {
+	name := strings.ToLower(videoFile.removingPathExtension().lastPathComponent())
+	release := parseReleaseName(name, true)
+	return filterSlice(tracks, func(track ExternalTrack) bool {
+		trackName := strings.ToLower(track.Path.removingPathExtension().lastPathComponent())
+		if track.Path.removingLastPathComponent() == videoFile.removingLastPathComponent() && strings.HasPrefix(strings.ToLower(track.Path.lastPathComponent()), name+".") {
+			return false
+		}
+		if len(videoFiles) == 1 || hasNamePrefix(trackName, name) {
+			return true
+		}
+		trackRelease := parseReleaseName(trackName, true)
+		return len(release.Episodes) > 0 && len(trackRelease.Episodes) > 0 &&
+			release.Episodes[0] == trackRelease.Episodes[0] &&
+			(len(release.Seasons) == 0 || len(trackRelease.Seasons) == 0 || release.Seasons[0] == trackRelease.Seasons[0])
+	})
+}
+
+// hasNamePrefix tells whether the name starts with the prefix followed by a separator, `s01e1` isn't a prefix of `s01e10`
+func hasNamePrefix(name string, prefix string) bool {
+	if !strings.HasPrefix(name, prefix) {
+		return false
+	}
+	next, _ := utf8.DecodeRuneInString(name[len(prefix):])
+	return next == utf8.RuneError || (!unicode.IsLetter(next) && !unicode.IsDigit(next))
+}
+
+// externalTrackFileName returns the Kodi/Jellyfin name of a track, e.g. `Name.LostFilm.ru.forced.srt`
+func externalTrackFileName(track ExternalTrack, targetNameWithoutExtension string, taken map[string]bool) string {
+	name := targetNameWithoutExtension
+	if track.Label != "" {
+		name += "." + track.Label
+	}
+	suffix := ""
+	if track.Language != "" {
+		suffix += "." + track.Language
+	}
+	if track.Forced {
+		suffix += ".forced"
+	}
+	suffix += "." + strings.ToLower(track.Path.extension())
+	fileName := name + suffix
+	for idx := 2; taken[strings.ToLower(fileName)]; idx++ {
+		fileName = fmt.Sprintf("%s.%d%s", name, idx, suffix)
+	}
+	taken[strings.ToLower(fileName)] = true
+	return fileName
+}
+
+// linkExternalTracks links the tracks of a video next to its link
+func linkExternalTracks(tracks []ExternalTrack, outputDir Path, targetNameWithoutExtension string, output OutputDir) ([]LinkedFile, error) {
+	var linkedFiles []LinkedFile
+	taken := make(map[string]bool)
+	for _, track := range tracks {
+		outPath := outputDir.appendingPathComponent(externalTrackFileName(track, targetNameWithoutExtension, taken))
+		if outPath.exists() {
+			continue
+		}
+		Log("creating", output.linkMode(), "for", track.Path.lastPathComponent(), "at", outPath)
+		if err := output.linkFile(track.Path, outPath); err != nil {
+			return linkedFiles, err
+		}
+		linkedFile := LinkedFile{Source: track.Path, Link: outPath, Mode: output.linkMode()}
+		journal.recordLinks([]LinkedFile{linkedFile})
+		linkedFiles = append(linkedFiles, linkedFile)
+	}
+	return linkedFiles, nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestExternalTracks(t *testing.T) {
+	item := Path(t.TempDir()).appendingPathComponent("Movie.2010.BDRip")
+	files := []string{
+		"Movie.2010.BDRip.avi",
+		"Movie.2010.BDRip.rus.srt",
+		"Subs/Movie.2010.BDRip.Eng.srt",
+		"Subs/Rus Forced.srt",
+		"Eng.Subs/full.ass",
+		"RUS Sound/LostFilm/Movie.2010.BDRip.ac3",
+		"RUS Sound/Кубик в Кубе/Movie.2010.BDRip.ac3",
+		"Extras/Featurette.rus.srt",
+	}
+	for _, file := range files {
+		path := item.appendingPathComponent(file)
+		if err := os.MkdirAll(string(path.removingLastPathComponent()), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(string(path), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	videoFile := item.appendingPathComponent("Movie.2010.BDRip.avi")
+	tracks := tracksOfVideo(findExternalTracks(item), videoFile, []Path{videoFile})
+	taken := make(map[string]bool)
+	var names []string
+	for _, track := range tracks {
+		names = append(names, externalTrackFileName(track, "Movie (2010)", taken))
+	}
+	sort.Strings(names)
+	expected := []string{
+		"Movie (2010).LostFilm.ru.ac3",
+		"Movie (2010).en.ass",
+		"Movie (2010).en.srt",
+		"Movie (2010).ru.forced.srt",
+		"Movie (2010).Кубик в Кубе.ru.ac3",
+	}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("unexpected track names %v", names)
+	}
+
+	output := OutputDir{Path: Path(t.TempDir())}
+	linkedFiles, err := linkExternalTracks(tracks, output.Path, "Movie (2010)", output)
+	if err != nil || len(linkedFiles) != len(expected) {
+		t.Fatalf("unexpected links %v %v", linkedFiles, err)
+	}
+	if !output.Path.appendingPathComponent("Movie (2010).ru.forced.srt").exists() {
+		t.Errorf("forced subtitles aren't linked")
+	}
+}
+
+func TestTracksOfEpisodes(t *testing.T) {
+	tracks := []ExternalTrack{
+		{Path: "/media/Show.S01/Subs/Show.S01E01.rus.srt", Language: "ru"},
+		{Path: "/media/Show.S01/Subs/Show.S01E10.rus.srt", Language: "ru"},
+		{Path: "/media/Show.S01/Sound/Show.s01e01.LostFilm.mka", Language: "ru"},
+		{Path: "/media/Show.S01/Subs/Show.S01E01.eng.srt", Language: "en"},
+	}
+	videoFiles := []Path{"/media/Show.S01/Show.S01E01.mkv", "/media/Show.S01/Show.S01E10.mkv"}
+	if episodeTracks := tracksOfVideo(tracks, videoFiles[0], videoFiles); !reflect.DeepEqual(episodeTracks, []ExternalTrack{tracks[0], tracks[2], tracks[3]}) {
+		t.Errorf("unexpected tracks of the first episode %v", episodeTracks)
+	}
+	if episodeTracks := tracksOfVideo(tracks, videoFiles[1], videoFiles); !reflect.DeepEqual(episodeTracks, []ExternalTrack{tracks[1]}) {
+		t.Errorf("unexpected tracks of the tenth episode %v", episodeTracks)
+	}
+}
+
+func TestExternalTrackLanguageOfTitleWords(t *testing.T) {
+	item := Path("/media/It.2017.1080p.BluRay")
+	tests := []struct {
+		file     string
+		expected string
+	}{
+		{"Subs/It.2017.1080p.rus.srt", "It (2017).ru.srt"},
+		{"Subs/It.2017.1080p.eng.forced.srt", "It (2017).en.forced.srt"},
+		{"Subs/It.2017.1080p.BluRay.srt", "It (2017).srt"},
+		{"Subs/2_Ita.srt", "It (2017).it.srt"},
+		{"It.2017.1080p.BluRay.en.forced.srt", "It (2017).en.forced.srt"},
+		{"Subs/English/It.srt", "It (2017).en.srt"},
+	}
+	for _, test := range tests {
+		track := externalTrack(item, item.appendingPathComponent(test.file))
+		if name := externalTrackFileName(track, "It (2017)", map[string]bool{}); name != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.file, test.expected, name)
+		}
+	}
+}
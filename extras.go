@@ -0,0 +1,154 @@
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// VideoKind tells the main feature of a media item from its samples and extras
+type VideoKind string
+
+const (
+	MainVideo            VideoKind = "main"
+	SampleVideo          VideoKind = "sample"
+	TrailerVideo         VideoKind = "trailer"
+	FeaturetteVideo      VideoKind = "featurette"
+	BehindTheScenesVideo VideoKind = "behindthescenes"
+	DeletedSceneVideo    VideoKind = "deleted"
+	InterviewVideo       VideoKind = "interview"
+	ExtraVideo           VideoKind = "extra"
+)
+
+// ExtraFile is a trailer, featurette or another bonus video of a media item
+type ExtraFile struct {
+	Path Path
+	Kind VideoKind
+}
+
+// sizes of samples when durations are unknown
+const (
+	sampleMaxSizeRatio = 20
+	featureMinSize     = 1 << 30
+)
+
+var (
+	// e.g. `sample.mkv`, `movie-sample.mkv`, `Movie.2010.Trailer.mp4`
+	sampleOrTrailerRE = regexp.MustCompile(`(?i)(?:^|[\s._\-])(sample|trailer|teaser|трейлер|тизер)\d*$`)
+	// Plex local extras suffixes, e.g. `Making Of-behindthescenes.mkv`
+	extraSuffixRE = regexp.MustCompile(`(?i)-(behindthescenes|deleted|featurette|interview|scene|short|other|extra)\d*$`)
+)
+
+var videoKindsOfSuffixes = map[string]VideoKind{
+	"sample": SampleVideo, "trailer": TrailerVideo, "teaser": TrailerVideo, "трейлер": TrailerVideo, "тизер": TrailerVideo,
+	"behindthescenes": BehindTheScenesVideo, "deleted": DeletedSceneVideo, "scene": DeletedSceneVideo, "featurette": FeaturetteVideo,
+	"interview": InterviewVideo, "short": ExtraVideo, "other": ExtraVideo, "extra": ExtraVideo,
+}
+
+// lowercased folder names without punctuation
+var videoKindsOfFolders = map[string]VideoKind{
+	"sample": SampleVideo, "samples": SampleVideo,
+	"trailer": TrailerVideo, "trailers": TrailerVideo, "teasers": TrailerVideo, "трейлер": TrailerVideo, "трейлеры": TrailerVideo,
+	"featurette": FeaturetteVideo, "featurettes": FeaturetteVideo,
+	"behind the scenes": BehindTheScenesVideo, "making of": BehindTheScenesVideo, "bts": BehindTheScenesVideo, "о съемках": BehindTheScenesVideo,
+	"deleted scenes": DeletedSceneVideo, "deleted": DeletedSceneVideo, "удаленные сцены": DeletedSceneVideo,
+	"interview": InterviewVideo, "interviews": InterviewVideo, "интервью": InterviewVideo,
+	"extra": ExtraVideo, "extras": ExtraVideo, "bonus": ExtraVideo, "bonuses": ExtraVideo, "special features": ExtraVideo,
+	"specials features": ExtraVideo, "other": ExtraVideo, "others": ExtraVideo, "shorts": ExtraVideo,
+	"бонус": ExtraVideo, "бонусы": ExtraVideo, "доп материалы": ExtraVideo, "дополнительные материалы": ExtraVideo,
+}
+
+var folderPunctuationRE = regexp.MustCompile(`[\s._\-]+`)
+
+// videoKindOfName classifies a video by its folders inside the item and its file name
+func videoKindOfName(itemPath Path, videoFile Path) VideoKind {
+	if relative, err := filepath.Rel(string(itemPath), string(videoFile.removingLastPathComponent())); err == nil && relative != "." {
+		for _, folder := range strings.Split(relative, string(filepath.Separator)) {
+			folder = strings.TrimSpace(folderPunctuationRE.ReplaceAllString(strings.ToLower(folder), " "))
+			if kind, ok := videoKindsOfFolders[folder]; ok {
+				return kind
+			}
+		}
+	}
+	name := videoFile.removingPathExtension().lastPathComponent()
+	if match := extraSuffixRE.FindStringSubmatch(name); match != nil {
+		return videoKindsOfSuffixes[strings.ToLower(match[1])]
+	}
+	if match := sampleOrTrailerRE.FindStringSubmatch(name); match != nil {
+		return videoKindsOfSuffixes[strings.ToLower(match[1])]
+	}
+	return MainVideo
+}
+
+// splitVideoFiles separates the main feature files of an item from samples and extras by names,
+// durations (0 if unknown) or sizes; samples are dropped and the main files are never all dropped
+func splitVideoFiles(itemPath Path, videoFiles []Path, durations []time.Duration) ([]Path, []time.Duration, []ExtraFile) {
+	if len(durations) < len(videoFiles) {
+		durations = make([]time.Duration, len(videoFiles))
+	}
+	longest := time.Duration(0)
+	for _, duration := range durations {
+		if duration > longest {
+			longest = duration
+		}
+	}
+	sizes := make([]int64, len(videoFiles))
+	largest := int64(0)
+	for idx, videoFile := range videoFiles {
+		sizes[idx] = videoSize(videoFile)
+		largest = max64(largest, sizes[idx])
+	}
+
+	var files []Path
+	var fileDurations []time.Duration
+	var extras []ExtraFile
+	for idx, videoFile := range videoFiles {
+		kind := videoKindOfName(itemPath, videoFile)
+		if kind == MainVideo {
+			duration := durations[idx]
+			if duration > 0 && duration < sampleMaxDuration && longest >= featureMinDuration {
+				kind = SampleVideo
+			} else if duration == 0 && sizes[idx] > 0 && sizes[idx]*sampleMaxSizeRatio < largest && largest >= featureMinSize {
+				kind = SampleVideo
+			}
+		}
+		switch kind {
+		case MainVideo:
+			files = append(files, videoFile)
+			fileDurations = append(fileDurations, durations[idx])
+		case SampleVideo:
+			Log("🎞️ skipping sample", videoFile.lastPathComponent())
+		default:
+			Log("🎞️", kind, videoFile.lastPathComponent())
+			extras = append(extras, ExtraFile{Path: videoFile, Kind: kind})
+		}
+	}
+	if len(files) == 0 {
+		return videoFiles, durations, nil
+	}
+	return files, fileDurations, extras
+}
+
+// linkExtras links extras of an item into the movie or TV Show folder
+func linkExtras(extras []ExtraFile, dir Path, movieFileName string, hasOwnFolder bool, output OutputDir, source Path, index *OutputIndex) error {
+	for _, extra := range extras {
+		extraDir, fileName, ok := output.extraLocation(extra, dir, movieFileName, hasOwnFolder)
+		if !ok {
+			continue
+		}
+		if !extraDir.exists() {
+			if err := mkdirAllJournaled(extraDir); err != nil {
+				return err
+			}
+		}
+		linkedFiles, err := linkVideoFileAndRelatedItems(extra.Path, extraDir, fileName, false, output)
+		if recordErr := index.recordLinkedFiles(source, linkedFiles); recordErr != nil {
+			Log("❌ failed to record linked files", recordErr)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
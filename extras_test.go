@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// writeMatroska writes a Matroska file with the duration and a video track
+func writeMatroska(t *testing.T, path Path, duration time.Duration) {
+	file := bytes.Join([][]byte{
+		ebmlElement(ebmlHeaderId, ebmlElement(0x4282, []byte("matroska"))),
+		ebmlElement(mkvSegmentId,
+			ebmlElement(mkvInfoId, ebmlElement(mkvDurationId, binary.BigEndian.AppendUint64(nil, math.Float64bits(float64(duration.Milliseconds()))))),
+			ebmlElement(mkvTracksId, ebmlElement(mkvTrackEntryId, ebmlElement(mkvTrackTypeId, ebmlUintBody(mkvVideoTrack))))),
+	}, nil)
+	if err := os.MkdirAll(string(path.removingLastPathComponent()), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(string(path), file, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVideoKindOfName(t *testing.T) {
+	tests := []struct {
+		item     Path
+		name     string
+		expected VideoKind
+	}{
+		{"/media/Movie", "Movie.2010.1080p.mkv", MainVideo},
+		{"/media/Movie", "Movie.2010.1080p.sample.mkv", SampleVideo},
+		{"/media/Movie", "Sample/movie.mkv", SampleVideo},
+		{"/media/Movie", "Movie-trailer.mp4", TrailerVideo},
+		{"/media/Movie", "Trailers/Teaser 1.mkv", TrailerVideo},
+		{"/media/Movie", "Extras/Featurettes/Visual Effects.mkv", ExtraVideo},
+		{"/media/Movie", "Behind.The.Scenes/Part 1.mkv", BehindTheScenesVideo},
+		{"/media/Movie", "Deleted Scenes/Alternate Ending.mkv", DeletedSceneVideo},
+		{"/media/Movie", "Making Of-behindthescenes.mkv", BehindTheScenesVideo},
+		{"/media/Movie", "Cast-interview.mkv", InterviewVideo},
+		{"/media/Movie", "Бонусы/Фильм о фильме.avi", ExtraVideo},
+		// folders above the item and titles containing the words are kept
+		{"/media/Extras/Movie", "Movie.mkv", MainVideo},
+		{"/media/Trailer.Park.Boys", "Trailer.Park.Boys.S01E01.mkv", MainVideo},
+		{"/media/The.Other.2010", "The.Other.2010.mkv", MainVideo},
+	}
+	for _, test := range tests {
+		if kind := videoKindOfName(test.item, test.item.appendingPathComponent(test.name)); kind != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.name, test.expected, kind)
+		}
+	}
+}
+
+func TestSplitVideoFiles(t *testing.T) {
+	dir := Path(t.TempDir())
+	movie := dir.appendingPathComponent("Movie.2010.1080p.mkv")
+	sample := dir.appendingPathComponent("Movie.2010.1080p.sample.mkv")
+	trailer := dir.appendingPathComponent("Trailers").appendingPathComponent("Teaser 1.mkv")
+	clip := dir.appendingPathComponent("Movie.2010.1080p.clip.mkv")
+	writeMatroska(t, movie, 2*time.Hour)
+	writeMatroska(t, sample, time.Minute)
+	writeMatroska(t, trailer, 2*time.Minute)
+	writeMatroska(t, clip, 3*time.Minute)
+
+	videoFiles := []Path{movie, sample, trailer, clip}
+	files, durations, extras := splitVideoFiles(dir, videoFiles, videoDurations(videoFiles))
+	if !reflect.DeepEqual(files, []Path{movie}) || !reflect.DeepEqual(durations, []time.Duration{2 * time.Hour}) {
+		t.Errorf("unexpected files %v %v", files, durations)
+	}
+	if !reflect.DeepEqual(extras, []ExtraFile{{Path: trailer, Kind: TrailerVideo}}) {
+		t.Errorf("unexpected extras %v", extras)
+	}
+
+	// short clips aren't samples next to short files, the main files are never all dropped
+	files, _, _ = splitVideoFiles(dir, []Path{clip, trailer}, []time.Duration{3 * time.Minute, 2 * time.Minute})
+	if !reflect.DeepEqual(files, []Path{clip}) {
+		t.Errorf("unexpected files %v", files)
+	}
+	files, _, extras = splitVideoFiles(dir, []Path{sample}, nil)
+	if !reflect.DeepEqual(files, []Path{sample}) || extras != nil {
+		t.Errorf("unexpected files %v, extras %v", files, extras)
+	}
+}
+
+func TestExtraLocation(t *testing.T) {
+	trailer := ExtraFile{Path: "/media/Movie/Trailers/Teaser.mkv", Kind: TrailerVideo}
+	featurette := ExtraFile{Path: "/media/Movie/Featurettes/VFX.mkv", Kind: FeaturetteVideo}
+
+	jellyfin := OutputDir{Path: "/out/movies", Profile: JellyfinProfile}
+	if dir, name, ok := jellyfin.extraLocation(featurette, "/out/movies/Movie (2010)", "Movie (2010)", true); !ok || dir != "/out/movies/Movie (2010)/featurettes" || name != "VFX" {
+		t.Errorf("unexpected featurette location %s/%s", dir, name)
+	}
+	if dir, name, ok := jellyfin.extraLocation(trailer, "/out/movies/Movie (2010)", "Movie (2010)", true); !ok || dir != "/out/movies/Movie (2010)/trailers" || name != "Teaser" {
+		t.Errorf("unexpected trailer location %s/%s", dir, name)
+	}
+
+	kodi := OutputDir{Path: "/out/movies"}
+	if dir, name, ok := kodi.extraLocation(trailer, "/out/movies/Movie", "Movie.2010", true); !ok || dir != "/out/movies/Movie" || name != "Movie.2010-trailer" {
+		t.Errorf("unexpected kodi trailer location %s/%s", dir, name)
+	}
+	if dir, name, ok := kodi.extraLocation(featurette, "/out/movies/Movie", "Movie.2010", true); !ok || dir != "/out/movies/Movie/Extras" || name != "VFX" {
+		t.Errorf("unexpected kodi featurette location %s/%s", dir, name)
+	}
+	// movies sharing a folder get no extras folders
+	if _, _, ok := kodi.extraLocation(featurette, "/out/movies", "Movie.2010", false); ok {
+		t.Errorf("unexpected featurette in a shared folder")
+	}
+}
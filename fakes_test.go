@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hekmon/transmissionrpc/v3"
+)
+
+// FakeTransmission answers torrent-get and torrent-set-location like the Transmission RPC,
+// moved torrents are moved on disk too
+type FakeTransmission struct {
+	server   *httptest.Server
+	mutex    sync.Mutex
+	torrents []transmissionrpc.Torrent
+	// new locations by torrent id
+	moves map[int64]string
+}
+
+func newFakeTransmission(t *testing.T, torrents []transmissionrpc.Torrent) *FakeTransmission {
+	fake := &FakeTransmission{torrents: torrents, moves: make(map[int64]string)}
+	fake.server = httptest.NewServer(http.HandlerFunc(fake.handle))
+	t.Cleanup(fake.server.Close)
+	return fake
+}
+
+func (f *FakeTransmission) rpcURL() string {
+	return f.server.URL + "/transmission/rpc"
+}
+
+func fakeTorrent(id int64, downloadDir string, name string, comment string) transmissionrpc.Torrent {
+	return transmissionrpc.Torrent{ID: &id, DownloadDir: &downloadDir, Name: &name, Comment: &comment}
+}
+
+func (f *FakeTransmission) handle(w http.ResponseWriter, r *http.Request) {
+	const sessionHeader = "X-Transmission-Session-Id"
+	if r.Header.Get(sessionHeader) != "test-session" {
+		w.Header().Set(sessionHeader, "test-session")
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	var request struct {
+		Method    string `json:"method"`
+		Arguments struct {
+			Ids      []int64 `json:"ids"`
+			Location string  `json:"location"`
+			Move     bool    `json:"move"`
+		} `json:"arguments"`
+		Tag int `json:"tag"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	arguments := map[string]interface{}{}
+	result := "success"
+	switch request.Method {
+	case "torrent-get":
+		arguments["torrents"] = f.torrents
+	case "torrent-set-location":
+		for _, id := range request.Arguments.Ids {
+			for _, torrent := range f.torrents {
+				if *torrent.ID != id {
+					continue
+				}
+				if request.Arguments.Move {
+					if err := os.MkdirAll(request.Arguments.Location, 0755); err != nil {
+						result = err.Error()
+					} else if err := os.Rename(filepath.Join(*torrent.DownloadDir, *torrent.Name), filepath.Join(request.Arguments.Location, *torrent.Name)); err != nil {
+						result = err.Error()
+					}
+				}
+				*torrent.DownloadDir = request.Arguments.Location
+				f.moves[id] = request.Arguments.Location
+			}
+		}
+	default:
+		result = "method not supported by the fake: " + request.Method
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"arguments": arguments, "result": result, "tag": request.Tag})
+}
+
+// FakeOpenAI answers chat completions with the answer function's reply to the prompt
+type FakeOpenAI struct {
+	server  *httptest.Server
+	mutex   sync.Mutex
+	prompts []string
+}
+
+func newFakeOpenAI(t *testing.T, answer func(prompt string) string) *FakeOpenAI {
+	fake := &FakeOpenAI{}
+	fake.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" || r.Header.Get("Authorization") == "" {
+			http.Error(w, "unexpected request", http.StatusBadRequest)
+			return
+		}
+		var request struct {
+			Messages []Message `json:"messages"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || len(request.Messages) == 0 {
+			http.Error(w, "invalid request", http.StatusBadRequest)
+			return
+		}
+		prompt := request.Messages[len(request.Messages)-1].Content
+		fake.mutex.Lock()
+		fake.prompts = append(fake.prompts, prompt)
+		fake.mutex.Unlock()
+		content := answer(prompt)
+		// words stand in for tokens
+		usage := Usage{PromptTokens: len(strings.Fields(prompt)), CompletionTokens: len(strings.Fields(content))}
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+		json.NewEncoder(w).Encode(ChatGPTResponse{
+			Object:  "chat.completion",
+			Model:   "gpt-3.5-turbo",
+			Choices: []Choice{{Message: Message{Role: "assistant", Content: content}, FinishReason: "stop"}},
+			Usage:   usage,
+		})
+	}))
+	t.Cleanup(fake.server.Close)
+	return fake
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+type FanartTvAPI struct {
+	ApiKey string
+}
+
+type FanartTvImage struct {
+	Id    string `json:"id"`
+	Url   string `json:"url"`
+	Lang  string `json:"lang"`
+	Likes string `json:"likes"`
+}
+
+type FanartTvMovieImages struct {
+	HDMovieLogo     []FanartTvImage `json:"hdmovielogo"`
+	MovieLogo       []FanartTvImage `json:"movielogo"`
+	HDMovieClearArt []FanartTvImage `json:"hdmovieclearart"`
+	MovieBanner     []FanartTvImage `json:"moviebanner"`
+	MovieThumb      []FanartTvImage `json:"moviethumb"`
+	MovieDisc       []FanartTvImage `json:"moviedisc"`
+	MoviePoster     []FanartTvImage `json:"movieposter"`
+	MovieBackground []FanartTvImage `json:"moviebackground"`
+}
+
+type FanartTvShowImages struct {
+	HDTvLogo       []FanartTvImage `json:"hdtvlogo"`
+	ClearLogo      []FanartTvImage `json:"clearlogo"`
+	HDClearArt     []FanartTvImage `json:"hdclearart"`
+	TvBanner       []FanartTvImage `json:"tvbanner"`
+	TvThumb        []FanartTvImage `json:"tvthumb"`
+	TvPoster       []FanartTvImage `json:"tvposter"`
+	ShowBackground []FanartTvImage `json:"showbackground"`
+}
+
+func (image FanartTvImage) Artwork(artworkType ArtworkType) Artwork {
+	likes, _ := strconv.Atoi(image.Likes)
+	lang := image.Lang
+	// fanart.tv marks images without text with `00`
+	if lang == "00" {
+		lang = ""
+	}
+	return Artwork{Type: artworkType, Url: image.Url, Language: lang, Rating: float64(likes)}
+}
+
+func (images FanartTvMovieImages) Artwork() []Artwork {
+	return fanartTvArtwork(map[ArtworkType][][]FanartTvImage{
+		ArtworkClearLogo: {images.HDMovieLogo, images.MovieLogo},
+		ArtworkClearArt:  {images.HDMovieClearArt},
+		ArtworkBanner:    {images.MovieBanner},
+		ArtworkLandscape: {images.MovieThumb},
+		ArtworkDiscArt:   {images.MovieDisc},
+		ArtworkPoster:    {images.MoviePoster},
+		ArtworkFanart:    {images.MovieBackground},
+	})
+}
+
+func (images FanartTvShowImages) Artwork() []Artwork {
+	return fanartTvArtwork(map[ArtworkType][][]FanartTvImage{
+		ArtworkClearLogo: {images.HDTvLogo, images.ClearLogo},
+		ArtworkClearArt:  {images.HDClearArt},
+		ArtworkBanner:    {images.TvBanner},
+		ArtworkLandscape: {images.TvThumb},
+		ArtworkPoster:    {images.TvPoster},
+		ArtworkFanart:    {images.ShowBackground},
+	})
+}
+
+// fanartTvArtwork flattens image lists of artwork types, e.g. HD and SD logos
+func fanartTvArtwork(lists map[ArtworkType][][]FanartTvImage) []Artwork {
+	var artwork []Artwork
+	for artworkType, list := range lists {
+		for _, images := range list {
+			for _, image := range images {
+				artwork = append(artwork, image.Artwork(artworkType))
+			}
+		}
+	}
+	return artwork
+}
+
+// load logos, banners, landscapes, disc and clear art from fanart.tv
+// movies are looked up by TMDb or IMDb id, TV Shows require TVDb id resolved via TMDb
+func (api FanartTvAPI) LoadArtwork(ctx context.Context, id MediaId, isTvShow bool, tmdbApi TMDbAPI) ([]Artwork, error) {
+	if isTvShow {
+		return api.loadTvShowArtwork(ctx, id, tmdbApi)
+	}
+	if id.idType != TMDB && id.idType != IMDB {
+		return nil, nil
+	}
+
+	url := fmt.Sprintf("https://webservice.fanart.tv/v3/movies/%s", id.id)
+	Log("fetching fanart.tv", id.id, url)
+
+	response, err := FetchURL(ctx, url, map[string]string{"api-key": api.ApiKey})
+	if err != nil {
+		return nil, err
+	}
+
+	var images FanartTvMovieImages
+	if err := json.Unmarshal(response, &images); err != nil {
+		return nil, err
+	}
+
+	return images.Artwork(), nil
+}
+
+func (api FanartTvAPI) loadTvShowArtwork(ctx context.Context, id MediaId, tmdbApi TMDbAPI) ([]Artwork, error) {
+	if id.idType != TMDB || tmdbApi.ApiKey == "" {
+		return nil, nil
+	}
+	externalIds, err := tmdbApi.LoadExternalIds(ctx, id.id, true)
+	if err != nil {
+		return nil, err
+	}
+	if externalIds.TVDbId == 0 {
+		return nil, nil
+	}
+
+	url := fmt.Sprintf("https://webservice.fanart.tv/v3/tv/%d", externalIds.TVDbId)
+	Log("fetching fanart.tv", externalIds.TVDbId, url)
+
+	response, err := FetchURL(ctx, url, map[string]string{"api-key": api.ApiKey})
+	if err != nil {
+		return nil, err
+	}
+
+	var images FanartTvShowImages
+	if err := json.Unmarshal(response, &images); err != nil {
+		return nil, err
+	}
+
+	return images.Artwork(), nil
+}
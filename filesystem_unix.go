@@ -0,0 +1,39 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileIdentity returns device, inode and hard link count of the path (symlinks are not followed)
+func fileIdentity(path Path) (FileIdentity, bool) {
+	info, err := os.Lstat(string(path))
+	if err != nil {
+		return FileIdentity{}, false
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return FileIdentity{}, false
+	}
+	return FileIdentity{Device: uint64(stat.Dev), Inode: uint64(stat.Ino), Links: uint64(stat.Nlink)}, true
+}
+
+// filesystemDevice returns the device ID of the filesystem the path (or its nearest existing parent) is stored on
+func filesystemDevice(path Path) (uint64, bool) {
+	for {
+		info, err := os.Stat(string(path))
+		if err == nil {
+			if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+				return uint64(stat.Dev), true
+			}
+			return 0, false
+		}
+		parent := path.removingLastPathComponent()
+		if parent == path {
+			return 0, false
+		}
+		path = parent
+	}
+}
@@ -0,0 +1,12 @@
+//go:build windows
+
+package main
+
+// device IDs and inodes are not exposed by os.Stat on Windows, callers fall back to volume names
+func fileIdentity(path Path) (FileIdentity, bool) {
+	return FileIdentity{}, false
+}
+
+func filesystemDevice(path Path) (uint64, bool) {
+	return 0, false
+}
@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"net/http"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -35,24 +34,31 @@ func Logf(format string, args ...interface{}) {
 	logger.Printf(format, args...)
 }
 
-func videoExistsInOutDirs(filePath Path, config Config) *Path {
+// find output items for a source media item
+// Kodi output items without naming templates are named after the source items,
+// others are looked up in the database or by video links regardless of their names
+func videoExistsInOutDirs(filePath Path, config Config, index *OutputIndex) []Path {
 	name := filePath.lastPathComponent()
-	moviesDir := findSuitableDirectoryForSymlink(filePath, config.Output.Movies)
-	moviesPath := moviesDir.appendingPathComponent(name)
-	if moviesPath.exists() {
-		return &moviesPath
+	moviesDir := config.findSuitableOutputDir(filePath, false)
+	moviesPath := moviesDir.Path.appendingPathComponent(name)
+	if moviesDir.usesSourceNames(false) && moviesPath.exists() {
+		return []Path{moviesPath}
 	}
 
-	seriesDir := findSuitableDirectoryForSymlink(filePath, config.Output.Series)
-	seriesPath := seriesDir.appendingPathComponent(name)
-	if seriesPath.exists() {
-		return &seriesPath
+	seriesDir := config.findSuitableOutputDir(filePath, true)
+	seriesPath := seriesDir.Path.appendingPathComponent(name)
+	if seriesDir.usesSourceNames(true) && seriesPath.exists() {
+		return []Path{seriesPath}
 	}
-	return nil
+
+	return index.findOutputItems(filePath, getVideoFiles(filePath))
 }
 
 func movieFileNameWithoutExtension(videoFiles []Path) string {
-	if len(videoFiles) == 1 {
+	if len(videoFiles) == 1 && videoFiles[0].isDirectory() {
+		// disc folder names have no extensions
+		return videoFiles[0].lastPathComponent()
+	} else if len(videoFiles) == 1 {
 		return string(videoFiles[0].removingPathExtension().lastPathComponent())
 	} else if len(videoFiles) == 2 {
 		commonPrefix := commonPrefix(videoFiles[0].lastPathComponent(), videoFiles[1].lastPathComponent())
@@ -68,23 +74,22 @@ func movieFileNameWithoutExtension(videoFiles []Path) string {
 	}
 }
 
-func writeMovieNfo(mediaInfo MediaFilesInfo, output Path) error {
-	fileName := movieFileNameWithoutExtension(mediaInfo.VideoFiles) + ".nfo"
-	filePath := output.appendingPathComponent(fileName)
-	Log("Writing Movie Nfo to", filePath)
+func writeMovieNfo(mediaInfo MediaInfo, release ReleaseName, streams StreamDetails, artwork []Artwork, nfoPath Path) error {
+	Log("Writing Movie Nfo to", nfoPath)
+	journal.recordWrite(nfoPath)
 	// Create or truncate the .nfo file
-	file, err := os.Create(string(filePath))
+	file, err := os.Create(string(nfoPath))
 	if err != nil {
 		return err
 	}
 	defer file.Close()
 
-	writeMovieNfoXML(file, mediaInfo.Info)
+	writeMovieNfoXML(file, mediaInfo, release, streams, artwork)
 
 	return nil
 }
 
-func writeMovieNfoXML(w io.Writer, mediaInfo MediaInfo) {
+func writeMovieNfoXML(w io.Writer, mediaInfo MediaInfo, release ReleaseName, streams StreamDetails, artwork []Artwork) {
 	enc := xml.NewEncoder(w)
 	enc.Indent("", "    ")
 
@@ -113,14 +118,20 @@ func writeMovieNfoXML(w io.Writer, mediaInfo MediaInfo) {
 	for _, genre := range mediaInfo.Genres {
 		enc.EncodeElement(genre, xml.StartElement{Name: xml.Name{Local: "genre"}})
 	}
+	if release.Edition != "" {
+		enc.EncodeElement(release.Edition, xml.StartElement{Name: xml.Name{Local: "edition"}})
+	}
+	writeArtworkXML(enc, artwork)
 	enc.EncodeElement(mediaInfo.Url, xml.StartElement{Name: xml.Name{Local: urlName}})
+	writeStreamDetailsXML(enc, streams)
 
 	enc.EncodeToken(xml.EndElement{Name: xml.Name{Local: "movie"}})
 	enc.Flush()
 }
 
-func writeTVShowNfo(mediaInfo MediaInfo, nfoPath Path) error {
+func writeTVShowNfo(mediaInfo MediaInfo, artwork []Artwork, nfoPath Path) error {
 	Log("Writing TVShow Nfo to", nfoPath)
+	journal.recordWrite(nfoPath)
 	// Create or truncate the .nfo file
 	file, err := os.Create(string(nfoPath))
 	if err != nil {
@@ -128,12 +139,12 @@ func writeTVShowNfo(mediaInfo MediaInfo, nfoPath Path) error {
 	}
 	defer file.Close()
 
-	writeTVShowNfoXML(file, mediaInfo)
+	writeTVShowNfoXML(file, mediaInfo, artwork)
 
 	return nil
 }
 
-func writeTVShowNfoXML(w io.Writer, mediaInfo MediaInfo) {
+func writeTVShowNfoXML(w io.Writer, mediaInfo MediaInfo, artwork []Artwork) {
 	enc := xml.NewEncoder(w)
 	enc.Indent("", "    ")
 
@@ -162,14 +173,35 @@ func writeTVShowNfoXML(w io.Writer, mediaInfo MediaInfo) {
 	for _, genre := range mediaInfo.Genres {
 		enc.EncodeElement(genre, xml.StartElement{Name: xml.Name{Local: "genre"}})
 	}
+	writeArtworkXML(enc, artwork)
 	enc.EncodeElement(mediaInfo.Url, xml.StartElement{Name: xml.Name{Local: urlName}})
 
 	enc.EncodeToken(xml.EndElement{Name: xml.Name{Local: "tvshow"}})
 	enc.Flush()
 }
 
-func writeEpisodeNfo(season int, episode int, title string, originalTitle string, mediaInfo MediaInfo, nfoPath Path) error {
+// write `<thumb aspect=...>` entries for downloaded artwork, fanart goes into `<fanart>`
+func writeArtworkXML(enc *xml.Encoder, artwork []Artwork) {
+	var fanart []Artwork
+	for _, art := range artwork {
+		if art.Type == ArtworkFanart {
+			fanart = append(fanart, art)
+			continue
+		}
+		enc.EncodeElement(art.Url, xml.StartElement{Name: xml.Name{Local: "thumb"}, Attr: []xml.Attr{{Name: xml.Name{Local: "aspect"}, Value: string(art.Type)}}})
+	}
+	if len(fanart) > 0 {
+		enc.EncodeToken(xml.StartElement{Name: xml.Name{Local: "fanart"}})
+		for _, art := range fanart {
+			enc.EncodeElement(art.Url, xml.StartElement{Name: xml.Name{Local: "thumb"}})
+		}
+		enc.EncodeToken(xml.EndElement{Name: xml.Name{Local: "fanart"}})
+	}
+}
+
+func writeEpisodeNfo(season int, episode int, title string, originalTitle string, mediaInfo MediaInfo, streams StreamDetails, nfoPath Path) error {
 	Log("Writing Episode Nfo to", nfoPath)
+	journal.recordWrite(nfoPath)
 	// Create or truncate the .nfo file
 	file, err := os.Create(string(nfoPath))
 	if err != nil {
@@ -177,12 +209,12 @@ func writeEpisodeNfo(season int, episode int, title string, originalTitle string
 	}
 	defer file.Close()
 
-	writeEpisodeNfoXML(file, season, episode, title, originalTitle, mediaInfo)
+	writeEpisodeNfoXML(file, season, episode, title, originalTitle, mediaInfo, streams)
 
 	return nil
 }
 
-func writeEpisodeNfoXML(w io.Writer, season int, episode int, title string, originalTitle string, mediaInfo MediaInfo) {
+func writeEpisodeNfoXML(w io.Writer, season int, episode int, title string, originalTitle string, mediaInfo MediaInfo, streams StreamDetails) {
 	enc := xml.NewEncoder(w)
 	enc.Indent("", "    ")
 
@@ -195,15 +227,72 @@ func writeEpisodeNfoXML(w io.Writer, season int, episode int, title string, orig
 
 	enc.EncodeElement(season, xml.StartElement{Name: xml.Name{Local: "season"}})
 	enc.EncodeElement(episode, xml.StartElement{Name: xml.Name{Local: "episode"}})
+	writeStreamDetailsXML(enc, streams)
 
 	enc.EncodeToken(xml.EndElement{Name: xml.Name{Local: "episodedetails"}})
 	enc.Flush()
 }
 
+// write `<fileinfo><streamdetails>` with the video, audio and subtitle streams
+func writeStreamDetailsXML(enc *xml.Encoder, streams StreamDetails) {
+	if len(streams.Video) == 0 && len(streams.Audio) == 0 && len(streams.Subtitles) == 0 {
+		return
+	}
+	element := func(name string, value interface{}) {
+		enc.EncodeElement(value, xml.StartElement{Name: xml.Name{Local: name}})
+	}
+
+	enc.EncodeToken(xml.StartElement{Name: xml.Name{Local: "fileinfo"}})
+	enc.EncodeToken(xml.StartElement{Name: xml.Name{Local: "streamdetails"}})
+	for _, video := range streams.Video {
+		enc.EncodeToken(xml.StartElement{Name: xml.Name{Local: "video"}})
+		if video.Codec != "" {
+			element("codec", video.Codec)
+		}
+		if video.Width > 0 && video.Height > 0 {
+			element("aspect", fmt.Sprintf("%.2f", float64(video.Width)/float64(video.Height)))
+			element("width", video.Width)
+			element("height", video.Height)
+		}
+		if streams.Duration > 0 {
+			element("durationinseconds", int(streams.Duration.Seconds()))
+		}
+		if video.HDR != "" {
+			element("hdrtype", video.HDR)
+		}
+		enc.EncodeToken(xml.EndElement{Name: xml.Name{Local: "video"}})
+	}
+	for _, audio := range streams.Audio {
+		enc.EncodeToken(xml.StartElement{Name: xml.Name{Local: "audio"}})
+		if audio.Codec != "" {
+			element("codec", audio.Codec)
+		}
+		if audio.Language != "" {
+			element("language", audio.Language)
+		}
+		if audio.Channels > 0 {
+			element("channels", audio.Channels)
+		}
+		enc.EncodeToken(xml.EndElement{Name: xml.Name{Local: "audio"}})
+	}
+	for _, subtitle := range streams.Subtitles {
+		enc.EncodeToken(xml.StartElement{Name: xml.Name{Local: "subtitle"}})
+		if subtitle.Language != "" {
+			element("language", subtitle.Language)
+		}
+		enc.EncodeToken(xml.EndElement{Name: xml.Name{Local: "subtitle"}})
+	}
+	enc.EncodeToken(xml.EndElement{Name: xml.Name{Local: "streamdetails"}})
+	enc.EncodeToken(xml.EndElement{Name: xml.Name{Local: "fileinfo"}})
+}
+
 type TVShow struct {
-	UniqueIds []UniqueId `xml:"uniqueid"`
-	URL       string     `xml:"url"`
-	TMDBURL   string     `xml:"tmdburl"`
+	Title         string     `xml:"title"`
+	OriginalTitle string     `xml:"originaltitle"`
+	Year          string     `xml:"year"`
+	UniqueIds     []UniqueId `xml:"uniqueid"`
+	URL           string     `xml:"url"`
+	TMDBURL       string     `xml:"tmdburl"`
 }
 
 type UniqueId struct {
@@ -211,43 +300,52 @@ type UniqueId struct {
 	Value string `xml:",chardata"`
 }
 
-func readTVShowNfo(path Path) (MediaId, error) {
+func readTVShowNfo(path Path) (MediaInfo, error) {
 	// Read the XML file
 	xmlFile, err := os.Open(string(path))
 	if err != nil {
-		return MediaId{}, err
+		return MediaInfo{}, err
 	}
 	defer xmlFile.Close()
 
 	// Read the XML content
 	byteValue, err := ioutil.ReadAll(xmlFile)
 	if err != nil {
-		return MediaId{}, err
+		return MediaInfo{}, err
 	}
 
 	// Parse the XML content
 	var tvShow TVShow
 	err = xml.Unmarshal(byteValue, &tvShow)
 	if err != nil {
-		return MediaId{}, err
+		return MediaInfo{}, err
 	}
 
+	mediaInfo := MediaInfo{
+		Title:         tvShow.Title,
+		OriginalTitle: tvShow.OriginalTitle,
+		Year:          tvShow.Year,
+		IsTvShow:      true,
+	}
 	imdbID := ""
 	for _, uniqueId := range tvShow.UniqueIds {
 		if uniqueId.Type == "tmdb" {
-			return MediaId{id: uniqueId.Value, idType: TMDB}, nil
+			mediaInfo.Id = MediaId{id: uniqueId.Value, idType: TMDB}
+			return mediaInfo, nil
 		} else if uniqueId.Type == "imdb" {
 			imdbID = uniqueId.Value
 		} else if uniqueId.Type == "kinopoisk" {
-			return MediaId{id: uniqueId.Value, idType: KPID}, nil
+			mediaInfo.Id = MediaId{id: uniqueId.Value, idType: KPID}
+			return mediaInfo, nil
 		}
 	}
 	if imdbID != "" {
-		return MediaId{id: imdbID, idType: IMDB}, nil
+		mediaInfo.Id = MediaId{id: imdbID, idType: IMDB}
+		return mediaInfo, nil
 	}
 
 	Log("could not id from TV Show NFO: uniqueIds", tvShow.UniqueIds)
-	return MediaId{}, nil
+	return mediaInfo, nil
 }
 
 // Function to get video contents at a specified path
@@ -324,13 +422,16 @@ func getSeasonEpisodeFromPath(filePath Path, videoFiles []Path) (int /*season*/,
 	return seasonNumber, episodeNumber
 }
 
-func linkVideoFileAndRelatedItems(videoFile Path, output Path, targetNameWithoutExtension string, multipart bool) error {
+// link the video file with subtitles, audio tracks etc. named alike into the output dir
+// returns the newly created links
+func linkVideoFileAndRelatedItems(videoFile Path, outputDir Path, targetNameWithoutExtension string, multipart bool, output OutputDir) ([]LinkedFile, error) {
 	name := strings.ToLower(videoFile.removingPathExtension().lastPathComponent())
 	dir := videoFile.removingLastPathComponent()
 	contents, err := dir.getDirectoryContents()
 	if err != nil {
-		return err
+		return nil, err
 	}
+	var linkedFiles []LinkedFile
 	for _, filePath := range contents {
 		if !strings.HasPrefix(strings.ToLower(filePath.lastPathComponent()), name+".") {
 			// Log("skipping", filePath.lastPathComponent(), "noprefix", name+".")
@@ -358,78 +459,38 @@ func linkVideoFileAndRelatedItems(videoFile Path, output Path, targetNameWithout
 		}
 
 		outName := targetNameWithoutExtension + "." + ext
-		outPath := output.appendingPathComponent(outName)
+		outPath := outputDir.appendingPathComponent(outName)
 
 		if outPath.exists() {
 			// Log(outPath, "exists")
 			continue
 		}
-		Log("creating link for", filePath.lastPathComponent(), "at", outPath)
+		Log("creating", output.linkMode(), "for", filePath.lastPathComponent(), "at", outPath)
 
-		err := os.Symlink(string(filePath), string(outPath))
+		err := output.linkFile(filePath, outPath)
 		if err != nil {
-			return err
+			return linkedFiles, err
 		}
+		linkedFile := LinkedFile{Source: filePath, Link: outPath, Mode: output.linkMode()}
+		journal.recordLinks([]LinkedFile{linkedFile})
+		linkedFiles = append(linkedFiles, linkedFile)
 	}
 
-	return nil
+	return linkedFiles, nil
 }
 
-func downloadImage(url string, filepath Path) error {
-	// In test mode, just create an empty file instead of downloading
-	if os.Getenv("TEST_MODE") == "true" {
-		Log("🧪 TEST MODE: Creating empty image file instead of downloading:", filepath)
-
-		// Ensure the directory exists
-		dir := Path(string(filepath.removingLastPathComponent()))
-		if !dir.exists() {
-			if err := os.MkdirAll(string(dir), 0755); err != nil {
-				return err
-			}
-		}
-
-		// Create an empty file
-		out, err := os.Create(string(filepath))
-		if err != nil {
-			return err
+// find the output directory on the same filesystem as the source (device IDs on Unix, volume names on Windows)
+func findSuitableDirectoryForSymlink(path Path, directories []OutputDir) OutputDir {
+	for _, directory := range directories {
+		if sameFilesystem(path, directory.Path) {
+			return directory
 		}
-		defer out.Close()
-
-		Logf("Empty image placeholder created at %s\n", filepath)
-		return nil
 	}
-
-	// Standard download for non-test mode
-	// Send GET request to fetch the image
-	resp, err := http.Get(url)
-	if err != nil {
-		return err
-	}
-	defer resp.Body.Close()
-
-	// Create the output file
-	out, err := os.Create(string(filepath))
-	if err != nil {
-		return err
-	}
-	defer out.Close()
-
-	// Copy the image data from the HTTP response body to the output file
-	_, err = io.Copy(out, resp.Body)
-	if err != nil {
-		return err
-	}
-
-	Logf("Image downloaded to %s\n", filepath)
-	return nil
-}
-
-func findSuitableDirectoryForSymlink(path Path, directories []Path) Path {
-	volumeName := filepath.VolumeName(string(path))
+	// symlinks and copies can be made across filesystems, hard links can't
 	for _, directory := range directories {
-		if filepath.VolumeName(string(directory)) == volumeName {
+		if directory.linkMode() != HardlinkMode {
 			return directory
 		}
 	}
-	return Path("")
+	return OutputDir{}
 }
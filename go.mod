@@ -9,6 +9,7 @@ require (
 	github.com/kazhuravlev/go-rutracker v1.0.0
 	github.com/mattn/go-sqlite3 v1.14.22
 	github.com/stretchr/testify v1.10.0
+	golang.org/x/image v0.15.0
 	golang.org/x/text v0.14.0
 )
 
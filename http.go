@@ -1,7 +1,7 @@
 package main
 
 import (
-	"fmt"
+	"context"
 	"io"
 	"net/http"
 	"os"
@@ -17,74 +17,40 @@ func init() {
 	CacheDir = filepath.Join(filepath.Dir(exePath), "cache")
 }
 
-func FetchURL(url string, headers map[string]string) ([]byte, error) {
-	// Replace invalid characters in the URL with underscores
-	validFilename := ReplaceInvalidFilenameChars(url) + ".txt"
-
-	// Generate a cache filename based on the URL
-	if !Path(CacheDir).isDirectory() {
-		err := os.MkdirAll(CacheDir, 0755)
-		if err != nil {
-			return nil, err
+// FetchURL returns the body of a successful GET response, fresh cached responses are used first
+func FetchURL(ctx context.Context, url string, headers map[string]string) ([]byte, error) {
+	provider := cacheProviderForURL(url)
+	key := redactURL(url)
+	if cached, ok := loadCachedResponse(provider, key); ok {
+		Log("🔄 Using cached data:", key)
+		if cached.Status != http.StatusOK {
+			return nil, &HTTPStatusError{Url: key, StatusCode: cached.Status}
 		}
+		return cached.Body, nil
 	}
-	cacheFilename := filepath.Join(CacheDir, validFilename)
 
-	// Check if the cached data exists
-	if _, err := os.Stat(cacheFilename); err == nil {
-		// If cached data exists, read and return it
-		if os.Getenv("TEST_MODE") == "true" {
-			Log("🔄 TEST MODE: Using cached data:", validFilename)
-		} else {
-			Log("🔄 Using cached data:", validFilename)
-		}
-		return os.ReadFile(cacheFilename)
-	}
-
-	// Cache miss - making a real HTTP request
-	if os.Getenv("TEST_MODE") == "true" {
-		Log("💥💥💥 TEST MODE: Making real HTTP request (cache miss) for:", url)
-	}
-
-	// Otherwise, make an HTTP request
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	// Set headers
-	for key, value := range headers {
-		req.Header.Set(key, value)
-	}
-
-	// Perform the HTTP request
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := httpClient.do(ctx, http.MethodGet, url, headers, nil)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	// Read the response body
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return nil, err
 	}
 
-	// If status is not 200, return the error
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("HTTP request %s failed with status: %d", url, resp.StatusCode)
-	}
-
-	// Write the response body to the cache file
-	err = os.WriteFile(cacheFilename, body, 0644)
-	if err != nil {
-		Log("Error writing cache file:", err)
+	// missing items are cached too, so they aren't requested on every run
+	if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusNotFound {
+		header := resp.Header.Clone()
+		header.Del("Set-Cookie")
+		if err := storeCachedResponse(CachedResponse{Key: key, Provider: provider, Status: resp.StatusCode, Header: header, Body: body}); err != nil {
+			Log("Error writing cache file:", err)
+		}
 	}
 
-	// Cache successful response
-	if os.Getenv("TEST_MODE") == "true" {
-		Log("📥 TEST MODE: Cached response for future test runs:", url)
+	if resp.StatusCode != http.StatusOK {
+		return nil, &HTTPStatusError{Url: key, StatusCode: resp.StatusCode}
 	}
-
 	return body, nil
 }
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// HTTPConfig configures the HTTP client shared by all providers
+type HTTPConfig struct {
+	// timeout of a single request attempt, 30 seconds by default
+	TimeoutSeconds int `json:"timeout_seconds,omitempty"`
+	// proxy URL, e.g. `http://proxy:3128` or `socks5://localhost:1080`; HTTP_PROXY/HTTPS_PROXY are used by default
+	Proxy string `json:"proxy,omitempty"`
+	// User-Agent sent unless a provider sets its own
+	UserAgent string `json:"user_agent,omitempty"`
+	// retries on network errors, 429 and 5xx responses, 3 by default
+	MaxRetries int `json:"max_retries,omitempty"`
+}
+
+const defaultUserAgent = "media-files-scraper/1.0"
+
+// maximum backoff between attempts, longer Retry-After values are honored as is
+const maxRetryBackoff = time.Minute
+
+// HTTPClient applies timeouts, rate limits and retries with backoff to requests; it's safe for concurrent use
+type HTTPClient struct {
+	client     *http.Client
+	userAgent  string
+	maxRetries int
+	// delay before the first retry, doubled for each next one
+	retryDelay time.Duration
+}
+
+var httpClient = newHTTPClient(HTTPConfig{})
+
+func newHTTPClient(config HTTPConfig) *HTTPClient {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if config.Proxy != "" {
+		if proxyURL, err := url.Parse(config.Proxy); err == nil {
+			transport.Proxy = http.ProxyURL(proxyURL)
+		} else {
+			Log("❌ invalid proxy URL", config.Proxy, err)
+		}
+	}
+	timeout := 30 * time.Second
+	if config.TimeoutSeconds > 0 {
+		timeout = time.Duration(config.TimeoutSeconds) * time.Second
+	}
+	maxRetries := 3
+	if config.MaxRetries > 0 {
+		maxRetries = config.MaxRetries
+	}
+	return &HTTPClient{
+		client:     &http.Client{Transport: transport, Timeout: timeout},
+		userAgent:  Coalesce(config.UserAgent, defaultUserAgent),
+		maxRetries: maxRetries,
+		retryDelay: time.Second,
+	}
+}
+
+// configureHTTPClient applies `http` from the config
+func configureHTTPClient(config HTTPConfig) {
+	httpClient = newHTTPClient(config)
+}
+
+// HTTPStatusError is returned for unsuccessful responses after retries
+type HTTPStatusError struct {
+	Url        string
+	StatusCode int
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("HTTP request %s failed with status: %d", e.Url, e.StatusCode)
+}
+
+// do sends the request retrying network errors, 429 and 5xx responses;
+// the caller closes the body of the returned response, which may have any status
+func (c *HTTPClient) do(ctx context.Context, method string, url string, headers map[string]string, body []byte) (*http.Response, error) {
+	delay := c.retryDelay
+	for attempt := 0; ; attempt++ {
+		if err := waitForRateLimit(ctx, url, attempt > 0); err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("User-Agent", c.userAgent)
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+
+		resp, err := c.client.Do(req)
+		retryable := err != nil || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		if !retryable || attempt >= c.maxRetries || ctx.Err() != nil {
+			return resp, err
+		}
+
+		wait := delay
+		if err == nil {
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+				wait = retryAfter
+			}
+			resp.Body.Close()
+			Logf("⏳ %s returned %d, retrying in %s\n", url, resp.StatusCode, wait)
+		} else {
+			Logf("⏳ %s failed: %s, retrying in %s\n", url, err, wait)
+		}
+		if err := sleepContext(ctx, wait); err != nil {
+			return nil, err
+		}
+		if delay *= 2; delay > maxRetryBackoff {
+			delay = maxRetryBackoff
+		}
+	}
+}
+
+// get returns the body of a successful GET response
+func (c *HTTPClient) get(ctx context.Context, url string, headers map[string]string) ([]byte, error) {
+	resp, err := c.do(ctx, http.MethodGet, url, headers, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &HTTPStatusError{Url: url, StatusCode: resp.StatusCode}
+	}
+	return body, nil
+}
+
+// parseRetryAfter reads delay seconds or an HTTP date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if wait := time.Until(date); wait > 0 {
+			return wait, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// sleepContext sleeps unless the context is cancelled first
+func sleepContext(ctx context.Context, duration time.Duration) error {
+	if duration <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
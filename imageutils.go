@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	_ "image/gif"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// delay before the first download retry, doubled on every next attempt
+var imageDownloadRetryDelay = 2 * time.Second
+
+// images larger than that are not artwork
+const maxImageDownloadSize = 50 << 20
+
+type ImageDownloadError struct {
+	url       string
+	reason    string
+	retryable bool
+}
+
+func (e *ImageDownloadError) Error() string {
+	return fmt.Sprintf("could not download image %s: %s", e.url, e.reason)
+}
+
+func downloadImage(ctx context.Context, url string, filepath Path, config ArtworkConfig) error {
+	var err error
+	delay := imageDownloadRetryDelay
+	for attempt := 1; attempt <= config.downloadAttempts(); attempt++ {
+		if attempt > 1 {
+			Logf("retrying image download in %s (attempt %d): %s\n", delay, attempt, err)
+			if err := sleepContext(ctx, delay); err != nil {
+				return err
+			}
+			delay *= 2
+		}
+		err = downloadImageAttempt(ctx, url, filepath, config)
+		if err == nil {
+			Logf("Image downloaded to %s\n", filepath)
+			return nil
+		}
+		if downloadErr, ok := err.(*ImageDownloadError); ok && !downloadErr.retryable {
+			break
+		}
+	}
+	return err
+}
+
+func downloadImageAttempt(ctx context.Context, url string, filepath Path, config ArtworkConfig) error {
+	resp, err := httpClient.do(ctx, http.MethodGet, url, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return &ImageDownloadError{
+			url:    url,
+			reason: fmt.Sprintf("HTTP status %d", resp.StatusCode),
+			// rate limiting and server errors are already retried by the HTTP client
+			retryable: false,
+		}
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxImageDownloadSize+1))
+	if err != nil {
+		return err
+	}
+	if len(data) > maxImageDownloadSize {
+		return &ImageDownloadError{url: url, reason: "image is too large"}
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" || strings.HasPrefix(contentType, "application/octet-stream") {
+		contentType = http.DetectContentType(data)
+	}
+	if !strings.HasPrefix(contentType, "image/") {
+		return &ImageDownloadError{url: url, reason: "unexpected content type " + contentType}
+	}
+
+	// decode the image to make sure it's complete and valid
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		// likely a truncated response – worth retrying
+		return &ImageDownloadError{url: url, reason: "invalid image: " + err.Error(), retryable: true}
+	}
+
+	// re-encode if downscaled or if the format doesn't match the file extension;
+	// transparent images stay PNG, JPEG would lose the transparency
+	resized := downscaleImage(img, config.MaxWidth, config.MaxHeight)
+	ext := strings.ToLower(filepath.extension())
+	encoding := ext
+	if format == "png" && hasTransparency(img) {
+		encoding = "png"
+	}
+	if resized != img || !imageFormatMatchesExtension(format, encoding) {
+		var buf bytes.Buffer
+		if encoding == "png" {
+			err = png.Encode(&buf, resized)
+		} else {
+			err = jpeg.Encode(&buf, resized, &jpeg.Options{Quality: config.jpegQuality()})
+		}
+		if err != nil {
+			return err
+		}
+		Logf("re-encoded %s image %dx%d as %s %dx%d\n", format, img.Bounds().Dx(), img.Bounds().Dy(), encoding, resized.Bounds().Dx(), resized.Bounds().Dy())
+		data = buf.Bytes()
+	}
+
+	return writeFileAtomically(filepath, data)
+}
+
+func imageFormatMatchesExtension(format string, ext string) bool {
+	switch ext {
+	case "jpg", "jpeg":
+		return format == "jpeg"
+	default:
+		return format == ext
+	}
+}
+
+// hasTransparency tells whether any pixel of the image is not fully opaque
+func hasTransparency(img image.Image) bool {
+	if opaque, ok := img.(interface{ Opaque() bool }); ok {
+		return !opaque.Opaque()
+	}
+	return false
+}
+
+// scale the image down to fit into maxWidth x maxHeight keeping the aspect ratio
+// returns the original image if it already fits or no limits are set
+func downscaleImage(img image.Image, maxWidth int, maxHeight int) image.Image {
+	width := img.Bounds().Dx()
+	height := img.Bounds().Dy()
+	scale := 1.0
+	if maxWidth > 0 && width > maxWidth {
+		scale = float64(maxWidth) / float64(width)
+	}
+	if maxHeight > 0 && float64(height)*scale > float64(maxHeight) {
+		scale = float64(maxHeight) / float64(height)
+	}
+	if scale >= 1 {
+		return img
+	}
+
+	bounds := image.Rect(0, 0, max(1, int(float64(width)*scale+0.5)), max(1, int(float64(height)*scale+0.5)))
+	dst := image.NewRGBA(bounds)
+	draw.CatmullRom.Scale(dst, bounds, img, img.Bounds(), draw.Over, nil)
+	return dst
+}
+
+// write data to a temporary file next to the destination and rename it over the destination
+// so an interrupted write never leaves a truncated file behind
+func writeFileAtomically(filepath Path, data []byte) error {
+	dir := filepath.removingLastPathComponent()
+	tmpFile, err := os.CreateTemp(string(dir), "."+filepath.lastPathComponent()+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmpFile.Name()
+
+	_, err = tmpFile.Write(data)
+	if err == nil {
+		err = tmpFile.Sync()
+	}
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmpPath, 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, string(filepath))
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
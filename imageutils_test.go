@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+)
+
+// setupImageDownloadTest disables retry delays
+func setupImageDownloadTest(t *testing.T) Path {
+
+	originalDelay := imageDownloadRetryDelay
+	originalClient := httpClient
+	imageDownloadRetryDelay = 0
+	httpClient = newHTTPClient(HTTPConfig{})
+	httpClient.retryDelay = 0
+	t.Cleanup(func() {
+		imageDownloadRetryDelay = originalDelay
+		httpClient = originalClient
+	})
+
+	return Path(t.TempDir())
+}
+
+func encodeTestImage(t *testing.T, width int, height int, format string) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 128, 255})
+		}
+	}
+	var buf bytes.Buffer
+	var err error
+	if format == "png" {
+		err = png.Encode(&buf, img)
+	} else {
+		err = jpeg.Encode(&buf, img, nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// assertDirContains checks the directory has exactly the expected files (no leftover temp files)
+func assertDirContains(t *testing.T, dir Path, expected ...string) {
+	entries, err := os.ReadDir(string(dir))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if len(names) != len(expected) {
+		t.Fatalf("expected files %v in %s, got %v", expected, dir, names)
+	}
+	for idx, name := range expected {
+		if names[idx] != name {
+			t.Fatalf("expected files %v in %s, got %v", expected, dir, names)
+		}
+	}
+}
+
+func TestDownloadImageValid(t *testing.T) {
+	dir := setupImageDownloadTest(t)
+	data := encodeTestImage(t, 40, 20, "jpeg")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	path := dir.appendingPathComponent("movie-poster.jpg")
+	if err := downloadImage(context.Background(), server.URL, path, ArtworkConfig{}); err != nil {
+		t.Fatalf("download failed: %v", err)
+	}
+	written, err := os.ReadFile(string(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(written, data) {
+		t.Errorf("image was re-encoded although no resizing was needed")
+	}
+	assertDirContains(t, dir, "movie-poster.jpg")
+}
+
+func TestDownloadImageNotFoundIsNotRetried(t *testing.T) {
+	dir := setupImageDownloadTest(t)
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	err := downloadImage(context.Background(), server.URL, dir.appendingPathComponent("poster.jpg"), ArtworkConfig{DownloadAttempts: 3})
+	if err == nil {
+		t.Fatal("expected an error for 404 response")
+	}
+	if requests != 1 {
+		t.Errorf("expected 1 request, got %d", requests)
+	}
+	assertDirContains(t, dir)
+}
+
+func TestDownloadImageRetriesServerErrors(t *testing.T) {
+	dir := setupImageDownloadTest(t)
+	data := encodeTestImage(t, 10, 10, "png")
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	path := dir.appendingPathComponent("clearlogo.png")
+	if err := downloadImage(context.Background(), server.URL, path, ArtworkConfig{DownloadAttempts: 3}); err != nil {
+		t.Fatalf("download failed: %v", err)
+	}
+	if requests != 3 {
+		t.Errorf("expected 3 requests, got %d", requests)
+	}
+	assertDirContains(t, dir, "clearlogo.png")
+}
+
+func TestDownloadImageRejectsNonImageContent(t *testing.T) {
+	dir := setupImageDownloadTest(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html>captcha</html>"))
+	}))
+	defer server.Close()
+
+	if err := downloadImage(context.Background(), server.URL, dir.appendingPathComponent("poster.jpg"), ArtworkConfig{}); err == nil {
+		t.Fatal("expected an error for html response")
+	}
+	assertDirContains(t, dir)
+}
+
+func TestDownloadImageRejectsTruncatedImage(t *testing.T) {
+	dir := setupImageDownloadTest(t)
+	data := encodeTestImage(t, 40, 40, "jpeg")
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Write(data[:len(data)/3])
+	}))
+	defer server.Close()
+
+	path := dir.appendingPathComponent("poster.jpg")
+	// existing file must survive a failed download
+	if err := os.WriteFile(string(path), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := downloadImage(context.Background(), server.URL, path, ArtworkConfig{DownloadAttempts: 2}); err == nil {
+		t.Fatal("expected an error for truncated image")
+	}
+	if requests != 2 {
+		t.Errorf("expected 2 requests, got %d", requests)
+	}
+	if content, _ := os.ReadFile(string(path)); string(content) != "old" {
+		t.Errorf("existing file was overwritten")
+	}
+	assertDirContains(t, dir, "poster.jpg")
+}
+
+func TestDownloadImageDownscales(t *testing.T) {
+	dir := setupImageDownloadTest(t)
+	data := encodeTestImage(t, 200, 100, "png")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	path := dir.appendingPathComponent("movie-fanart.jpg")
+	if err := downloadImage(context.Background(), server.URL, path, ArtworkConfig{MaxWidth: 100, MaxHeight: 100}); err != nil {
+		t.Fatalf("download failed: %v", err)
+	}
+	file, err := os.Open(string(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	config, format, err := image.DecodeConfig(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "jpeg" || config.Width != 100 || config.Height != 50 {
+		t.Errorf("expected 100x50 jpeg, got %dx%d %s", config.Width, config.Height, format)
+	}
+	assertDirContains(t, dir, filepath.Base(string(path)))
+}
+
+func TestDownloadImageKeepsTransparency(t *testing.T) {
+	dir := setupImageDownloadTest(t)
+	img := image.NewNRGBA(image.Rect(0, 0, 200, 100))
+	img.Set(150, 50, color.NRGBA{255, 0, 0, 255})
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(buf.Bytes())
+	}))
+	defer server.Close()
+
+	path := dir.appendingPathComponent("movie-poster.jpg")
+	if err := downloadImage(context.Background(), server.URL, path, ArtworkConfig{MaxWidth: 100, MaxHeight: 100}); err != nil {
+		t.Fatalf("download failed: %v", err)
+	}
+	data, err := os.ReadFile(string(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "png" || saved.Bounds().Dx() != 100 || !hasTransparency(saved) {
+		t.Errorf("expected transparent 100px wide png, got %dpx %s", saved.Bounds().Dx(), format)
+	}
+}
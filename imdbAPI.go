@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"net/url"
 	"regexp"
@@ -14,7 +15,7 @@ type IMDbAPI struct {
 	GenresMap map[string]string
 }
 
-func (api IMDbAPI) FindMovies(titlestr string, year string, page int) (MovieSearchResult, error) {
+func (api IMDbAPI) FindMovies(ctx context.Context, titlestr string, year string, page int) (MovieSearchResult, error) {
 	title := strings.ReplaceAll(titlestr, "'", "")
 	query := url.QueryEscape(title)
 	searchURL := fmt.Sprintf("https://www.imdb.com/find?q=%s&s=tt|accept-language=ru-ru", query)
@@ -25,7 +26,7 @@ func (api IMDbAPI) FindMovies(titlestr string, year string, page int) (MovieSear
 	}
 	Log("fetching imdb", title, searchURL)
 
-	response, err := FetchURL(searchURL, map[string]string{
+	response, err := FetchURL(ctx, searchURL, map[string]string{
 		"User-Agent": "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/58.0.3029.110 Safari/537.36",
 	})
 	if err != nil {
@@ -95,12 +96,12 @@ func (api IMDbAPI) FindMovies(titlestr string, year string, page int) (MovieSear
 	}, nil
 }
 
-func (api IMDbAPI) LoadMediaInfo(id string, tmdbApi TMDbAPI) (MediaInfo, error) {
+func (api IMDbAPI) LoadMediaInfo(ctx context.Context, id string, tmdbApi TMDbAPI) (MediaInfo, error) {
 	// try loading from tmdb by imdb id first
 	var mediaInfo MediaInfo
 	var err error
 	if tmdbApi.ApiKey != "" {
-		mediaInfo, err = tmdbApi.findTMDbByIMDbID(id)
+		mediaInfo, err = tmdbApi.findTMDbByIMDbID(ctx, id)
 	}
 	if err == nil && mediaInfo.PosterUrl != "" {
 		return mediaInfo, nil
@@ -111,7 +112,7 @@ func (api IMDbAPI) LoadMediaInfo(id string, tmdbApi TMDbAPI) (MediaInfo, error)
 
 	Log("fetching imdb", id, imdbURL)
 
-	response, err := FetchURL(imdbURL, map[string]string{
+	response, err := FetchURL(ctx, imdbURL, map[string]string{
 		"User-Agent":      "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/58.0.3029.110 Safari/537.36",
 		"Accept-Language": "ru-RU,ru;q=0.9",
 	})
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JournalAction is a kind of change made by a sync run
+type JournalAction string
+
+const (
+	// a source file linked (or copied) into an output directory
+	LinkAction JournalAction = "link"
+	// an NFO file written, the previous contents are kept when it is overwritten
+	WriteAction JournalAction = "write"
+	// an artwork image downloaded
+	ImageAction JournalAction = "image"
+	// a directory created in an output directory
+	MkdirAction JournalAction = "mkdir"
+	// a torrent moved from the unsorted directory by Transmission
+	TorrentMoveAction JournalAction = "torrent_move"
+	// an orphaned output item moved to the trash
+	TrashAction JournalAction = "trash"
+	// an output item recorded in the database
+	RecordAction JournalAction = "record"
+)
+
+const journalDirName = "journal"
+const rolledBackSuffix = ".rolled-back"
+
+// run ids sort in the start order
+const journalRunIdFormat = trashFolderDateFormat + ".000"
+
+// JournalEntry is a line of the run journal
+type JournalEntry struct {
+	Time   time.Time     `json:"time"`
+	Action JournalAction `json:"action"`
+	Path   Path          `json:"path,omitempty"`
+	Source Path          `json:"source,omitempty"`
+	// sources of a trashed output item
+	Sources   []Path   `json:"sources,omitempty"`
+	Target    Path     `json:"target,omitempty"`
+	Mode      LinkMode `json:"mode,omitempty"`
+	TorrentId int64    `json:"torrent_id,omitempty"`
+	From      Path     `json:"from,omitempty"`
+	To        Path     `json:"to,omitempty"`
+	Replaced  bool     `json:"replaced,omitempty"`
+	Previous  []byte   `json:"previous,omitempty"`
+}
+
+// Journal records changes of a sync run so `rollback` can revert them
+type Journal struct {
+	RunId string
+	file  *os.File
+	mutex sync.Mutex
+}
+
+// journal of the running sync, nil when changes are not recorded
+var journal *Journal
+
+func journalDir() Path {
+	return Path(CacheDir).appendingPathComponent(journalDirName)
+}
+
+// startJournal creates the journal of a new run named after its start time,
+// runs started at the same millisecond get numbered suffixes instead of sharing a journal
+func startJournal(started time.Time) (*Journal, error) {
+	if err := os.MkdirAll(string(journalDir()), 0755); err != nil {
+		return nil, err
+	}
+	baseId := started.Format(journalRunIdFormat)
+	for attempt := 1; ; attempt++ {
+		runId := baseId
+		if attempt > 1 {
+			runId += fmt.Sprintf("-%d", attempt)
+		}
+		file, err := os.OpenFile(string(journalDir().appendingPathComponent(runId+".jsonl")), os.O_EXCL|os.O_CREATE|os.O_WRONLY, 0644)
+		if os.IsExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		Log("📒 journaling run", runId)
+		return &Journal{RunId: runId, file: file}, nil
+	}
+}
+
+func (j *Journal) Close() error {
+	if j == nil {
+		return nil
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	return j.file.Close()
+}
+
+// record appends the entry right away, so an interrupted run can be rolled back too
+func (j *Journal) record(entry JournalEntry) {
+	if j == nil {
+		return
+	}
+	entry.Time = time.Now()
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	if err := json.NewEncoder(j.file).Encode(entry); err != nil {
+		Log("❌ failed to write journal entry", entry.Action, entry.Path, err)
+	}
+}
+
+func (j *Journal) recordLinks(linkedFiles []LinkedFile) {
+	for _, linkedFile := range linkedFiles {
+		j.record(JournalEntry{Action: LinkAction, Path: linkedFile.Link, Source: linkedFile.Source, Mode: linkedFile.Mode})
+	}
+}
+
+// recordWrite must be called before the file is written to keep its previous contents
+func (j *Journal) recordWrite(path Path) {
+	if j == nil {
+		return
+	}
+	entry := JournalEntry{Action: WriteAction, Path: path}
+	if data, err := os.ReadFile(string(path)); err == nil {
+		entry.Replaced = true
+		entry.Previous = data
+	}
+	j.record(entry)
+}
+
+// mkdirAllJournaled creates the directory with its parents and records the topmost created one
+func mkdirAllJournaled(path Path) error {
+	created := Path("")
+	for dir := path; !dir.exists(); dir = dir.removingLastPathComponent() {
+		created = dir
+		if dir.removingLastPathComponent() == dir {
+			break
+		}
+	}
+	if err := os.MkdirAll(string(path), 0755); err != nil {
+		return err
+	}
+	if created != "" {
+		journal.record(JournalEntry{Action: MkdirAction, Path: created})
+	}
+	return nil
+}
+
+// journalRuns lists run ids of the journals, oldest first; rolled back runs are included when asked
+func journalRuns(includeRolledBack bool) ([]string, error) {
+	contents, err := journalDir().getDirectoryContents()
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var runs []string
+	for _, path := range contents {
+		name := path.lastPathComponent()
+		if !strings.HasSuffix(name, ".jsonl") {
+			continue
+		}
+		runId := strings.TrimSuffix(name, ".jsonl")
+		if strings.HasSuffix(runId, rolledBackSuffix) && !includeRolledBack {
+			continue
+		}
+		runs = append(runs, runId)
+	}
+	sort.Strings(runs)
+	return runs, nil
+}
+
+func readJournal(path Path) ([]JournalEntry, error) {
+	file, err := os.Open(string(path))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []JournalEntry
+	scanner := bufio.NewScanner(file)
+	// previous NFO contents make long lines
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var entry JournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// the last line of an interrupted run may be incomplete
+			Log("⚠️ skipping broken journal line in", path, err)
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// runRollback reverts the changes of a sync run in reverse order; the runs are listed when runId is empty.
+// Only the latest run not rolled back yet is reverted unless forced, since later runs may depend on its changes.
+// Reverting is repeatable, so a failed rollback can be retried.
+func runRollback(ctx context.Context, config Config, runId string, force bool) error {
+	if runId == "" {
+		runs, err := journalRuns(true)
+		if err != nil {
+			return err
+		}
+		if len(runs) == 0 {
+			return fmt.Errorf("no journaled runs in %s", journalDir())
+		}
+		Log("Journaled runs:")
+		for _, run := range runs {
+			Log("  ", run)
+		}
+		return fmt.Errorf("specify the run to roll back: rollback <run-id>")
+	}
+
+	if !force {
+		runs, err := journalRuns(false)
+		if err != nil {
+			return err
+		}
+		if idx := findIndex(runs, runId); idx != -1 && idx < len(runs)-1 {
+			return fmt.Errorf("later runs %v are not rolled back, roll them back first or use -force-rollback", runs[idx+1:])
+		}
+	}
+
+	journalPath := journalDir().appendingPathComponent(runId + ".jsonl")
+	entries, err := readJournal(journalPath)
+	if err != nil {
+		return err
+	}
+
+	index, err := buildOutputIndex(config)
+	if err != nil {
+		return err
+	}
+	defer index.Close()
+
+	failed := 0
+	for i := len(entries) - 1; i >= 0; i-- {
+		if err := revertJournalEntry(ctx, entries[i], config, index); err != nil {
+			Log("❌ could not revert", entries[i].Action, entries[i].Path, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d changes of run %s could not be reverted", failed, len(entries), runId)
+	}
+
+	Logf("⏪ rolled back %d changes of run %s\n", len(entries), runId)
+	return os.Rename(string(journalPath), string(journalDir().appendingPathComponent(runId+rolledBackSuffix+".jsonl")))
+}
+
+func revertJournalEntry(ctx context.Context, entry JournalEntry, config Config, index *OutputIndex) error {
+	switch entry.Action {
+	case LinkAction, ImageAction:
+		Log("⏪ removing", entry.Path)
+		return removeIfExists(entry.Path)
+
+	case WriteAction:
+		if entry.Replaced {
+			Log("⏪ restoring", entry.Path)
+			return writeFileAtomically(entry.Path, entry.Previous)
+		}
+		Log("⏪ removing", entry.Path)
+		return removeIfExists(entry.Path)
+
+	case MkdirAction:
+		// directories are kept if anything was put there after the run
+		removeEmptyDirectories(entry.Path)
+		if entry.Path.exists() {
+			Log("⚠️ keeping non-empty directory", entry.Path)
+		}
+		return nil
+
+	case TorrentMoveAction:
+		Log("⏪ moving torrent", entry.TorrentId, "back to", entry.From)
+		return moveTorrent(ctx, entry.TorrentId, entry.From, config.Transmission.Rpc)
+
+	case TrashAction:
+		return restoreFromTrash(entry, index)
+
+	case RecordAction:
+		return index.forgetOutputItemSource(entry.Source, entry.Path)
+
+	default:
+		return fmt.Errorf("unknown journal action `%s`", entry.Action)
+	}
+}
+
+// restoreFromTrash moves the trashed item back and drops it from the trash manifest;
+// an item restored by an interrupted rollback is left as is
+func restoreFromTrash(entry JournalEntry, index *OutputIndex) error {
+	if entry.Path.exists() && !entry.Target.exists() {
+		Log("⏪ already restored", entry.Path)
+	} else {
+		if entry.Path.exists() {
+			return fmt.Errorf("%s already exists, keeping %s in the trash", entry.Path, entry.Target)
+		}
+		Log("⏪ restoring", entry.Path, "from the trash")
+		if err := os.MkdirAll(string(entry.Path.removingLastPathComponent()), 0755); err != nil {
+			return err
+		}
+		if err := os.Rename(string(entry.Target), string(entry.Path)); err != nil {
+			return err
+		}
+	}
+	for _, source := range entry.Sources {
+		if err := index.recordOutputItem(source, entry.Path); err != nil {
+			Log("❌ failed to record output item", entry.Path, err)
+		}
+	}
+
+	items, err := readTrashManifest(entry.From.appendingPathComponent(trashManifestName))
+	if os.IsNotExist(err) {
+		// the trash folder is gone with its last item
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var remaining []trashedItem
+	for _, item := range items {
+		if item.Trashed != entry.Target {
+			remaining = append(remaining, item)
+		}
+	}
+	return writeTrashManifest(entry.From, remaining)
+}
+
+func removeIfExists(path Path) error {
+	if err := os.Remove(string(path)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
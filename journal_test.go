@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestRollbackRevertsRun(t *testing.T) {
+	originalCacheDir := CacheDir
+	defer func() { CacheDir = originalCacheDir }()
+	dir := Path(t.TempDir())
+	CacheDir = string(dir.appendingPathComponent("cache"))
+
+	mediaDir := dir.appendingPathComponent("media")
+	output := OutputDir{Path: dir.appendingPathComponent("kodi")}
+	for _, path := range []Path{mediaDir, output.Path} {
+		if err := os.MkdirAll(string(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	source := mediaDir.appendingPathComponent("Movie.mkv")
+	if err := os.WriteFile(string(source), []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	existingNfo := output.Path.appendingPathComponent("Old.nfo")
+	if err := os.WriteFile(string(existingNfo), []byte("old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var err error
+	journal, err = startJournal(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	runId := journal.RunId
+	movieDir := output.Path.appendingPathComponent("Movie (2020)")
+	if err := mkdirAllJournaled(movieDir.appendingPathComponent("extras")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := linkVideoFileAndRelatedItems(source, movieDir, "Movie", false, output); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeMovieNfo(MediaInfo{Title: "Movie"}, ReleaseName{}, StreamDetails{}, nil, movieDir.appendingPathComponent("Movie.nfo")); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeMovieNfo(MediaInfo{Title: "Old"}, ReleaseName{}, StreamDetails{}, nil, existingNfo); err != nil {
+		t.Fatal(err)
+	}
+	journal.Close()
+	journal = nil
+
+	config := Config{Directories: []Path{mediaDir}, Output: OutputConfig{Movies: []OutputDir{output}}}
+	if err := runRollback(context.Background(), config, runId, false); err != nil {
+		t.Fatal(err)
+	}
+	if movieDir.exists() {
+		t.Errorf("created movie folder was not removed")
+	}
+	if data, _ := os.ReadFile(string(existingNfo)); string(data) != "old" {
+		t.Errorf("overwritten file was not restored, got %q", data)
+	}
+	if !source.exists() {
+		t.Errorf("source file must be kept")
+	}
+	if runs, _ := journalRuns(false); len(runs) != 0 {
+		t.Errorf("rolled back run should not be listed, got %v", runs)
+	}
+}
+
+func TestRollbackOrderAndRetry(t *testing.T) {
+	originalCacheDir := CacheDir
+	defer func() { CacheDir = originalCacheDir }()
+	dir := Path(t.TempDir())
+	CacheDir = string(dir.appendingPathComponent("cache"))
+
+	// runs started at once get journals of their own
+	started := time.Now()
+	first, err := startJournal(started)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.Close()
+	second, err := startJournal(started)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second.Close()
+	if first.RunId == second.RunId {
+		t.Fatalf("runs share the id %s", first.RunId)
+	}
+
+	config := Config{}
+	if err := runRollback(context.Background(), config, first.RunId, false); err == nil {
+		t.Errorf("expected an error rolling back a run followed by another one")
+	}
+	if err := runRollback(context.Background(), config, first.RunId, true); err != nil {
+		t.Errorf("forced rollback failed: %v", err)
+	}
+	if err := runRollback(context.Background(), config, second.RunId, false); err != nil {
+		t.Errorf("rollback of the latest run failed: %v", err)
+	}
+
+	// an item restored by an interrupted rollback is skipped by its retry
+	output := OutputDir{Path: dir.appendingPathComponent("out")}
+	item := output.Path.appendingPathComponent("Movie (2020)")
+	if err := os.MkdirAll(string(item), 0755); err != nil {
+		t.Fatal(err)
+	}
+	journal, err = startJournal(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	runId := journal.RunId
+	trashFolder := output.Path.appendingPathComponent(trashDirName).appendingPathComponent("trashed")
+	if err := moveToTrash(trashedItem{Path: item}, output, trashFolder, false); err != nil {
+		t.Fatal(err)
+	}
+	journal.Close()
+	journal = nil
+	entries, err := readJournal(journalDir().appendingPathComponent(runId + ".jsonl"))
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("unexpected journal %v, %v", entries, err)
+	}
+	if err := restoreFromTrash(entries[0], nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := runRollback(context.Background(), config, runId, false); err != nil {
+		t.Errorf("retried rollback failed: %v", err)
+	}
+	if !item.exists() {
+		t.Errorf("restored item is gone")
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/url"
@@ -59,6 +60,9 @@ type KinopoiskMovie struct {
 	} `json:"rating,omitempty"`
 
 	IsSeries bool `json:"isSeries"`
+	// minutes, of an episode for series
+	MovieLength  int `json:"movieLength,omitempty"`
+	SeriesLength int `json:"seriesLength,omitempty"`
 
 	Genres []KinopoiskGenre `json:"genres,omitempty"`
 
@@ -73,7 +77,7 @@ type KinopoiskGenre struct {
 }
 
 // TODO: Implement https://www.kinopoisk.ru/index.php?kp_query=fallout website parsing
-func (api KinopoiskAPI) FindMovies(titlestr string, year string, page int) (MovieSearchResult, error) {
+func (api KinopoiskAPI) FindMovies(ctx context.Context, titlestr string, year string, page int) (MovieSearchResult, error) {
 	title := strings.ReplaceAll(titlestr, "'", "")
 	query := url.QueryEscape(title)
 	url := fmt.Sprintf("https://api.kinopoisk.dev/v1.4/movie/search?page=%d&limit=40&query=%s", page, query)
@@ -91,7 +95,7 @@ func (api KinopoiskAPI) FindMovies(titlestr string, year string, page int) (Movi
 	}
 	Log("fetching kp", title, y, p, url)
 
-	response, err := FetchURL(url, map[string]string{
+	response, err := FetchURL(ctx, url, map[string]string{
 		"Accept":    "application/json",
 		"X-API-KEY": api.ApiKey,
 	})
@@ -114,89 +118,121 @@ func (api KinopoiskAPI) FindMovies(titlestr string, year string, page int) (Movi
 		if api.TvShowsOnly && !movie.IsSeries {
 			continue
 		}
+		results = append(results, api.mediaInfo(movie))
+	}
+	return MovieSearchResult{
+		Results:   results,
+		PageCount: 1, // Kinopoisk usually does great job matching a movie so don‘t try loading more pages
+	}, nil
 
-		// externalId": {
-		// "kpHD": "48e8d0acb0f62d8585101798eaeceec5",
-		// "imdb": "tt0232500",
-		// "tmdb": 9799
-		// },
-		var id string
-		var idType IdType
-		var url string
-		if movie.ExternalId.TMDb > 0 {
-			id = strconv.Itoa(movie.ExternalId.TMDb)
-			idType = TMDB
-			if movie.IsSeries {
-				url = fmt.Sprintf("https://themoviedb.org/tv/%s/", id)
-			} else {
-				url = fmt.Sprintf("https://themoviedb.org/movie/%s/", id)
-			}
-		} else if movie.ExternalId.IMDb != "" {
-			id = movie.ExternalId.IMDb
-			idType = IMDB
-			url = fmt.Sprintf("https://www.imdb.com/title/%s", id)
-		} else {
-			id = strconv.Itoa(movie.Id)
-			idType = KPID
-			if movie.IsSeries {
-				url = fmt.Sprintf("https://www.kinopoisk.ru/series/%s/", id)
-			} else {
-				url = fmt.Sprintf("https://www.kinopoisk.ru/film/%s/", id)
-			}
-		}
+}
+
+// LoadMovieDetails loads a movie or series by its Kinopoisk id
+func (api KinopoiskAPI) LoadMovieDetails(ctx context.Context, id string) (MediaInfo, error) {
+	url := "https://api.kinopoisk.dev/v1.4/movie/" + url.PathEscape(id)
+	Log("fetching kp", id, url)
+	response, err := FetchURL(ctx, url, map[string]string{
+		"Accept":    "application/json",
+		"X-API-KEY": api.ApiKey,
+	})
+	if err != nil {
+		return MediaInfo{}, err
+	}
+	var movie KinopoiskMovie
+	if err := json.Unmarshal(response, &movie); err != nil {
+		return MediaInfo{}, err
+	}
+	if movie.Id == 0 {
+		return MediaInfo{}, fmt.Errorf("kinopoisk movie %s not found", id)
+	}
+	return api.mediaInfo(movie), nil
+}
 
-		title := Coalesce3(movie.Title, movie.NameEN, movie.AlternativeTitle)
-		origTitle := movie.AlternativeTitle
-		if title == origTitle && movie.NameEN != movie.Title && movie.NameEN != "" {
-			origTitle = movie.NameEN
+// mediaInfo converts a Kinopoisk movie, TMDb or IMDb ids are preferred to the Kinopoisk one
+func (api KinopoiskAPI) mediaInfo(movie KinopoiskMovie) MediaInfo {
+	// externalId": {
+	// "kpHD": "48e8d0acb0f62d8585101798eaeceec5",
+	// "imdb": "tt0232500",
+	// "tmdb": 9799
+	// },
+	var id string
+	var idType IdType
+	var url string
+	if movie.ExternalId.TMDb > 0 {
+		id = strconv.Itoa(movie.ExternalId.TMDb)
+		idType = TMDB
+		if movie.IsSeries {
+			url = fmt.Sprintf("https://themoviedb.org/tv/%s/", id)
+		} else {
+			url = fmt.Sprintf("https://themoviedb.org/movie/%s/", id)
 		}
-		alternativeTitle := ""
-		for _, name := range movie.Names {
-			if title == origTitle && name.Name != title && name.Name != "" {
-				title = name.Name
-			} else if title != name.Name && movie.AlternativeTitle != name.Name && name.Name != "" {
-				alternativeTitle = name.Name
-			}
+	} else if movie.ExternalId.IMDb != "" {
+		id = movie.ExternalId.IMDb
+		idType = IMDB
+		url = fmt.Sprintf("https://www.imdb.com/title/%s", id)
+	} else {
+		id = strconv.Itoa(movie.Id)
+		idType = KPID
+		if movie.IsSeries {
+			url = fmt.Sprintf("https://www.kinopoisk.ru/series/%s/", id)
+		} else {
+			url = fmt.Sprintf("https://www.kinopoisk.ru/film/%s/", id)
 		}
+	}
 
-		var genres []string
-		for _, kpGenre := range movie.Genres {
-			var genre string
-			if mappedGenre, ok := api.GenresMap[strings.ToLower(kpGenre.Name)]; ok {
-				genre = mappedGenre
-			} else {
-				genre = kpGenre.Name
-			}
-			if genre != "" {
-				genres = append(genres, genre)
-			}
+	title := Coalesce3(movie.Title, movie.NameEN, movie.AlternativeTitle)
+	origTitle := movie.AlternativeTitle
+	if title == origTitle && movie.NameEN != movie.Title && movie.NameEN != "" {
+		origTitle = movie.NameEN
+	}
+	alternativeTitle := ""
+	for _, name := range movie.Names {
+		if title == origTitle && name.Name != title && name.Name != "" {
+			title = name.Name
+		} else if title != name.Name && movie.AlternativeTitle != name.Name && name.Name != "" {
+			alternativeTitle = name.Name
 		}
+	}
 
-		year := ""
-		if movie.Year > 1900 {
-			year = strconv.Itoa(movie.Year)
+	var genres []string
+	for _, kpGenre := range movie.Genres {
+		var genre string
+		if mappedGenre, ok := api.GenresMap[strings.ToLower(kpGenre.Name)]; ok {
+			genre = mappedGenre
+		} else {
+			genre = kpGenre.Name
 		}
-		mediaInfo := MediaInfo{
-			Id: MediaId{
-				id:     id,
-				idType: idType,
-			},
-			Title:            title,
-			OriginalTitle:    origTitle,
-			AlternativeTitle: alternativeTitle,
-			Description:      movie.Description,
-			Year:             year,
-			IsTvShow:         movie.IsSeries,
-			Url:              url,
-			PosterUrl:        movie.Poster.Url,
-			BackdropUrl:      movie.Backdrop.Url,
-			Genres:           genres,
+		if genre != "" {
+			genres = append(genres, genre)
 		}
-		results = append(results, mediaInfo)
 	}
-	return MovieSearchResult{
-		Results:   results,
-		PageCount: 1, // Kinopoisk usually does great job matching a movie so don‘t try loading more pages
-	}, nil
 
+	runtime := movie.MovieLength
+	if movie.IsSeries && movie.SeriesLength > 0 {
+		runtime = movie.SeriesLength
+	}
+	year := ""
+	if movie.Year > 1900 {
+		year = strconv.Itoa(movie.Year)
+	}
+	mediaInfo := MediaInfo{
+		Id: MediaId{
+			id:     id,
+			idType: idType,
+		},
+		ImdbId:           movie.ExternalId.IMDb,
+		Title:            title,
+		OriginalTitle:    origTitle,
+		AlternativeTitle: alternativeTitle,
+		Description:      movie.Description,
+		Year:             year,
+		IsTvShow:         movie.IsSeries,
+		Url:              url,
+		PosterUrl:        movie.Poster.Url,
+		BackdropUrl:      movie.Backdrop.Url,
+		LogoUrl:          movie.Logo.Url,
+		Genres:           genres,
+		Runtime:          runtime,
+	}
+	return mediaInfo
 }
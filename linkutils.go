@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// LinkMode defines how source files are placed into an output directory
+type LinkMode string
+
+const (
+	// absolute symlink to the source file
+	SymlinkMode LinkMode = "symlink"
+	// symlink relative to the output file location, survives mounting both trees under another prefix
+	RelativeSymlinkMode LinkMode = "relative_symlink"
+	// hard link, the output must be on the same filesystem as the source
+	HardlinkMode LinkMode = "hardlink"
+	// copy-on-write clone (btrfs, xfs), falls back to copying when not supported
+	ReflinkMode LinkMode = "reflink"
+	// full copy of the file
+	CopyMode LinkMode = "copy"
+)
+
+func (mode LinkMode) isValid() bool {
+	switch mode {
+	case SymlinkMode, RelativeSymlinkMode, HardlinkMode, ReflinkMode, CopyMode:
+		return true
+	default:
+		return false
+	}
+}
+
+func (mode LinkMode) isSymlink() bool {
+	return mode == SymlinkMode || mode == RelativeSymlinkMode
+}
+
+// LinkedFile is a file placed into an output directory
+type LinkedFile struct {
+	Source Path
+	Link   Path
+	Mode   LinkMode
+}
+
+// FileIdentity identifies file contents on a filesystem: hard links share it, copies don't
+type FileIdentity struct {
+	Device uint64
+	Inode  uint64
+	Links  uint64
+}
+
+// withoutLinks makes the identity usable as a map key regardless of the hard link count
+func (identity FileIdentity) withoutLinks() FileIdentity {
+	identity.Links = 0
+	return identity
+}
+
+// linkFile places the source file at the target path using the output link mode,
+// symlink targets are rewritten to the paths seen by the media player
+func (d OutputDir) linkFile(source Path, target Path) error {
+	switch mode := d.linkMode(); mode {
+	case SymlinkMode:
+		return os.Symlink(string(d.playerPath(source)), string(target))
+
+	case RelativeSymlinkMode:
+		relPath, err := filepath.Rel(string(d.playerPath(target.removingLastPathComponent())), string(d.playerPath(source)))
+		if err != nil {
+			return err
+		}
+		return os.Symlink(relPath, string(target))
+
+	case HardlinkMode:
+		if !sameFilesystem(source, target.removingLastPathComponent()) {
+			return fmt.Errorf("can't hardlink %s to %s: different filesystems", source, target)
+		}
+		return os.Link(string(source), string(target))
+
+	case ReflinkMode:
+		return copyFileContents(source, target, true)
+
+	case CopyMode:
+		return copyFileContents(source, target, false)
+
+	default:
+		return fmt.Errorf("unknown link mode `%s`", mode)
+	}
+}
+
+// copyFileContents copies (or clones) the file through a temporary file, so an interrupted copy never looks complete
+func copyFileContents(source Path, target Path, reflink bool) error {
+	sourceFile, err := os.Open(string(source))
+	if err != nil {
+		return err
+	}
+	defer sourceFile.Close()
+	info, err := sourceFile.Stat()
+	if err != nil {
+		return err
+	}
+
+	tmpFile, err := os.CreateTemp(string(target.removingLastPathComponent()), "."+target.lastPathComponent()+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmpFile.Name()
+
+	cloned := reflink && cloneFile(tmpFile, sourceFile) == nil
+	if !cloned {
+		if reflink {
+			Log("⚠️ reflink is not supported for", target, "copying")
+		}
+		_, err = io.Copy(tmpFile, sourceFile)
+	}
+	if err == nil {
+		err = tmpFile.Sync()
+	}
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chtimes(tmpPath, info.ModTime(), info.ModTime())
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, string(target))
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// sameFilesystem tells whether a hard link between the paths is possible: same device and, on Linux, same mount;
+// volume names are compared where device IDs are not available
+func sameFilesystem(a Path, b Path) bool {
+	deviceA, okA := filesystemDevice(a)
+	deviceB, okB := filesystemDevice(b)
+	if !okA || !okB {
+		return filepath.VolumeName(string(a)) == filepath.VolumeName(string(b))
+	}
+	if deviceA != deviceB {
+		return false
+	}
+	mountA, okA := mountIdOf(a)
+	mountB, okB := mountIdOf(b)
+	return !okA || !okB || mountA == mountB
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLinkFileModes(t *testing.T) {
+	dir := Path(t.TempDir())
+	source := dir.appendingPathComponent("media/Movie.2020.mkv")
+	output := dir.appendingPathComponent("out")
+	for _, path := range []Path{source.removingLastPathComponent(), output} {
+		if err := os.MkdirAll(string(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(string(source), []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sourceIdentity, _ := fileIdentity(source)
+
+	for _, mode := range []LinkMode{SymlinkMode, RelativeSymlinkMode, HardlinkMode, ReflinkMode, CopyMode} {
+		target := output.appendingPathComponent(string(mode) + ".mkv")
+		if err := (OutputDir{Path: output, LinkMode: mode}).linkFile(source, target); err != nil {
+			t.Fatalf("%s: %v", mode, err)
+		}
+		if content, err := os.ReadFile(string(target)); err != nil || string(content) != "video" {
+			t.Errorf("%s: unexpected content %q, %v", mode, content, err)
+		}
+		if target.isSymlink() != mode.isSymlink() {
+			t.Errorf("%s: unexpected symlink state", mode)
+		}
+		identity, _ := fileIdentity(target)
+		if sameInode := identity.withoutLinks() == sourceIdentity.withoutLinks(); sameInode != (mode == HardlinkMode) {
+			t.Errorf("%s: unexpected inode %d, source %d", mode, identity.Inode, sourceIdentity.Inode)
+		}
+	}
+
+	relativeTarget, _ := os.Readlink(string(output.appendingPathComponent("relative_symlink.mkv")))
+	if relativeTarget != filepath.Join("..", "media", "Movie.2020.mkv") {
+		t.Errorf("unexpected relative symlink target %s", relativeTarget)
+	}
+	if resolved, _ := output.appendingPathComponent("relative_symlink.mkv").readSymlink(); resolved != source {
+		t.Errorf("relative symlink resolved to %s", resolved)
+	}
+
+	// hard linked output is found by the source video inode
+	config := Config{Output: OutputConfig{Movies: []OutputDir{{Path: output, LinkMode: HardlinkMode}}}}
+	index, err := buildOutputIndex(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := index.findOutputItems(source, []Path{source})
+	if findIndex(items, output.appendingPathComponent("hardlink.mkv")) == -1 {
+		t.Errorf("hardlinked item not found in %v", items)
+	}
+}
+
+func TestFindSuitableOutputDir(t *testing.T) {
+	dir := Path(t.TempDir())
+	source := dir.appendingPathComponent("disk1/Movies/Movie.2020.mkv")
+	sameDisk := OutputDir{Path: dir.appendingPathComponent("kodi/movies"), LinkMode: HardlinkMode}
+	// procfs is never the filesystem of the temporary directory
+	otherDisk := OutputDir{Path: "/proc/kodi/movies", LinkMode: HardlinkMode}
+
+	config := Config{Output: OutputConfig{Movies: []OutputDir{otherDisk, sameDisk}}}
+	if output := config.findSuitableOutputDir(source, false); output.Path != sameDisk.Path {
+		t.Errorf("expected %s on the same filesystem, got %s", sameDisk.Path, output.Path)
+	}
+
+	config.Output.Movies = []OutputDir{otherDisk}
+	if output := config.findSuitableOutputDir(source, false); output.Path != "" {
+		t.Errorf("hardlinks can't be made to another filesystem, got %s", output.Path)
+	}
+	config.Output.Movies[0].LinkMode = SymlinkMode
+	if output := config.findSuitableOutputDir(source, false); output.Path != otherDisk.Path {
+		t.Errorf("symlinks can be made to another filesystem, got %s", output.Path)
+	}
+
+	config.Output.Movies = []OutputDir{sameDisk, otherDisk}
+	config.Output.Mappings = []OutputMapping{{Source: dir.appendingPathComponent("disk1"), Movies: otherDisk.Path}}
+	if output := config.findSuitableOutputDir(source, false); output.Path != otherDisk.Path || output.LinkMode != otherDisk.LinkMode {
+		t.Errorf("expected mapped %v, got %v", otherDisk, output)
+	}
+	if output := config.findSuitableOutputDir(dir.appendingPathComponent("disk2/Movie.mkv"), false); output.Path != sameDisk.Path {
+		t.Errorf("unmapped source should use the same filesystem output, got %s", output.Path)
+	}
+
+	// mapped outputs must be configured output directories
+	configFile := dir.appendingPathComponent("config.json")
+	for _, test := range []struct {
+		output string
+		valid  bool
+	}{
+		{`{"movies": [{"path": "/kodi/movies"}], "mappings": [{"source": "/disk1", "movies": "/kodi/movies/"}]}`, true},
+		{`{"movies": [{"path": "/kodi/movies"}], "mappings": [{"source": "/disk1", "movies": "/disk1/kodi/movies"}]}`, false},
+		{`{"movies": [{"path": "/kodi/movies"}], "mappings": [{"source": "/disk1", "series": "/kodi/movies"}]}`, false},
+	} {
+		if err := os.WriteFile(string(configFile), []byte(`{"output": `+test.output+`}`), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadConfig(configFile); (err == nil) != test.valid {
+			t.Errorf("%s: unexpected error %v", test.output, err)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// LLMConfig selects the model used for title cleanup, `openai` works with any OpenAI-compatible
+// endpoint (OpenAI, llama.cpp server, LM Studio, vLLM), `ollama` uses the native Ollama API
+type LLMConfig struct {
+	// `openai` (default) or `ollama`
+	Backend string `json:"backend,omitempty"`
+	// e.g. `http://localhost:8080/v1`; `https://api.openai.com/v1` or `http://localhost:11434` by default
+	BaseURL string `json:"base_url,omitempty"`
+	// `gpt-3.5-turbo` or `llama3.1` by default
+	Model string `json:"model,omitempty"`
+	// sent as a Bearer token, `openai_api_key` by default
+	ApiKey      string  `json:"api_key,omitempty"`
+	Temperature float64 `json:"temperature,omitempty"`
+	// maximum answer length, 80 tokens by default
+	MaxTokens int `json:"max_tokens,omitempty"`
+	// ask the backend for a JSON object answer (`response_format` / `format`)
+	JSONMode bool `json:"json_mode,omitempty"`
+
+	// USD per million tokens for cost estimates, known OpenAI models are priced by default
+	PromptPricePerMillion     float64 `json:"prompt_price_per_million,omitempty"`
+	CompletionPricePerMillion float64 `json:"completion_price_per_million,omitempty"`
+	// AI fallbacks are skipped once this many tokens are used today or this month, 0 is unlimited
+	DailyTokenBudget   int `json:"daily_token_budget,omitempty"`
+	MonthlyTokenBudget int `json:"monthly_token_budget,omitempty"`
+}
+
+const (
+	OpenAIBackend = "openai"
+	OllamaBackend = "ollama"
+)
+
+const defaultOpenAIModel = "gpt-3.5-turbo"
+
+// llm returns the LLM config with defaults applied
+func (c Config) llm() LLMConfig {
+	llm := c.LLM
+	llm.Backend = strings.ToLower(Coalesce(llm.Backend, OpenAIBackend))
+	if llm.Backend == OllamaBackend {
+		llm.BaseURL = Coalesce(llm.BaseURL, "http://localhost:11434")
+		llm.Model = Coalesce(llm.Model, "llama3.1")
+	} else {
+		llm.BaseURL = Coalesce(llm.BaseURL, "https://api.openai.com/v1")
+		llm.Model = Coalesce(llm.Model, defaultOpenAIModel)
+		llm.ApiKey = Coalesce(llm.ApiKey, c.OpenAiApiKey)
+	}
+	if llm.MaxTokens <= 0 {
+		llm.MaxTokens = 80
+	}
+	llm.BaseURL = strings.TrimSuffix(llm.BaseURL, "/")
+	return llm
+}
+
+// cacheKey prefixes the prompt key with the backend, and the model unless it's the default OpenAI one
+// to keep answers cached before the backend was configurable
+func (llm LLMConfig) cacheKey(promptKey string) string {
+	if llm.Backend == OpenAIBackend && llm.Model == defaultOpenAIModel {
+		return OpenAIBackend + ":" + promptKey
+	}
+	return llm.Backend + ":" + llm.Model + ":" + promptKey
+}
+
+// complete sends the prompt to the backend, answers of all backends are returned in the OpenAI format
+func (llm LLMConfig) complete(ctx context.Context, prompt string) (ChatGPTResponse, error) {
+	switch llm.Backend {
+	case OpenAIBackend:
+		return llm.completeOpenAI(ctx, prompt)
+	case OllamaBackend:
+		return llm.completeOllama(ctx, prompt)
+	default:
+		return ChatGPTResponse{}, fmt.Errorf("unknown LLM backend `%s`", llm.Backend)
+	}
+}
+
+func (llm LLMConfig) headers() map[string]string {
+	headers := map[string]string{"Content-Type": "application/json"}
+	if llm.ApiKey != "" {
+		headers["Authorization"] = "Bearer " + llm.ApiKey
+	}
+	return headers
+}
+
+func (llm LLMConfig) completeOpenAI(ctx context.Context, prompt string) (ChatGPTResponse, error) {
+	requestData := map[string]interface{}{
+		"messages":    []Message{{Role: "user", Content: prompt}},
+		"model":       llm.Model,
+		"max_tokens":  llm.MaxTokens,
+		"temperature": llm.Temperature,
+	}
+	if llm.JSONMode {
+		requestData["response_format"] = map[string]string{"type": "json_object"}
+	}
+
+	var response ChatGPTResponse
+	err := llm.post(ctx, llm.BaseURL+"/chat/completions", requestData, &response)
+	return response, err
+}
+
+type OllamaChatResponse struct {
+	Model           string  `json:"model"`
+	Message         Message `json:"message"`
+	DoneReason      string  `json:"done_reason"`
+	PromptEvalCount int     `json:"prompt_eval_count"`
+	EvalCount       int     `json:"eval_count"`
+}
+
+func (llm LLMConfig) completeOllama(ctx context.Context, prompt string) (ChatGPTResponse, error) {
+	requestData := map[string]interface{}{
+		"messages": []Message{{Role: "user", Content: prompt}},
+		"model":    llm.Model,
+		"stream":   false,
+		"options": map[string]interface{}{
+			"temperature": llm.Temperature,
+			"num_predict": llm.MaxTokens,
+		},
+	}
+	if llm.JSONMode {
+		requestData["format"] = "json"
+	}
+
+	var response OllamaChatResponse
+	if err := llm.post(ctx, llm.BaseURL+"/api/chat", requestData, &response); err != nil {
+		return ChatGPTResponse{}, err
+	}
+	return ChatGPTResponse{
+		Object:  "chat.completion",
+		Model:   response.Model,
+		Choices: []Choice{{Message: response.Message, FinishReason: response.DoneReason}},
+		Usage: Usage{
+			PromptTokens:     response.PromptEvalCount,
+			CompletionTokens: response.EvalCount,
+			TotalTokens:      response.PromptEvalCount + response.EvalCount,
+		},
+	}, nil
+}
+
+// post sends the JSON request and decodes a successful response
+func (llm LLMConfig) post(ctx context.Context, url string, requestData interface{}, response interface{}) error {
+	jsonData, err := json.Marshal(requestData)
+	if err != nil {
+		return err
+	}
+	resp, err := httpClient.do(ctx, http.MethodPost, url, llm.headers(), jsonData)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return &HTTPStatusError{Url: url, StatusCode: resp.StatusCode}
+	}
+	return json.Unmarshal(body, response)
+}
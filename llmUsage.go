@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// USD per million prompt and completion tokens of known models
+var defaultLLMPrices = map[string][2]float64{
+	"gpt-3.5-turbo": {0.5, 1.5},
+	"gpt-4o-mini":   {0.15, 0.6},
+	"gpt-4o":        {2.5, 10},
+}
+
+// prices returns USD per million prompt and completion tokens, local backends are free unless configured
+func (llm LLMConfig) prices() (float64, float64) {
+	if llm.PromptPricePerMillion > 0 || llm.CompletionPricePerMillion > 0 {
+		return llm.PromptPricePerMillion, llm.CompletionPricePerMillion
+	}
+	if llm.Backend == OpenAIBackend {
+		prices := defaultLLMPrices[llm.Model]
+		return prices[0], prices[1]
+	}
+	return 0, 0
+}
+
+func (llm LLMConfig) cost(usage Usage) float64 {
+	promptPrice, completionPrice := llm.prices()
+	return (float64(usage.PromptTokens)*promptPrice + float64(usage.CompletionTokens)*completionPrice) / 1e6
+}
+
+// LLMBudgetExceededError is returned instead of prompting once a token budget is used up
+type LLMBudgetExceededError struct {
+	Period string
+	Used   int
+	Budget int
+}
+
+func (e *LLMBudgetExceededError) Error() string {
+	return fmt.Sprintf("%s LLM token budget exceeded: %d of %d tokens used", e.Period, e.Used, e.Budget)
+}
+
+// LLMUsage accounts tokens used in a run per media item and enforces the budgets,
+// the usage is recorded in the database so budgets count previous runs too
+type LLMUsage struct {
+	db     *sql.DB
+	runId  string
+	config LLMConfig
+	mutex  sync.Mutex
+	// tokens used by previous runs today and this month
+	usedToday     int
+	usedThisMonth int
+	// usage of this run
+	prompts int
+	total   Usage
+	cost    float64
+}
+
+// usage of the current run, nil outside of runs
+var llmUsage *LLMUsage
+
+func startLLMUsage(db *sql.DB, runId string, config LLMConfig, now time.Time) *LLMUsage {
+	usage := &LLMUsage{db: db, runId: runId, config: config}
+	if db == nil {
+		if config.DailyTokenBudget > 0 || config.MonthlyTokenBudget > 0 {
+			Log("⚠️ without a database LLM token budgets only count the current run")
+		}
+		return usage
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	var err error
+	if usage.usedToday, err = sumLLMTokensSince(db, today); err != nil {
+		Log("❌ could not load LLM usage", err)
+	}
+	if usage.usedThisMonth, err = sumLLMTokensSince(db, month); err != nil {
+		Log("❌ could not load LLM usage", err)
+	}
+	return usage
+}
+
+// checkBudget returns an error if the daily or monthly token budget is used up
+func (u *LLMUsage) checkBudget() error {
+	if u == nil {
+		return nil
+	}
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	if budget := u.config.DailyTokenBudget; budget > 0 && u.usedToday+u.total.TotalTokens >= budget {
+		return &LLMBudgetExceededError{Period: "daily", Used: u.usedToday + u.total.TotalTokens, Budget: budget}
+	}
+	if budget := u.config.MonthlyTokenBudget; budget > 0 && u.usedThisMonth+u.total.TotalTokens >= budget {
+		return &LLMBudgetExceededError{Period: "monthly", Used: u.usedThisMonth + u.total.TotalTokens, Budget: budget}
+	}
+	return nil
+}
+
+// record the usage of a prompt for the media item being processed
+func (u *LLMUsage) record(ctx context.Context, usage Usage) {
+	if u == nil {
+		return
+	}
+	if usage.TotalTokens == 0 {
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	cost := u.config.cost(usage)
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	u.prompts++
+	u.total.PromptTokens += usage.PromptTokens
+	u.total.CompletionTokens += usage.CompletionTokens
+	u.total.TotalTokens += usage.TotalTokens
+	u.cost += cost
+	if u.db == nil {
+		return
+	}
+	record := LLMUsageRecord{
+		RunId:            u.runId,
+		Path:             mediaItemFromContext(ctx),
+		Backend:          u.config.Backend,
+		Model:            u.config.Model,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		Cost:             cost,
+		Time:             time.Now(),
+	}
+	if err := insertLLMUsage(u.db, record); err != nil {
+		Log("❌ failed to record LLM usage", err)
+	}
+}
+
+// logSummary logs the usage of the run
+func (u *LLMUsage) logSummary() {
+	if u == nil || u.prompts == 0 {
+		return
+	}
+	Logf("🤖 LLM usage: %d prompts, %d prompt + %d completion tokens, ~$%.4f (today %d, this month %d tokens)\n",
+		u.prompts, u.total.PromptTokens, u.total.CompletionTokens, u.cost, u.usedToday+u.total.TotalTokens, u.usedThisMonth+u.total.TotalTokens)
+}
+
+type mediaItemContextKey struct{}
+
+// withMediaItem attributes LLM usage in the context to the media item
+func withMediaItem(ctx context.Context, path Path) context.Context {
+	return context.WithValue(ctx, mediaItemContextKey{}, path)
+}
+
+func mediaItemFromContext(ctx context.Context) Path {
+	path, _ := ctx.Value(mediaItemContextKey{}).(Path)
+	return path
+}
+
+// logAIError logs a skipped AI fallback as a warning when the budget is used up
+func logAIError(err error) {
+	if _, ok := err.(*LLMBudgetExceededError); ok {
+		Log("⚠️ skipping AI fallback:", err)
+	} else {
+		Log("AI Error:", err)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLLMUsageBudget(t *testing.T) {
+	originalCacheDir := CacheDir
+	defer func() { CacheDir = originalCacheDir }()
+	CacheDir = t.TempDir()
+	db, err := initializeDB(filepath.Join(t.TempDir(), "media.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	now := time.Now()
+	// usage of an earlier run today counts against the daily budget, last month's doesn't count at all
+	for _, record := range []LLMUsageRecord{
+		{RunId: "earlier", PromptTokens: 60, CompletionTokens: 10, Time: now},
+		{RunId: "last-month", PromptTokens: 1000, CompletionTokens: 100, Time: now.AddDate(0, -1, -1)},
+	} {
+		if err := insertLLMUsage(db, record); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	openAI := newFakeOpenAI(t, func(prompt string) string { return `{"title": "Солярис", "year": "1972", "error": null}` })
+	llm := Config{OpenAiApiKey: "test-openai-key", LLM: LLMConfig{BaseURL: openAI.server.URL + "/v1", DailyTokenBudget: 100}}.llm()
+	llmUsage = startLLMUsage(db, "run", llm, now)
+	defer func() { llmUsage = nil }()
+	if llmUsage.usedToday != 70 || llmUsage.usedThisMonth < 70 || llmUsage.usedThisMonth > 70+1100 {
+		t.Errorf("unexpected previous usage today %d, this month %d", llmUsage.usedToday, llmUsage.usedThisMonth)
+	}
+
+	item := Path("/media/Solaris.1972.mkv")
+	ctx := withMediaItem(context.Background(), item)
+	if _, _, err := promptAiForMovieNameAndYear(ctx, "Solaris.1972.mkv", llm); err != nil {
+		t.Fatal(err)
+	}
+	if llmUsage.prompts != 1 || llmUsage.total.TotalTokens == 0 || llmUsage.cost <= 0 {
+		t.Errorf("usage was not accounted: %+v", llmUsage.total)
+	}
+	var path string
+	var tokens int
+	if err := db.QueryRow("SELECT path, promptTokens + completionTokens FROM llmUsage WHERE runId = 'run'").Scan(&path, &tokens); err != nil || path != string(item) || tokens != llmUsage.total.TotalTokens {
+		t.Errorf("usage was not recorded for the item: %q %d %v", path, tokens, err)
+	}
+
+	// the daily budget is used up now: new prompts are refused, cached answers are still used
+	if _, _, err := promptAiForMovieNameAndYear(ctx, "Stalker.1979.mkv", llm); err == nil {
+		t.Errorf("prompt over budget should fail")
+	} else if _, ok := err.(*LLMBudgetExceededError); !ok {
+		t.Errorf("unexpected error %v", err)
+	}
+	if title, _, err := promptAiForMovieNameAndYear(ctx, "Solaris.1972.mkv", llm); err != nil || title != "Солярис" {
+		t.Errorf("cached answer should be used over budget: %q %v", title, err)
+	}
+	if len(openAI.prompts) != 1 {
+		t.Errorf("expected a single prompt, got %d", len(openAI.prompts))
+	}
+}
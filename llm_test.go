@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLLMBackends(t *testing.T) {
+	originalCacheDir := CacheDir
+	defer func() { CacheDir = originalCacheDir }()
+	CacheDir = t.TempDir()
+
+	var requests []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&request)
+		request["path"] = r.URL.Path
+		request["authorization"] = r.Header.Get("Authorization")
+		requests = append(requests, request)
+		answer := `{"title": "Зелёная миля", "year": "1999", "error": null}`
+		switch r.URL.Path {
+		case "/v1/chat/completions":
+			json.NewEncoder(w).Encode(ChatGPTResponse{Model: "local", Choices: []Choice{{Message: Message{Role: "assistant", Content: answer}}}})
+		case "/api/chat":
+			json.NewEncoder(w).Encode(OllamaChatResponse{Model: "llama3.1", Message: Message{Role: "assistant", Content: answer}, PromptEvalCount: 100, EvalCount: 20})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		config Config
+		path   string
+		check  func(request map[string]interface{}) bool
+	}{
+		{"openai-compatible", Config{OpenAiApiKey: "sk-test", LLM: LLMConfig{BaseURL: server.URL + "/v1/", Model: "local", JSONMode: true}}, "/v1/chat/completions",
+			func(request map[string]interface{}) bool {
+				return request["model"] == "local" && request["authorization"] == "Bearer sk-test" && request["response_format"] != nil
+			}},
+		{"ollama", Config{OpenAiApiKey: "sk-test", LLM: LLMConfig{Backend: "ollama", BaseURL: server.URL, JSONMode: true, Temperature: 0.2}}, "/api/chat",
+			func(request map[string]interface{}) bool {
+				options, _ := request["options"].(map[string]interface{})
+				return request["model"] == "llama3.1" && request["authorization"] == "" && request["format"] == "json" &&
+					request["stream"] == false && options["temperature"] == 0.2 && options["num_predict"] == float64(80)
+			}},
+	}
+	for _, test := range tests {
+		requests = nil
+		title, year, err := promptAiForMovieNameAndYear(context.Background(), "Zelenaya.milya.1999.mkv", test.config.llm())
+		if err != nil || title != "Зелёная миля" || year != "1999" {
+			t.Errorf("%s: got %q %q %v", test.name, title, year, err)
+		}
+		if len(requests) != 1 || requests[0]["path"] != test.path || !test.check(requests[0]) {
+			t.Errorf("%s: unexpected requests %v", test.name, requests)
+		}
+		// answers are cached per backend and model
+		if _, _, err := promptAiForMovieNameAndYear(context.Background(), "Zelenaya.milya.1999.mkv", test.config.llm()); err != nil || len(requests) != 1 {
+			t.Errorf("%s: cached answer was not used: %v", test.name, err)
+		}
+	}
+}
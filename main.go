@@ -1,11 +1,14 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/adrg/strutil"
 	"github.com/adrg/strutil/metrics"
@@ -21,7 +24,8 @@ func main() {
 		fmt.Println("Error opening log file:", err)
 		os.Exit(1)
 	}
-	logger = log.New(io.MultiWriter(os.Stdout, logFile), "", log.LstdFlags)
+	// API keys and passwords are redacted from the console and the log file
+	logger = log.New(newRedactingWriter(io.MultiWriter(os.Stdout, logFile)), "", log.LstdFlags)
 	logger.Println(`-----------------------------------------------------
 	
 
@@ -31,6 +35,8 @@ func main() {
 
 	configFlag := flag.String("config", "", "Path to the configuration file")
 	flag.StringVar(configFlag, "c", "", "Path to the configuration file (shorthand)")
+	forceCleanupFlag := flag.Bool("force-cleanup", false, "Remove orphaned items even above the cleanup limit")
+	forceRollbackFlag := flag.Bool("force-rollback", false, "Roll back a run although later runs are not rolled back")
 
 	// Parse command-line flags
 	flag.Parse()
@@ -45,30 +51,45 @@ func main() {
 		panic(err)
 	}
 
+	config.Cleanup.Force = *forceCleanupFlag
+	registerConfigSecrets(*config)
+	configureRateLimits(config.RateLimits)
+	configureHTTPClient(config.HTTP)
+	configureCache(config.Cache)
+	configureReleaseTags(config.ReleaseTags)
+
+	// Ctrl+C or SIGTERM cancels requests in flight and stops starting new items
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	// testMatching()
 	// os.Exit(0)
 
-	err = runMediaSync(*config)
+	switch command := flag.Arg(0); command {
+	case "", "sync":
+		err = runMediaSync(ctx, *config)
+	case "restore":
+		err = runRestore(*config, flag.Arg(1))
+	case "rollback":
+		err = runRollback(ctx, *config, flag.Arg(1), *forceRollbackFlag)
+	case "cache":
+		err = runCacheCommand(flag.Args()[1:])
+	case "decisions":
+		err = runDecisionsCommand(*config)
+	default:
+		Logf("Unknown command: %s\n", command)
+		help()
+		os.Exit(1)
+	}
+	if ctx.Err() != nil {
+		Log("🛑 interrupted")
+		os.Exit(1)
+	}
 	if err != nil {
-		panic(err)
+		// errors may contain request URLs, they are logged redacted instead of panicking
+		Log("❌", err)
+		os.Exit(1)
 	}
-	// flag.Parse()
-
-	// if flag.NArg() < 1 {
-	// 	help()
-	// 	os.Exit(1)
-	// }
-
-	// switch command := flag.Arg(0); command {
-	// case "sync":
-	// 	sync()
-	// case "update":
-	// 	updateMetadata()
-	// default:
-	// 	Logf("Unknown command: %s\n", command)
-	// 	help()
-	// 	os.Exit(1)
-	// }
 }
 
 func testMatching() {
@@ -115,8 +136,11 @@ func testMatching() {
 
 func help() {
 	commandDescriptions := map[string]string{
-		"sync":   "Sync directory contents with the database",
-		"update": "Update metadata",
+		"sync":      "Sync media directories to the output directories (default)",
+		"restore":   "Put items removed by the latest cleanup (or `restore <trash folder>`) back from the trash",
+		"rollback":  "Revert the changes of the latest sync run: `rollback <run-id>`, run ids are listed without one",
+		"cache":     "Manage cached responses: `cache list [provider]`, `cache stats`, `cache purge [provider] [age]`, `cache invalidate <url>`",
+		"decisions": "List the LLM's choices between close candidates with their reasoning, the latest first",
 	}
 
 	Logf("Usage: %s <command>\n", os.Args[0])
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"os"
+	"testing"
+)
+
+// tests don't log unless run with -v
+func TestMain(m *testing.M) {
+	flag.Parse()
+	logger = log.New(io.Discard, "", 0)
+	if testing.Verbose() {
+		logger = log.New(os.Stdout, "", 0)
+	}
+	os.Exit(m.Run())
+}
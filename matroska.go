@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+)
+
+// Matroska element ids, see https://www.matroska.org/technical/elements.html
+const (
+	ebmlHeaderId                 = 0x1A45DFA3
+	mkvSegmentId                 = 0x18538067
+	mkvInfoId                    = 0x1549A966
+	mkvTimecodeScaleId           = 0x2AD7B1
+	mkvDurationId                = 0x4489
+	mkvTracksId                  = 0x1654AE6B
+	mkvTrackEntryId              = 0xAE
+	mkvTrackTypeId               = 0x83
+	mkvCodecId                   = 0x86
+	mkvLanguageId                = 0x22B59C
+	mkvLanguageIETFId            = 0x22B59D
+	mkvVideoId                   = 0xE0
+	mkvPixelWidthId              = 0xB0
+	mkvPixelHeightId             = 0xBA
+	mkvColourId                  = 0x55B0
+	mkvTransferCharacteristicsId = 0x55BA
+	mkvBlockAdditionMappingId    = 0x41E4
+	mkvBlockAddIdTypeId          = 0x41E7
+	mkvAudioId                   = 0xE1
+	mkvChannelsId                = 0x9F
+)
+
+const (
+	mkvVideoTrack    = 1
+	mkvAudioTrack    = 2
+	mkvSubtitleTrack = 17
+)
+
+// Info and Tracks are read into memory up to this size
+const mkvMaxElementSize = 16 << 20
+
+// unknown sizes have all value bits set
+const ebmlUnknownSize = math.MaxUint64
+
+// readEBMLVint reads a variable size integer, the length marker is kept for ids
+func readEBMLVint(r io.Reader, keepMarker bool) (uint64, int, error) {
+	buf := make([]byte, 8)
+	if _, err := io.ReadFull(r, buf[:1]); err != nil {
+		return 0, 0, err
+	}
+	length := 1
+	for mask := byte(0x80); length <= 8 && buf[0]&mask == 0; mask >>= 1 {
+		length++
+	}
+	if length > 8 {
+		return 0, 0, fmt.Errorf("invalid EBML variable size integer")
+	}
+	if _, err := io.ReadFull(r, buf[1:length]); err != nil {
+		return 0, 0, err
+	}
+	value := uint64(buf[0])
+	if !keepMarker {
+		value &= uint64(0xFF >> length)
+	}
+	allOnes := value == uint64(0xFF>>length)
+	for _, b := range buf[1:length] {
+		value = value<<8 | uint64(b)
+		allOnes = allOnes && b == 0xFF
+	}
+	if !keepMarker && allOnes {
+		return ebmlUnknownSize, length, nil
+	}
+	return value, length, nil
+}
+
+func readEBMLElementHeader(r io.Reader) (uint64, uint64, error) {
+	id, _, err := readEBMLVint(r, true)
+	if err != nil {
+		return 0, 0, err
+	}
+	size, _, err := readEBMLVint(r, false)
+	return id, size, err
+}
+
+// ebmlChildren calls fn for each element in the data of a master element
+func ebmlChildren(data []byte, fn func(id uint64, body []byte)) error {
+	reader := bytes.NewReader(data)
+	for reader.Len() > 0 {
+		id, size, err := readEBMLElementHeader(reader)
+		if err != nil {
+			return err
+		}
+		offset := len(data) - reader.Len()
+		if size == ebmlUnknownSize || size > uint64(reader.Len()) {
+			// truncated or unknown size elements run to the end of the parent
+			size = uint64(reader.Len())
+		}
+		fn(id, data[offset:offset+int(size)])
+		reader.Seek(int64(size), io.SeekCurrent)
+	}
+	return nil
+}
+
+func ebmlUint(data []byte) uint64 {
+	var value uint64
+	for _, b := range data {
+		value = value<<8 | uint64(b)
+	}
+	return value
+}
+
+func ebmlFloat(data []byte) float64 {
+	switch len(data) {
+	case 4:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(data)))
+	case 8:
+		return math.Float64frombits(binary.BigEndian.Uint64(data))
+	default:
+		return 0
+	}
+}
+
+func ebmlString(data []byte) string {
+	return strings.TrimRight(string(data), "\x00")
+}
+
+// parseMatroska reads the segment info and tracks, clusters are skipped
+func parseMatroska(r io.ReadSeeker) (StreamDetails, error) {
+	id, size, err := readEBMLElementHeader(r)
+	if err != nil {
+		return StreamDetails{}, err
+	}
+	if id != ebmlHeaderId {
+		return StreamDetails{}, fmt.Errorf("not a Matroska file")
+	}
+	if _, err := r.Seek(int64(size), io.SeekCurrent); err != nil {
+		return StreamDetails{}, err
+	}
+	if id, _, err = readEBMLElementHeader(r); err != nil {
+		return StreamDetails{}, err
+	}
+	if id != mkvSegmentId {
+		return StreamDetails{}, fmt.Errorf("no Matroska segment")
+	}
+
+	var details StreamDetails
+	foundInfo, foundTracks := false, false
+	for !foundInfo || !foundTracks {
+		id, size, err := readEBMLElementHeader(r)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil {
+			return details, err
+		}
+		if size == ebmlUnknownSize {
+			// live streams have clusters of unknown size, nothing follows them
+			break
+		}
+		if id != mkvInfoId && id != mkvTracksId {
+			if _, err := r.Seek(int64(size), io.SeekCurrent); err != nil {
+				return details, err
+			}
+			continue
+		}
+		if size > mkvMaxElementSize {
+			return details, fmt.Errorf("Matroska element too large: %d bytes", size)
+		}
+		data := make([]byte, size)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return details, err
+		}
+		if id == mkvInfoId {
+			foundInfo = true
+			details.Duration = parseMatroskaDuration(data)
+		} else {
+			foundTracks = true
+			parseMatroskaTracks(data, &details)
+		}
+	}
+	if !foundTracks {
+		return details, fmt.Errorf("no Matroska tracks found")
+	}
+	return details, nil
+}
+
+func parseMatroskaDuration(info []byte) time.Duration {
+	timecodeScale := uint64(1000000)
+	var duration float64
+	ebmlChildren(info, func(id uint64, body []byte) {
+		switch id {
+		case mkvTimecodeScaleId:
+			timecodeScale = ebmlUint(body)
+		case mkvDurationId:
+			duration = ebmlFloat(body)
+		}
+	})
+	return time.Duration(duration * float64(timecodeScale))
+}
+
+func parseMatroskaTracks(tracks []byte, details *StreamDetails) {
+	ebmlChildren(tracks, func(id uint64, entry []byte) {
+		if id != mkvTrackEntryId {
+			return
+		}
+		var trackType uint64
+		var codecId, language, languageIETF string
+		var video VideoStream
+		var audio AudioStream
+		dolbyVision := false
+		// the default language of tracks is English
+		language = "eng"
+		ebmlChildren(entry, func(id uint64, body []byte) {
+			switch id {
+			case mkvTrackTypeId:
+				trackType = ebmlUint(body)
+			case mkvCodecId:
+				codecId = ebmlString(body)
+			case mkvLanguageId:
+				language = ebmlString(body)
+			case mkvLanguageIETFId:
+				languageIETF = ebmlString(body)
+			case mkvVideoId:
+				video = parseMatroskaVideo(body)
+			case mkvBlockAdditionMappingId:
+				ebmlChildren(body, func(id uint64, body []byte) {
+					// Dolby Vision configuration records
+					if id == mkvBlockAddIdTypeId && (ebmlUint(body) == 0x64766343 || ebmlUint(body) == 0x64767643) {
+						dolbyVision = true
+					}
+				})
+			case mkvAudioId:
+				ebmlChildren(body, func(id uint64, body []byte) {
+					if id == mkvChannelsId {
+						audio.Channels = int(ebmlUint(body))
+					}
+				})
+			}
+		})
+		if languageIETF != "" {
+			// e.g. `ru` or `pt-BR` supersedes the legacy language
+			language = Coalesce(iso639_2Languages[strings.ToLower(strings.Split(languageIETF, "-")[0])], language)
+		}
+
+		switch trackType {
+		case mkvVideoTrack:
+			video.Codec = matroskaCodecName(codecId)
+			if dolbyVision {
+				video.HDR = "dolbyvision"
+			}
+			details.Video = append(details.Video, video)
+		case mkvAudioTrack:
+			audio.Codec = matroskaCodecName(codecId)
+			if audio.Channels == 0 {
+				audio.Channels = 1
+			}
+			audio.Language = streamLanguage(language)
+			details.Audio = append(details.Audio, audio)
+		case mkvSubtitleTrack:
+			details.Subtitles = append(details.Subtitles, SubtitleStream{Codec: matroskaCodecName(codecId), Language: streamLanguage(language)})
+		}
+	})
+}
+
+func parseMatroskaVideo(data []byte) VideoStream {
+	var video VideoStream
+	ebmlChildren(data, func(id uint64, body []byte) {
+		switch id {
+		case mkvPixelWidthId:
+			video.Width = int(ebmlUint(body))
+		case mkvPixelHeightId:
+			video.Height = int(ebmlUint(body))
+		case mkvColourId:
+			ebmlChildren(body, func(id uint64, body []byte) {
+				if id == mkvTransferCharacteristicsId && video.HDR == "" {
+					video.HDR = hdrTypeOfTransfer(ebmlUint(body))
+				}
+			})
+		}
+	})
+	return video
+}
+
+// hdrTypeOfTransfer maps ITU-T H.273 transfer characteristics to Kodi HDR types
+func hdrTypeOfTransfer(transfer uint64) string {
+	switch transfer {
+	case 16:
+		return "hdr10"
+	case 18:
+		return "hlg"
+	default:
+		return ""
+	}
+}
+
+var matroskaCodecs = map[string]string{
+	"V_MPEG4/ISO/AVC":  "h264",
+	"V_MPEGH/ISO/HEVC": "hevc",
+	"V_AV1":            "av1",
+	"V_VP9":            "vp9",
+	"V_VP8":            "vp8",
+	"V_MPEG2":          "mpeg2video",
+	"V_MPEG4/ISO/ASP":  "mpeg4",
+	"V_MS/VFW/FOURCC":  "vfw",
+	"A_AAC":            "aac",
+	"A_AC3":            "ac3",
+	"A_EAC3":           "eac3",
+	"A_DTS":            "dca",
+	"A_DTS/LOSSLESS":   "dtshd_ma",
+	"A_TRUEHD":         "truehd",
+	"A_FLAC":           "flac",
+	"A_OPUS":           "opus",
+	"A_VORBIS":         "vorbis",
+	"A_MPEG/L3":        "mp3",
+	"A_MPEG/L2":        "mp2",
+	"S_TEXT/UTF8":      "srt",
+	"S_TEXT/ASS":       "ass",
+	"S_TEXT/SSA":       "ssa",
+	"S_TEXT/WEBVTT":    "webvtt",
+	"S_HDMV/PGS":       "pgs",
+	"S_VOBSUB":         "vobsub",
+}
+
+// matroskaCodecName returns the Kodi name of a codec id like `V_MPEG4/ISO/AVC`
+func matroskaCodecName(codecId string) string {
+	if name, ok := matroskaCodecs[codecId]; ok {
+		return name
+	}
+	// e.g. `A_AAC/MPEG4/LC`, `A_PCM/INT/LIT`
+	for prefix, name := range map[string]string{"A_AAC/": "aac", "A_PCM/": "pcm", "A_DTS/": "dca"} {
+		if strings.HasPrefix(codecId, prefix) {
+			return name
+		}
+	}
+	return strings.ToLower(codecId)
+}
+
+// ISO 639-2 codes of ISO 639-1 codes in IETF language tags
+var iso639_2Languages = map[string]string{
+	"ru": "rus", "en": "eng", "uk": "ukr", "de": "ger", "fr": "fre", "es": "spa", "it": "ita", "ja": "jpn",
+	"zh": "chi", "ko": "kor", "pt": "por", "pl": "pol", "nl": "dut", "sv": "swe", "fi": "fin", "tr": "tur",
+}
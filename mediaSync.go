@@ -1,30 +1,70 @@
 package main
 
 import (
+	"context"
 	"fmt"
-	"os"
 	"regexp"
+	"strconv"
 	"strings"
-
-	"github.com/hekmon/transmissionrpc/v3"
+	"time"
 )
 
 type MediaFilesInfo struct {
 	Info       MediaInfo
 	VideoFiles []Path
 	Path       Path
+	// trailers, featurettes etc. linked next to the main files
+	Extras []ExtraFile
+	// the LLM's choice between close candidates, recorded for review
+	Decision *LLMDecision
+}
+
+// release parses the source name, tags missing in a folder name are taken from its video file
+func (m MediaFilesInfo) release() ReleaseName {
+	multipleVideoFiles := len(m.VideoFiles) > 1
+	name := m.Path.lastPathComponent()
+	if !m.Path.isDirectory() {
+		name = m.Path.removingPathExtension().lastPathComponent()
+	}
+	release := parseReleaseName(name, multipleVideoFiles)
+	if len(m.VideoFiles) > 0 && m.VideoFiles[0] != m.Path {
+		release = release.merge(parseReleaseName(m.VideoFiles[0].removingPathExtension().lastPathComponent(), multipleVideoFiles))
+	}
+	return release
 }
 
 // process all media folders and sync media items
-func runMediaSync(config Config) error {
+func runMediaSync(ctx context.Context, config Config) error {
 	dirs := config.Directories
 	if config.Transmission.UnsortedDir != "" && config.Transmission.UnsortedDir.isDirectory() {
 		dirs = append(dirs, config.Transmission.UnsortedDir)
 	}
 
+	index, err := buildOutputIndex(config)
+	if err != nil {
+		return err
+	}
+	defer index.Close()
+
+	journal, err = startJournal(time.Now())
+	if err != nil {
+		return err
+	}
+	defer func() {
+		journal.Close()
+		journal = nil
+	}()
+
+	llmUsage = startLLMUsage(index.db, journal.RunId, config.llm(), time.Now())
+	defer func() {
+		llmUsage.logSummary()
+		llmUsage = nil
+	}()
+
+	torrents := newTorrentIndex(config.Transmission.Rpc)
 	var matchedItems []Path
 	for _, dir := range dirs {
-		output, err := runMediaSyncForDir(dir, config)
+		output, err := runMediaSyncForDir(ctx, dir, config, index, torrents)
 		if err != nil {
 			return err
 		}
@@ -34,54 +74,25 @@ func runMediaSync(config Config) error {
 	// remove orphaned output items against matchedItems
 	var existingItems map[string]bool = make(map[string]bool)
 	for _, path := range matchedItems {
-		existingItems[strings.ToLower(string(path))] = true
-		existingItems[strings.ToLower(string(path.removingPathExtension().appendingPathExtension("nfo")))] = true
-		existingItems[strings.ToLower(string(path.removingPathExtension())+"-poster.jpg")] = true
-		existingItems[strings.ToLower(string(path.removingPathExtension())+"-fanart.jpg")] = true
-	}
-	outputDirsArrays := [][]Path{config.Output.Movies, config.Output.Series}
-	for _, outputDirs := range outputDirsArrays {
-		for _, output := range outputDirs {
-			contents, err := output.getDirectoryContents()
-			if err != nil {
-				return err
-			}
-			for _, path := range contents {
-				if _, ok := existingItems[strings.ToLower(string(path))]; !ok {
-					if videoSymlink := path.findRelatedVideoSymlink(); videoSymlink != "" {
-						targetPath, sourceDir, err := config.sourceDirectoryForVideoSymlink(videoSymlink)
-						if err != nil {
-							Log("❌", videoSymlink.lastPathComponent(), "error reading symlink:", err)
-						} else /*if sourceDir != ""*/ {
-							if !sourceDir.exists() {
-								Log("⏏️", videoSymlink.lastPathComponent(), "Symlink points to an unavailable source:", sourceDir)
-								existingItems[strings.ToLower(string(videoSymlink))] = true
-								existingItems[strings.ToLower(string(videoSymlink.removingPathExtension().appendingPathExtension("nfo")))] = true
-								existingItems[strings.ToLower(string(videoSymlink.removingPathExtension())+"-poster.jpg")] = true
-								existingItems[strings.ToLower(string(videoSymlink.removingPathExtension())+"-fanart.jpg")] = true
-								continue
-							} else {
-								Log("🚢", videoSymlink.lastPathComponent(), "Symlink points to:", targetPath)
-								continue
-							}
-						}
-					}
-
-					Log("🪓 removing orphaned item", path)
-					err := path.removeItem()
-					if err != nil {
-						Log("❌", err)
-					}
-				}
-			}
-		}
+		markOutputItemExisting(existingItems, path)
 	}
+	if err := evictCache(); err != nil {
+		Log("❌ cache eviction failed", err)
+	}
+	return cleanupOrphanedItems(config, index, existingItems)
+}
 
-	return nil
+// mark an output video item with its NFO and artwork files as matched
+func markOutputItemExisting(existingItems map[string]bool, path Path) {
+	existingItems[strings.ToLower(string(path))] = true
+	existingItems[strings.ToLower(string(path.removingPathExtension().appendingPathExtension("nfo")))] = true
+	for _, artworkType := range allArtworkTypes {
+		existingItems[strings.ToLower(string(path.removingPathExtension())+artworkType.movieFileSuffix())] = true
+	}
 }
 
 // process one media folder and sync its media items
-func runMediaSyncForDir(directory Path, config Config) ([]Path, error) {
+func runMediaSyncForDir(ctx context.Context, directory Path, config Config, index *OutputIndex, torrents *TorrentIndex) ([]Path, error) {
 	if !directory.exists() {
 		Log("⏏️ directory not available:", directory)
 		return nil, nil
@@ -92,55 +103,66 @@ func runMediaSyncForDir(directory Path, config Config) ([]Path, error) {
 	if err != nil {
 		return []Path{}, err
 	}
-	var matchedItems []Path
-	var torrents map[string]transmissionrpc.Torrent
-	for _, item := range directoryContents {
-		output, err := processMediaItem(item, config, &torrents, false)
+	// items are processed by a pool of workers, outputs are collected in the directory order
+	outputs := make([][]Path, len(directoryContents))
+	err = forEachConcurrently(ctx, len(directoryContents), config.concurrency(), func(i int) error {
+		output, err := processMediaItem(ctx, directoryContents[i], config, torrents, index, false)
 		if _, ok := err.(*NoMediaItemsError); ok {
-			continue
+			return nil
 		} else if err != nil {
-			return []Path{}, err
+			return err
 		}
-		matchedItems = append(matchedItems, output...)
+		outputs[i] = output
+		return nil
+	})
+	if err != nil {
+		return []Path{}, err
 	}
 
+	var matchedItems []Path
+	for _, output := range outputs {
+		matchedItems = append(matchedItems, output...)
+	}
 	return matchedItems, nil
 }
 
 // process one media item in a folder
 // returns paths in output directory matched against the original items
-func processMediaItem(path Path, config Config, torrents *map[string]transmissionrpc.Torrent, isPartOfMultiVideoItem bool) ([]Path, error) {
-	if outDir := videoExistsInOutDirs(path, config); outDir != nil {
+func processMediaItem(ctx context.Context, path Path, config Config, torrents *TorrentIndex, index *OutputIndex, isPartOfMultiVideoItem bool) ([]Path, error) {
+	if outDirs := videoExistsInOutDirs(path, config, index); len(outDirs) > 0 {
 		Log(path, "already processed")
-		output := []Path{*outDir}
-		seriesDir := findSuitableDirectoryForSymlink(path, config.Output.Series)
-		if outDir.removingLastPathComponent() == seriesDir {
-			// sync TV Show media files if missing
-			_, err := syncTvShow(MediaFilesInfo{Path: path, Info: MediaInfo{}}, seriesDir, config)
-			if err != nil {
-				return []Path{}, nil
-			}
-		} else if outDir.isDirectory() {
-			contents, err := outDir.getDirectoryContents()
-			if err != nil {
-				return []Path{}, err
-			}
-			// it's a fake (empty) directory, movies from the original dir are placed nearby
-			if len(contents) == 0 {
-				videoFiles := getVideoFiles(path)
-				moviesDir := findSuitableDirectoryForSymlink(path, config.Output.Movies)
-				for _, path := range videoFiles {
-					outputPath := moviesDir.appendingPathComponent(path.lastPathComponent())
-					// Log("🟠 taking nearby file", outputPath)
-					output = append(output, outputPath)
+		output := outDirs
+		seriesDir := config.findSuitableOutputDir(path, true)
+		for _, outDir := range outDirs {
+			if outDir.removingLastPathComponent() == seriesDir.Path {
+				// sync TV Show media files if missing
+				_, err := syncTvShow(ctx, MediaFilesInfo{Path: path, Info: MediaInfo{}}, seriesDir, outDir, config, index)
+				if err != nil {
+					return []Path{}, nil
+				}
+			} else if outDir.isDirectory() {
+				contents, err := outDir.getDirectoryContents()
+				if err != nil {
+					return []Path{}, err
+				}
+				// it's a fake (empty) directory, movies from the original dir are placed nearby
+				if len(contents) == 0 {
+					videoFiles := getVideoFiles(path)
+					moviesDir := config.findSuitableOutputDir(path, false)
+					for _, path := range videoFiles {
+						outputPath := moviesDir.Path.appendingPathComponent(path.lastPathComponent())
+						// Log("🟠 taking nearby file", outputPath)
+						output = append(output, outputPath)
+					}
 				}
 			}
 		}
 		return output, nil
 	}
 	Log("➡️ Updating metadata for:", path)
+	ctx = withMediaItem(ctx, path)
 
-	mediaInfo, err := getMediaInfo(path, torrents, config, isPartOfMultiVideoItem)
+	mediaInfo, err := getMediaInfo(ctx, path, torrents, config, isPartOfMultiVideoItem)
 
 	if multiMoviesErr, ok := err.(*FolderSeemsContainingMultipleMoviesError); ok {
 		tmpMediaInfo := MediaFilesInfo{
@@ -150,7 +172,7 @@ func processMediaItem(path Path, config Config, torrents *map[string]transmissio
 				IsTvShow: false,
 			},
 		}
-		if err := moveMediaItemFromUnsortedIfNeeded(&path, torrents, &tmpMediaInfo, config); err != nil {
+		if err := moveMediaItemFromUnsortedIfNeeded(ctx, &path, torrents, &tmpMediaInfo, config); err != nil {
 			Log("❌ move from unsorted failed", err)
 			return []Path{}, err
 		}
@@ -158,28 +180,42 @@ func processMediaItem(path Path, config Config, torrents *map[string]transmissio
 		var output []Path
 		// it seems the media item folder contains separate movie files, process them individually
 		for _, videoFile := range tmpMediaInfo.VideoFiles {
-			output, err = processMediaItem(videoFile, config, torrents, true)
+			itemOutput, err := processMediaItem(ctx, videoFile, config, torrents, index, true)
 			if err != nil {
 				return nil, err
 			}
+			output = append(output, itemOutput...)
 		}
-		// create folder at output path to ignore the item in future
-		moviesDir := findSuitableDirectoryForSymlink(path, config.Output.Movies)
-		if moviesDir == "" {
+		moviesDir := config.findSuitableOutputDir(path, false)
+		if moviesDir.Path == "" {
 			return []Path{}, fmt.Errorf("no same-volume directory suitable for %s found in config.Output.Series", path)
 		}
-		dirPath := moviesDir.appendingPathComponent(path.lastPathComponent())
-		err = os.MkdirAll(string(dirPath), 0755)
+		if !moviesDir.usesSourceNames(false) {
+			// the movies are found by their links next time
+			Log("🌕 independent proc", output)
+			return output, nil
+		}
+		// create folder at output path to ignore the item in future
+		dirPath := moviesDir.Path.appendingPathComponent(path.lastPathComponent())
+		err = mkdirAllJournaled(dirPath)
 		output = append(output, dirPath)
 		Log("🌕 independent proc", output)
 		return output, err
 	}
-	if err != nil {
+	if rejected, ok := err.(*LLMRejectedError); ok {
+		// skipped until the decision is reviewed, e.g. the item is renamed
+		index.recordLLMDecision(rejected.Decision)
+		Log("⏭️ skipping", path, err)
+		return []Path{}, nil
+	} else if err != nil {
 		return []Path{}, err
 	}
+	if mediaInfo.Decision != nil {
+		index.recordLLMDecision(mediaInfo.Decision)
+	}
 	Log("✅", mediaInfo.Info.Title, "/", mediaInfo.Info.OriginalTitle, mediaInfo.Info.Year)
 
-	if err := moveMediaItemFromUnsortedIfNeeded(&path, torrents, &mediaInfo, config); err != nil {
+	if err := moveMediaItemFromUnsortedIfNeeded(ctx, &path, torrents, &mediaInfo, config); err != nil {
 		Log("❌ move from unsorted failed", err)
 		return []Path{}, err
 	}
@@ -190,15 +226,15 @@ func processMediaItem(path Path, config Config, torrents *map[string]transmissio
 		imdbApi := IMDbAPI{GenresMap: config.GenresMap}
 		Log("fetching posters for", mediaInfo.Info.OriginalTitle)
 		// fetch from Kinopoisk
-		if movie, score, err := findMovieByTitle(kpApi, Coalesce(mediaInfo.Info.OriginalTitle, mediaInfo.Info.Title), mediaInfo.Info.Year); err == nil && score > 92 {
-			mediaInfo = MediaFilesInfo{Info: movie, Path: mediaInfo.Path, VideoFiles: mediaInfo.VideoFiles}
+		if movie, score, err := findMovieByTitle(ctx, kpApi, Coalesce(mediaInfo.Info.OriginalTitle, mediaInfo.Info.Title), mediaInfo.Info.Year); err == nil && score > 92 {
+			mediaInfo = MediaFilesInfo{Info: movie, Path: mediaInfo.Path, VideoFiles: mediaInfo.VideoFiles, Extras: mediaInfo.Extras}
 
 			// alternatively fetch from IMDb
-		} else if movie, score, err := findMovieByTitle(imdbApi, Coalesce(mediaInfo.Info.OriginalTitle, mediaInfo.Info.Title), mediaInfo.Info.Year); err == nil {
-			movie, err = imdbApi.LoadMediaInfo(movie.Id.id, TMDbAPI{})
+		} else if movie, score, err := findMovieByTitle(ctx, imdbApi, Coalesce(mediaInfo.Info.OriginalTitle, mediaInfo.Info.Title), mediaInfo.Info.Year); err == nil {
+			movie, err = imdbApi.LoadMediaInfo(ctx, movie.Id.id, TMDbAPI{})
 			if err == nil {
 				tmdbAPI := TMDbAPI{ApiKey: config.TMDbApiKey, MovieGenres: config.TMDbMovieGenres, TvGenres: config.TMDbTvGenres}
-				if tmdbMovie, err := tmdbAPI.findTMDbByIMDbID(movie.Id.id); (err == nil && tmdbMovie.Id.id == mediaInfo.Info.Id.id) || score > 92 {
+				if tmdbMovie, err := tmdbAPI.findTMDbByIMDbID(ctx, movie.Id.id); (err == nil && tmdbMovie.Id.id == mediaInfo.Info.Id.id) || score > 92 {
 					info := MediaInfo{
 						Id:               mediaInfo.Info.Id,
 						Title:            mediaInfo.Info.Title,
@@ -210,23 +246,31 @@ func processMediaItem(path Path, config Config, torrents *map[string]transmissio
 						Url:              mediaInfo.Info.Url,
 						PosterUrl:        Coalesce(mediaInfo.Info.PosterUrl, movie.PosterUrl),
 						BackdropUrl:      Coalesce(mediaInfo.Info.BackdropUrl, movie.BackdropUrl),
+						LogoUrl:          Coalesce(mediaInfo.Info.LogoUrl, movie.LogoUrl),
 						Genres:           movie.Genres,
 					}
-					mediaInfo = MediaFilesInfo{Info: info, Path: mediaInfo.Path, VideoFiles: mediaInfo.VideoFiles}
+					mediaInfo = MediaFilesInfo{Info: info, Path: mediaInfo.Path, VideoFiles: mediaInfo.VideoFiles, Extras: mediaInfo.Extras}
 				}
 			}
 		}
 	}
 
-	output, err := syncMediaItemFiles(mediaInfo, config)
+	output, err := syncMediaItemFiles(ctx, mediaInfo, config, index)
 	if err != nil {
 		return nil, err
 	}
+	if findIndex(index.sourcesOfOutputItem(output), mediaInfo.Path) == -1 {
+		if err := index.recordOutputItem(mediaInfo.Path, output); err != nil {
+			Log("❌ failed to record output item", output, err)
+		} else {
+			journal.record(JournalEntry{Action: RecordAction, Path: output, Source: mediaInfo.Path})
+		}
+	}
 
 	return []Path{output}, nil
 }
 
-func moveMediaItemFromUnsortedIfNeeded(path *Path, torrents *map[string]transmissionrpc.Torrent, mediaInfo *MediaFilesInfo, config Config) error {
+func moveMediaItemFromUnsortedIfNeeded(ctx context.Context, path *Path, torrents *TorrentIndex, mediaInfo *MediaFilesInfo, config Config) error {
 	unsortedDir := strings.ToLower(strings.TrimSuffix(string(config.Transmission.UnsortedDir.appendingPathComponent("a")), "a")) // get path with trailing [back]slash
 	if !strings.HasPrefix(strings.ToLower(string(*path)), unsortedDir) {
 		return nil
@@ -252,15 +296,16 @@ RuleLoop:
 		return fmt.Errorf("could not determine destination path for %s", mediaInfo.Info.Title)
 	}
 
-	torrent, ok := (*torrents)[strings.ToLower(string(mediaInfo.Path))]
+	torrent, ok := torrents.find(ctx, mediaInfo.Path)
 	if !ok {
 		return fmt.Errorf("torrent not found for %s", string(mediaInfo.Path))
 	}
 	Log("moving torrent", *torrent.Name, "to", outDir)
-	err := moveTorrentCached(*torrent.ID, outDir, config.Transmission.Rpc)
+	err := moveTorrent(ctx, *torrent.ID, outDir, config.Transmission.Rpc)
 	if err != nil {
 		return err
 	}
+	journal.record(JournalEntry{Action: TorrentMoveAction, Path: mediaInfo.Path, TorrentId: *torrent.ID, From: Path(*torrent.DownloadDir), To: outDir})
 
 	*path = outDir.appendingPathComponent(string(*path)[len(unsortedDir):])
 	mediaInfo.Path = outDir.appendingPathComponent(string(mediaInfo.Path)[len(unsortedDir):])
@@ -286,10 +331,11 @@ func (ce *NoMediaItemsError) Error() string {
 }
 
 // get MediaInfo for a media item
-func getMediaInfo(path Path, torrents *map[string]transmissionrpc.Torrent, config Config, isPartOfMultiVideoItem bool) (MediaFilesInfo, error) {
+func getMediaInfo(ctx context.Context, path Path, torrents *TorrentIndex, config Config, isPartOfMultiVideoItem bool) (MediaFilesInfo, error) {
 	var title string
 	var year string
 	var imdbId string
+	var torrentTitle string
 	var err error
 
 	videoFiles := getVideoFiles(path)
@@ -297,37 +343,24 @@ func getMediaInfo(path Path, torrents *map[string]transmissionrpc.Torrent, confi
 		Log("🚫 no video files found, skipping")
 		return MediaFilesInfo{}, &NoMediaItemsError{}
 	}
-
-	// load torrents if needed
-	if *torrents == nil && config.Transmission.Rpc != "" {
-		torrentsVal, err := getTorrentsByPathCached(config.Transmission.Rpc)
-		if err != nil {
-			Log("❌ could not load torrent list", err)
-		} else {
-			Log("loaded", len(torrentsVal), "torrents")
-			*torrents = torrentsVal
-		}
-	}
-	if *torrents == nil {
-		*torrents = make(map[string]transmissionrpc.Torrent)
-	}
+	videoFiles, durations, extras := splitVideoFiles(path, videoFiles, videoDurations(videoFiles))
 
 	tmdbAPI := TMDbAPI{ApiKey: config.TMDbApiKey, MovieGenres: config.TMDbMovieGenres, TvGenres: config.TMDbTvGenres}
 
 	// Find torrent by lowercased file path
-	torrent, ok := (*torrents)[strings.ToLower(string(path))]
+	torrent, ok := torrents.find(ctx, path)
 	if ok {
 		Log("🔍 found torrent", *torrent.Name)
+		torrentTitle = *torrent.Name
 		// load torrent info from tracker
-		title, year, imdbId, err = loadTitleYearIMDbIdFromRutracker(*torrent.Comment)
+		title, year, imdbId, err = loadTitleYearIMDbIdFromRutracker(ctx, *torrent.Comment)
 		if err == nil && imdbId != "" {
-			videoFiles := getVideoFiles(path)
 			imdbApi := IMDbAPI{GenresMap: config.GenresMap}
-			mediaInfo, err := imdbApi.LoadMediaInfo(imdbId, tmdbAPI)
+			mediaInfo, err := imdbApi.LoadMediaInfo(ctx, imdbId, tmdbAPI)
 			if err != nil {
 				return MediaFilesInfo{}, err
 			}
-			return MediaFilesInfo{Info: mediaInfo, Path: path, VideoFiles: videoFiles}, nil
+			return MediaFilesInfo{Info: mediaInfo, Path: path, VideoFiles: videoFiles, Extras: extras}, nil
 		} else if err != nil {
 			Log("could not retreive torrent data:", err)
 		}
@@ -355,42 +388,56 @@ func getMediaInfo(path Path, torrents *map[string]transmissionrpc.Torrent, confi
 		if match := seasonEpisodeRE.FindStringSubmatch(videoFiles[0].lastPathComponent()); len(match) == 3 {
 			// it's a tv series – name matches S01E02 pattern
 		} else if len(videoFiles) == 2 && computeSimilarityScore(string(videoFiles[0]), string(videoFiles[1]), false) > 90 {
-			// likely it's a 2-part movie
-			mediaInfo, score, err := findMovieMediaInfo(path, title, year, config)
-			if err == nil && score > 80 {
-				return MediaFilesInfo{Info: mediaInfo, Path: path, VideoFiles: videoFiles}, nil
+			// likely it's a 2-part movie, unless parts are as short as episodes
+			if total := totalDuration(durations); total == 0 || total >= episodeMaxDuration {
+				mediaInfo, score, err := findMovieMediaInfo(ctx, path, title, year, config)
+				if err == nil {
+					mediaInfo, score = validateRuntime(ctx, mediaInfo, score, total, config)
+				}
+				if err == nil && score > 80 {
+					return MediaFilesInfo{Info: mediaInfo, Path: path, VideoFiles: videoFiles, Extras: extras}, nil
+				}
 			}
+		} else if seemMultipleMovies(durations) {
+			// all files are movie-length, find individual movies
+			Log("🎞️ all files are movie-length")
+			return MediaFilesInfo{}, &FolderSeemsContainingMultipleMoviesError{videoFiles: videoFiles}
 		}
 
 		// likely it's TV Series
 		tmdbAPI.TVShowSearch = true
-		mediaInfo, score, err := findMovieByTitle(tmdbAPI, title, year)
+		mediaInfo, score, err := findMovieByTitle(ctx, tmdbAPI, title, year)
+		if err == nil && score > 80 {
+			// an episode isn't as long as a movie
+			mediaInfo, score = validateRuntime(ctx, mediaInfo, score, medianDuration(durations), config)
+		}
 
 		if err == nil && score > 80 {
-			return MediaFilesInfo{Info: mediaInfo, Path: path, VideoFiles: videoFiles}, nil
+			mediaInfo, _, decision, err := disambiguateMatch(ctx, path, torrentTitle, title, year, mediaInfo, score, config)
+			return MediaFilesInfo{Info: mediaInfo, Path: path, VideoFiles: videoFiles, Extras: extras, Decision: decision}, err
 
 		} else if strings.Contains(title, "е") {
 			// if not found and there's cyrillic `e` it's likely it may be transliterated to `ё`
 			Logf("Prompting AI for corrected ё usage\n")
-			correctedTitle, err := promptAiForCorrectedYoLetterUsage(title, config.OpenAiApiKey)
+			correctedTitle, err := promptAiForCorrectedYoLetterUsage(ctx, title, config.llm())
 			if err != nil {
-				Log("AI Error:", err)
+				logAIError(err)
 			}
 			Logf("Response: %s\n", correctedTitle)
 			if correctedTitle != title {
-				mediaInfo, _, err := findMovieByTitle(tmdbAPI, correctedTitle, year)
+				mediaInfo, _, err := findMovieByTitle(ctx, tmdbAPI, correctedTitle, year)
 
 				if err == nil {
-					return MediaFilesInfo{Info: mediaInfo, Path: path, VideoFiles: videoFiles}, nil
+					return MediaFilesInfo{Info: mediaInfo, Path: path, VideoFiles: videoFiles, Extras: extras}, nil
 				}
 			}
 		}
 
 		kpApi := KinopoiskAPI{ApiKey: config.KinopoiskApiKey, TvShowsOnly: true, GenresMap: config.GenresMap}
-		kpMediaInfo, score, err := findMovieByTitle(kpApi, title, year)
+		kpMediaInfo, score, err := findMovieByTitle(ctx, kpApi, title, year)
 
 		if err == nil && score > 70 {
-			return MediaFilesInfo{Info: kpMediaInfo, Path: path, VideoFiles: videoFiles}, nil
+			return MediaFilesInfo{Info: kpMediaInfo, Path: path, VideoFiles: videoFiles, Extras: extras}, nil
 
 		} else if err == nil && score > 50 && FindCommonItems(
 			// if score is pretty low but the result from 2 sources matches
@@ -404,7 +451,7 @@ func getMediaInfo(path Path, torrents *map[string]transmissionrpc.Torrent, confi
 				kpMediaInfo.AlternativeTitle,
 			}, func(item string) bool { return item != "" }), false /*caseSensitive*/) > 0 {
 
-			return MediaFilesInfo{Info: mediaInfo, Path: path, VideoFiles: videoFiles}, nil
+			return MediaFilesInfo{Info: mediaInfo, Path: path, VideoFiles: videoFiles, Extras: extras}, nil
 
 		} else {
 			// find individual movies instead
@@ -412,33 +459,41 @@ func getMediaInfo(path Path, torrents *map[string]transmissionrpc.Torrent, confi
 		}
 	}
 
-	mediaInfo, score, err := findMovieMediaInfo(path, title, year, config)
+	mediaInfo, score, err := findMovieMediaInfo(ctx, path, title, year, config)
+	if err == nil && score >= 80 {
+		// a 45-min file isn't a 2-hour movie
+		mediaInfo, score = validateRuntime(ctx, mediaInfo, score, totalDuration(durations), config)
+	}
 	if score < 80 {
 		return MediaFilesInfo{}, fmt.Errorf("found match '%s / %s' score is too low: %d", mediaInfo.Title, mediaInfo.OriginalTitle, score)
 	}
-	return MediaFilesInfo{Info: mediaInfo, Path: path, VideoFiles: videoFiles}, err
+	if err != nil {
+		return MediaFilesInfo{}, err
+	}
+	mediaInfo, _, decision, err := disambiguateMatch(ctx, path, torrentTitle, title, year, mediaInfo, score, config)
+	return MediaFilesInfo{Info: mediaInfo, Path: path, VideoFiles: videoFiles, Extras: extras, Decision: decision}, err
 }
 
 // TODO: if no poster try getting kinopoisk files and create local NFO
-func findMovieMediaInfo(path Path, title string, year string, config Config) (MediaInfo /*score*/, int, error) {
+func findMovieMediaInfo(ctx context.Context, path Path, title string, year string, config Config) (MediaInfo /*score*/, int, error) {
 	lang := "en-US"
 	if containsCyrillicCharacters(title) {
 		lang = "ru-RU"
 	}
 
 	tmdbApi := TMDbAPI{ApiKey: config.TMDbApiKey, Language: lang, TVShowSearch: false, MovieGenres: config.TMDbMovieGenres, TvGenres: config.TMDbTvGenres}
-	movie, score, err := findMovieByTitle(tmdbApi, title, year)
+	movie, score, err := findMovieByTitle(ctx, tmdbApi, title, year)
 
 	// if not found and there's cyrillic `e` it's likely it may be transliterated to `ё`
 	if lang == "ru-RU" && (err != nil || score <= 80) && strings.Contains(title, "е") {
 		Logf("Prompting AI for corrected ё usage\n")
-		correctedTitle, e := promptAiForCorrectedYoLetterUsage(title, config.OpenAiApiKey)
+		correctedTitle, e := promptAiForCorrectedYoLetterUsage(ctx, title, config.llm())
 		if e != nil {
-			Log("AI Error:", e)
+			logAIError(e)
 		}
 		Logf("Response: %s\n", correctedTitle)
 		if correctedTitle != title {
-			movie, score, err = findMovieByTitle(tmdbApi, correctedTitle, year)
+			movie, score, err = findMovieByTitle(ctx, tmdbApi, correctedTitle, year)
 		}
 	}
 
@@ -448,9 +503,9 @@ func findMovieMediaInfo(path Path, title string, year string, config Config) (Me
 		if lang == "en-US" {
 			var m MediaInfo
 			if movie.IsTvShow {
-				m, err = tmdbApi.LoadSeriesMediaInfo(movie.Id.id)
+				m, err = tmdbApi.LoadSeriesMediaInfo(ctx, movie.Id.id)
 			} else {
-				m, err = tmdbApi.LoadMovieDetails(movie.Id.id)
+				m, err = tmdbApi.LoadMovieDetails(ctx, movie.Id.id)
 			}
 			if err == nil {
 				movie = m
@@ -468,7 +523,7 @@ func findMovieMediaInfo(path Path, title string, year string, config Config) (Me
 	if lang != "ru-RU" {
 		translitTitle := TransliterateToCyrillic(title)
 		if translitTitle != title {
-			if m, s, err := findMovieByTitle(tmdbApi, translitTitle, year); err == nil && s > score {
+			if m, s, err := findMovieByTitle(ctx, tmdbApi, translitTitle, year); err == nil && s > score {
 				movie = m
 				score = s
 			} else if err != nil {
@@ -484,11 +539,11 @@ func findMovieMediaInfo(path Path, title string, year string, config Config) (Me
 
 	// try searching IMDB
 	imdbApi := IMDbAPI{GenresMap: config.GenresMap}
-	if m, s, err := findMovieByTitle(imdbApi, title, year); err == nil && s > score {
+	if m, s, err := findMovieByTitle(ctx, imdbApi, title, year); err == nil && s > score {
 		movie = m
 		score = s
 
-		if mediaInfo, err := imdbApi.LoadMediaInfo(m.Id.id, tmdbApi); err == nil {
+		if mediaInfo, err := imdbApi.LoadMediaInfo(ctx, m.Id.id, tmdbApi); err == nil {
 			movie = mediaInfo
 		}
 
@@ -503,7 +558,7 @@ func findMovieMediaInfo(path Path, title string, year string, config Config) (Me
 
 	// search Kinopoisk
 	kpApi := KinopoiskAPI{ApiKey: config.KinopoiskApiKey, GenresMap: config.GenresMap}
-	if m, s, err := findMovieByTitle(kpApi, title, year); err == nil && s > score {
+	if m, s, err := findMovieByTitle(ctx, kpApi, title, year); err == nil && s > score {
 		movie = m
 		score = s
 	} else if err != nil {
@@ -517,14 +572,20 @@ func findMovieMediaInfo(path Path, title string, year string, config Config) (Me
 
 	// prompt ChatGPT to guess a corrected name from the file name
 	Logf("Prompting AI\n")
-	title, year, err = promptAiForMovieNameAndYear(path.lastPathComponent(), config.OpenAiApiKey)
-	if err != nil {
+	aiTitle, aiYear, err := promptAiForMovieNameAndYear(ctx, path.lastPathComponent(), config.llm())
+	if budgetErr, ok := err.(*LLMBudgetExceededError); ok {
+		// go on with the title from the file name
+		Log("⚠️ skipping AI title cleanup:", budgetErr)
+		err = nil
+	} else if err != nil {
 		return MediaInfo{}, 0, err
+	} else {
+		title, year = aiTitle, aiYear
+		Logf("Response: %s (%s)\n", title, year)
 	}
-	Logf("Response: %s (%s)\n", title, year)
 
 	// query TMDB with title corrected by ChatGPT
-	if m, s, err := findMovieByTitle(tmdbApi, title, year); err == nil && s > score {
+	if m, s, err := findMovieByTitle(ctx, tmdbApi, title, year); err == nil && s > score {
 		movie = m
 		score = s
 	} else if err != nil {
@@ -538,7 +599,7 @@ func findMovieMediaInfo(path Path, title string, year string, config Config) (Me
 
 	// try searching TV series instead
 	tmdbApi.TVShowSearch = true
-	if m, s, err := findMovieByTitle(tmdbApi, title, year); err == nil && s > score {
+	if m, s, err := findMovieByTitle(ctx, tmdbApi, title, year); err == nil && s > score {
 		movie = m
 		score = s
 	} else if err != nil {
@@ -555,128 +616,159 @@ func findMovieMediaInfo(path Path, title string, year string, config Config) (Me
 }
 
 // create output folder and video file links for a media item
-func syncMediaItemFiles(mediaInfo MediaFilesInfo, config Config) (Path, error) {
+func syncMediaItemFiles(ctx context.Context, mediaInfo MediaFilesInfo, config Config, index *OutputIndex) (Path, error) {
 	if mediaInfo.Info.IsTvShow {
-		outputDir := findSuitableDirectoryForSymlink(mediaInfo.Path, config.Output.Series)
-		if outputDir == "" {
+		outputDir := config.findSuitableOutputDir(mediaInfo.Path, true)
+		if outputDir.Path == "" {
 			return Path(""), fmt.Errorf("no same-volume directory suitable for %s found in config.Output.Series", mediaInfo.Path)
 		}
-		return syncTvShow(mediaInfo, outputDir, config)
+		if outputDir.needsExternalIds() {
+			mediaInfo.Info = loadExternalIds(ctx, mediaInfo.Info, config)
+		}
+		return syncTvShow(ctx, mediaInfo, outputDir, outputDir.tvShowDir(mediaInfo), config, index)
 	} else {
-		outputDir := findSuitableDirectoryForSymlink(mediaInfo.Path, config.Output.Movies)
-		if outputDir == "" {
+		outputDir := config.findSuitableOutputDir(mediaInfo.Path, false)
+		if outputDir.Path == "" {
 			return Path(""), fmt.Errorf("no same-volume directory suitable for %s found in config.Output.Movies", mediaInfo.Path)
 		}
-		return syncMovie(mediaInfo, outputDir)
+		if outputDir.needsExternalIds() {
+			mediaInfo.Info = loadExternalIds(ctx, mediaInfo.Info, config)
+		}
+		return syncMovie(ctx, mediaInfo, outputDir, config, index)
 	}
 }
 
 // create link for a movie file and write NFO in the Movies output dir
-func syncMovie(mediaInfo MediaFilesInfo, output Path) (Path, error) {
-	fileName := movieFileNameWithoutExtension(mediaInfo.VideoFiles)
-	outputDir := output
-	// make folder for multipart movie
-	if !mediaInfo.Path.isVideoFile() {
-		outputDir = output.appendingPathComponent(mediaInfo.Path.lastPathComponent())
-		err := os.MkdirAll(string(outputDir), 0755)
+func syncMovie(ctx context.Context, mediaInfo MediaFilesInfo, output OutputDir, config Config, index *OutputIndex) (Path, error) {
+	outputDir, fileName, outputItem := output.movieLocation(mediaInfo)
+	unlock := outputItemLocks.lock(outputItem)
+	defer unlock()
+	if outputItem == outputDir && !output.usesSourceNames(false) {
+		fileName = output.versionFileName(mediaInfo, outputDir, fileName, index)
+	}
+	if outputDir != output.Path {
+		err := mkdirAllJournaled(outputDir)
 		if err != nil {
 			return "", err
 		}
 	}
 
-	// download poster/background for Kinopoisk media info
-	if mediaInfo.Info.PosterUrl != "" && !strings.Contains(mediaInfo.Info.PosterUrl, "image.tmdb.org") /* Kodi will download tmdb images itself */ {
-		posterName := fileName + "-poster.jpg"
-		posterPath := outputDir.appendingPathComponent(posterName)
-		err := downloadImage(mediaInfo.Info.PosterUrl, posterPath)
+	// download poster, fanart, logos etc.
+	artwork := downloadArtwork(ctx, findArtwork(ctx, mediaInfo.Info, config), outputDir, func(artworkType ArtworkType) string {
+		return output.movieArtworkFileName(artworkType, fileName, outputDir != output.Path)
+	}, config.Artwork)
+
+	if output.writesNfo() {
+		release := mediaInfo.release()
+		err := writeMovieNfo(mediaInfo.Info, release, probeStreamDetails(mediaInfo.VideoFiles, release), artwork, outputDir.appendingPathComponent(fileName+".nfo"))
 		if err != nil {
-			Log("Could not download poster", err)
+			return "", err
 		}
 	}
-	if mediaInfo.Info.BackdropUrl != "" && !strings.Contains(mediaInfo.Info.BackdropUrl, "image.tmdb.org") /* Kodi will download tmdb images itself */ {
-		fanartName := fileName + "-fanart.jpg"
-		fanartPath := outputDir.appendingPathComponent(fanartName)
-		err := downloadImage(mediaInfo.Info.BackdropUrl, fanartPath)
+
+	for _, videoFile := range mediaInfo.VideoFiles {
+		var linkedFiles []LinkedFile
+		var err error
+		if videoFile.isDiscFolder() {
+			// `BDMV/` in the movie folder, discs of a multi-disc movie in own folders
+			discDir := outputDir
+			if len(mediaInfo.VideoFiles) > 1 {
+				discDir = outputDir.appendingPathComponent(videoFile.lastPathComponent())
+			}
+			linkedFiles, err = linkDiscFolder(videoFile, discDir, output)
+		} else {
+			linkedFiles, err = linkVideoFileAndRelatedItems(videoFile, outputDir, fileName, len(mediaInfo.VideoFiles) > 1, output)
+		}
+		if recordErr := index.recordLinkedFiles(mediaInfo.Path, linkedFiles); recordErr != nil {
+			Log("❌ failed to record linked files", recordErr)
+		}
 		if err != nil {
-			Log("Could not download fanart", err)
+			return "", err
 		}
 	}
-
-	err := writeMovieNfo(mediaInfo, outputDir)
-	if err != nil {
-		return "", err
-	}
-
-	for _, videoFile := range mediaInfo.VideoFiles {
-		err = linkVideoFileAndRelatedItems(videoFile, outputDir, fileName, len(mediaInfo.VideoFiles) > 1)
+	// tracks in subfolders, parts of multipart movies keep sibling tracks only
+	if len(mediaInfo.VideoFiles) == 1 {
+		tracks := tracksOfVideo(findExternalTracks(mediaInfo.Path), mediaInfo.VideoFiles[0], mediaInfo.VideoFiles)
+		linkedFiles, err := linkExternalTracks(tracks, outputDir, fileName, output)
+		if recordErr := index.recordLinkedFiles(mediaInfo.Path, linkedFiles); recordErr != nil {
+			Log("❌ failed to record linked files", recordErr)
+		}
 		if err != nil {
 			return "", err
 		}
 	}
-	return output.appendingPathComponent(mediaInfo.Path.lastPathComponent()), nil
+	if err := linkExtras(mediaInfo.Extras, outputDir, fileName, outputDir != output.Path, output, mediaInfo.Path, index); err != nil {
+		return "", err
+	}
+	return outputItem, nil
 }
 
 // create links for TV Show episodes and write NFO in the Series output dir
-func syncTvShow(mediaInfo MediaFilesInfo, output Path, config Config) (Path, error) {
+func syncTvShow(ctx context.Context, mediaInfo MediaFilesInfo, output OutputDir, outputDir Path, config Config, index *OutputIndex) (Path, error) {
+	// season folders of one TV Show may be processed at once
+	unlock := outputItemLocks.lock(outputDir)
+	defer unlock()
 	if len(mediaInfo.VideoFiles) == 0 {
-		mediaInfo.VideoFiles = getVideoFiles(mediaInfo.Path)
+		// extras of already processed shows are told by names and sizes
+		mediaInfo.VideoFiles, _, mediaInfo.Extras = splitVideoFiles(mediaInfo.Path, getVideoFiles(mediaInfo.Path), nil)
 	}
-	outputDir := output.appendingPathComponent(mediaInfo.Path.lastPathComponent())
 	nfoPath := outputDir.appendingPathComponent("tvshow.nfo")
-	if (mediaInfo.Info.Id == MediaId{}) {
-		dbId, err := readTVShowNfo(nfoPath)
+	freshlyMatched := mediaInfo.Info.Id != (MediaId{})
+	if !freshlyMatched {
+		nfoInfo, err := readTVShowNfo(nfoPath)
 		if err != nil {
 			return "", err
 		}
-		mediaInfo.Info.Id = dbId
+		mediaInfo.Info = nfoInfo
 	}
 
 	// create TV Show directory
 	if !outputDir.exists() {
-		err := os.MkdirAll(string(outputDir), 0755)
+		err := mkdirAllJournaled(outputDir)
 		if err != nil {
 			return "", err
 		}
 	}
-	// create TV Show NFO file
+
+	// download poster, fanart, logos etc. for a freshly matched TV Show
+	var artwork []Artwork
+	if freshlyMatched {
+		artwork = downloadArtwork(ctx, findArtwork(ctx, mediaInfo.Info, config), outputDir, output.tvShowArtworkFileName, config.Artwork)
+	}
+	// create TV Show NFO file; it is kept for Plex as well to restore the show info on re-sync
 	if !nfoPath.exists() {
-		err := writeTVShowNfo(mediaInfo.Info, nfoPath)
+		err := writeTVShowNfo(mediaInfo.Info, artwork, nfoPath)
 		if err != nil {
 			return "", err
 		}
 	}
 
-	// download poster/background for Kinopoisk media info
-	if mediaInfo.Info.PosterUrl != "" {
-		posterPath := outputDir.appendingPathComponent("poster.jpg")
-		if !posterPath.exists() {
-			err := downloadImage(mediaInfo.Info.PosterUrl, posterPath)
-			if err != nil {
-				Log("Could not download poster", err)
-			}
-		}
-	}
-	if mediaInfo.Info.BackdropUrl != "" {
-		fanartPath := outputDir.appendingPathComponent("fanart.jpg")
-		if !fanartPath.exists() {
-			err := downloadImage(mediaInfo.Info.BackdropUrl, fanartPath)
-			if err != nil {
-				Log("Could not download fanart", err)
-			}
-		}
-	}
+	// episode files lacking release tags get them from the season folder
+	folderRelease := parseReleaseName(mediaInfo.Path.lastPathComponent(), true)
 
 	// list already existing episode files
 	existingFiles := getVideoFiles(outputDir)
+	linkedSources := make(map[string]bool)
+	linkedIdentities := make(map[FileIdentity]bool)
+	for _, existingFile := range existingFiles {
+		if target, err := output.readLinkTarget(existingFile); err == nil {
+			linkedSources[strings.ToLower(string(target))] = true
+		} else if identity, ok := fileIdentity(existingFile); ok && identity.Links > 1 {
+			linkedIdentities[identity.withoutLinks()] = true
+		}
+	}
 	// Log("existing videos from", outputDir, ":", existingFiles)
 
+	// subtitles and audio in `Subs/`, `RUS Sound/` etc.
+	tracks := findExternalTracks(mediaInfo.Path)
+
 	var episodes []TMDbEpisode
 	var episodeMap map[int]map[int]TMDbEpisode = nil
 	var err error
 	// modified := false
 	// create links for episodes not existing in target dir
 	for _, path := range mediaInfo.VideoFiles {
-		if existingIdx := indexOfEpisode(existingFiles, path.lastPathComponent()); existingIdx != -1 {
+		if isEpisodeLinked(path, existingFiles, linkedSources, linkedIdentities) || index.isLinked(path, outputDir) {
 			// episode already exists; skip
 			continue
 		}
@@ -686,7 +778,7 @@ func syncTvShow(mediaInfo MediaFilesInfo, output Path, config Config) (Path, err
 		if mediaInfo.Info.Id == (MediaId{}) {
 			episodeMap = make(map[int]map[int]TMDbEpisode)
 		} else {
-			episodeMap, episodes, err = getEpisodesMap(episodeMap, episodes, mediaInfo.Info.Id, config)
+			episodeMap, episodes, err = getEpisodesMap(ctx, episodeMap, episodes, mediaInfo.Info.Id, config)
 		}
 		if err != nil {
 			Log(err)
@@ -714,26 +806,74 @@ func syncTvShow(mediaInfo MediaFilesInfo, output Path, config Config) (Path, err
 		}
 		// TODO: load episode map from kinopoisk
 
-		targetFileName := path.removingPathExtension().lastPathComponent()
-		seasonEpisode := fmt.Sprintf("S%02dE%02d", s, e)
-		if !strings.Contains(strings.ToUpper(targetFileName), seasonEpisode) {
-			// prepend S01E02 if not already present in the file name
-			targetFileName = seasonEpisode + " " + targetFileName
+		episodeDir, targetFileName := output.episodeLocation(outputDir, mediaInfo.Info, s, e, episode.Name, path)
+		if !episodeDir.exists() {
+			if err := mkdirAllJournaled(episodeDir); err != nil {
+				return "", err
+			}
 		}
 
 		// Log(episode.SeasonNumber, episode.EpisodeNumber, episode.ID, episode.Name, path, "→", targetFileName)
-		linkVideoFileAndRelatedItems(path, outputDir, targetFileName, false)
+		var linkedFiles []LinkedFile
+		var linkErr error
+		if path.isDiscFolder() {
+			linkedFiles, linkErr = linkDiscFolder(path, episodeDir.appendingPathComponent(targetFileName), output)
+		} else {
+			linkedFiles, linkErr = linkVideoFileAndRelatedItems(path, episodeDir, targetFileName, false, output)
+		}
+		if linkErr != nil {
+			Log("❌", linkErr)
+		}
+		trackFiles, linkErr := linkExternalTracks(tracksOfVideo(tracks, path, mediaInfo.VideoFiles), episodeDir, targetFileName, output)
+		if linkErr != nil {
+			Log("❌", linkErr)
+		}
+		linkedFiles = append(linkedFiles, trackFiles...)
+		if recordErr := index.recordLinkedFiles(mediaInfo.Path, linkedFiles); recordErr != nil {
+			Log("❌ failed to record linked files", recordErr)
+		}
 
 		// create episode .nfo file if needed
-		nfoPath := outputDir.appendingPathComponent(targetFileName + ".nfo")
-		if (!ok || mediaInfo.Info.Id.idType != TMDB) && !nfoPath.exists() {
-			writeEpisodeNfo(s, e, episode.Name, "", mediaInfo.Info, nfoPath)
+		nfoPath := episodeDir.appendingPathComponent(targetFileName + ".nfo")
+		if output.writesNfo() && (!ok || mediaInfo.Info.Id.idType != TMDB) && !nfoPath.exists() {
+			release := parseReleaseName(path.removingPathExtension().lastPathComponent(), true).merge(folderRelease)
+			writeEpisodeNfo(s, e, episode.Name, "", mediaInfo.Info, probeStreamDetails([]Path{path}, release), nfoPath)
 		}
 	}
+	if linkErr := linkExtras(mediaInfo.Extras, outputDir, "", true, output, mediaInfo.Path, index); linkErr != nil {
+		Log("❌", linkErr)
+	}
 
 	return outputDir, err
 }
 
+// loadExternalIds fills IMDb and TVDB ids of a TMDb item for Plex folder name hints
+func loadExternalIds(ctx context.Context, info MediaInfo, config Config) MediaInfo {
+	if info.Id.idType != TMDB || (info.ImdbId != "" && (!info.IsTvShow || info.TvdbId != "")) {
+		return info
+	}
+	api := TMDbAPI{ApiKey: config.TMDbApiKey}
+	externalIds, err := api.LoadExternalIds(ctx, info.Id.id, info.IsTvShow)
+	if err != nil {
+		Log("⚠️ failed to load external ids for", info.Title, err)
+		return info
+	}
+	info.ImdbId = Coalesce(info.ImdbId, externalIds.IMDbId)
+	if externalIds.TVDbId > 0 && info.TvdbId == "" {
+		info.TvdbId = strconv.Itoa(externalIds.TVDbId)
+	}
+	return info
+}
+
+// episode is linked by name, by symlink target or is a hard link of an existing file
+func isEpisodeLinked(path Path, existingFiles []Path, linkedSources map[string]bool, linkedIdentities map[FileIdentity]bool) bool {
+	if indexOfEpisode(existingFiles, path.lastPathComponent()) != -1 || linkedSources[strings.ToLower(string(path))] {
+		return true
+	}
+	identity, ok := fileIdentity(path)
+	return ok && linkedIdentities[identity.withoutLinks()]
+}
+
 func indexOfEpisode(existingFiles []Path, fileName string) int {
 	fileNameLowercase := strings.ToLower(fileName)
 	for idx, path := range existingFiles {
@@ -751,13 +891,13 @@ func indexOfEpisode(existingFiles []Path, fileName string) int {
 	return -1
 }
 
-func getEpisodesMap(existing map[int]map[int]TMDbEpisode, existingEpisodes []TMDbEpisode, id MediaId, config Config) (map[int]map[int]TMDbEpisode, []TMDbEpisode, error) {
+func getEpisodesMap(ctx context.Context, existing map[int]map[int]TMDbEpisode, existingEpisodes []TMDbEpisode, id MediaId, config Config) (map[int]map[int]TMDbEpisode, []TMDbEpisode, error) {
 	if existing != nil {
 		return existing, existingEpisodes, nil
 	}
 
 	api := TMDbAPI{ApiKey: config.TMDbApiKey, MovieGenres: config.TMDbMovieGenres, TvGenres: config.TMDbTvGenres}
-	episodes, err := api.getSeriesEpisodes(id)
+	episodes, err := api.getSeriesEpisodes(ctx, id)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -0,0 +1,82 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// mountIdOf returns the ID of the mount containing the path from /proc/self/mountinfo
+// hard links can't cross mounts even if they share the device (bind mounts)
+func mountIdOf(path Path) (int, bool) {
+	resolved, ok := resolveExistingPath(path)
+	if !ok {
+		return 0, false
+	}
+	file, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return 0, false
+	}
+	defer file.Close()
+
+	mountId, mountPointLen := 0, -1
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		// 36 35 98:0 /mnt1 /mnt/parent rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		mountPoint := unescapeMountPoint(fields[4])
+		if !isPathInside(resolved, mountPoint) || len(mountPoint) <= mountPointLen {
+			continue
+		}
+		if id, err := strconv.Atoi(fields[0]); err == nil {
+			mountId, mountPointLen = id, len(mountPoint)
+		}
+	}
+	return mountId, mountPointLen >= 0
+}
+
+// resolveExistingPath resolves symlinks of the path or its nearest existing parent
+func resolveExistingPath(path Path) (string, bool) {
+	var missing []string
+	for {
+		if resolved, err := filepath.EvalSymlinks(string(path)); err == nil {
+			return filepath.Join(append([]string{resolved}, missing...)...), true
+		}
+		parent := path.removingLastPathComponent()
+		if parent == path {
+			return "", false
+		}
+		missing = append([]string{path.lastPathComponent()}, missing...)
+		path = parent
+	}
+}
+
+func isPathInside(path string, dir string) bool {
+	return dir == "/" || path == dir || strings.HasPrefix(path, dir+"/")
+}
+
+// mountinfo escapes spaces, tabs, newlines and backslashes as octal `\040`
+func unescapeMountPoint(mountPoint string) string {
+	if !strings.Contains(mountPoint, `\`) {
+		return mountPoint
+	}
+	var builder strings.Builder
+	for i := 0; i < len(mountPoint); i++ {
+		if mountPoint[i] == '\\' && i+3 < len(mountPoint) {
+			if code, err := strconv.ParseUint(mountPoint[i+1:i+4], 8, 8); err == nil {
+				builder.WriteByte(byte(code))
+				i += 3
+				continue
+			}
+		}
+		builder.WriteByte(mountPoint[i])
+	}
+	return builder.String()
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package main
+
+// mount IDs are only read on Linux, other systems compare device IDs or volume names
+func mountIdOf(path Path) (int, bool) {
+	return 0, false
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"sort"
 	"strconv"
 )
 
@@ -13,17 +15,17 @@ type MovieSearchResult struct {
 type MovieAPI interface {
 	TMDbAPI | IMDbAPI | KinopoiskAPI
 
-	FindMovies(title string, year string, page int) (MovieSearchResult, error)
+	FindMovies(ctx context.Context, title string, year string, page int) (MovieSearchResult, error)
 }
 
-func findMovieByTitle[API MovieAPI](api API, title string, year string) (MediaInfo, int /*score*/, error) {
+func findMovieByTitle[API MovieAPI](ctx context.Context, api API, title string, year string) (MediaInfo, int /*score*/, error) {
 	var bestMatch MediaInfo
 	bestScore := 0
 
 	page := 1
 	totalPages := -1
 	for {
-		result, err := api.FindMovies(title, year, page)
+		result, err := api.FindMovies(ctx, title, year, page)
 		if err != nil {
 			return MediaInfo{}, 0, err
 		}
@@ -71,59 +73,11 @@ func findBestMatchingMediaInfo(movies []MediaInfo, query string, year string) (
 	bestMatch := -1
 
 	for idx, movie := range movies {
-		var score int
-
-		origTitle := TransliterateToLatin(movie.OriginalTitle)
-		title := TransliterateToLatin(movie.Title)
-		altTitle := TransliterateToLatin(movie.AlternativeTitle)
-		queryTitle := TransliterateToLatin(query)
-
-		if title == "" && origTitle != "" {
-			title = origTitle
-		}
-		if title == "" && origTitle == "" {
-			Log("no title!", movie)
+		score, ok := scoreMediaInfo(movie, query, year)
+		if !ok {
 			continue
 		}
 
-		useJaroWinkler := false
-		if year != "" && year != movie.Year {
-			if movie.Year != "" {
-				queryTitle += " (" + year + ")"
-			}
-			if origTitle != "" {
-				origTitle += " (" + movie.Year + ")"
-			}
-			if altTitle != "" {
-				altTitle += " (" + movie.Year + ")"
-			}
-			title += " (" + movie.Year + ")"
-		} else if year == movie.Year {
-			// give more points if the titles have common beginning
-			useJaroWinkler = true
-		}
-
-		// Log(movie.Id, "➡️ checking", origTitle, title, "⬅", queryTitle)
-		if origTitle != "" && origTitle != title {
-			score = max(computeSimilarityScore(title, queryTitle, useJaroWinkler),
-				computeSimilarityScore(origTitle, queryTitle, useJaroWinkler))
-		} else {
-			score = computeSimilarityScore(title, queryTitle, useJaroWinkler)
-		}
-		if altTitle != "" && altTitle != title && altTitle != origTitle {
-			score = max(score, computeSimilarityScore(altTitle, queryTitle, useJaroWinkler))
-		}
-
-		if year != "" && movie.Year != "" {
-			y1, _ := strconv.Atoi(year)
-			y2, _ := strconv.Atoi(movie.Year)
-
-			// consider totally different year if more than 2 years difference
-			if max(y1, y2)-min(y1, y2) > 2 {
-				score = max(0, score-20)
-			}
-		}
-
 		if score > bestScore {
 			bestScore = score
 			bestMatch = idx
@@ -132,9 +86,90 @@ func findBestMatchingMediaInfo(movies []MediaInfo, query string, year string) (
 		if score == 100 {
 			break
 		}
-
-		// Log("⬅️ score:", score)
 	}
 
 	return bestMatch, bestScore
 }
+
+// scoreMediaInfo returns the similarity of the movie to the query title and year, false if the movie has no title
+func scoreMediaInfo(movie MediaInfo, query string, year string) (int, bool) {
+	var score int
+
+	origTitle := TransliterateToLatin(movie.OriginalTitle)
+	title := TransliterateToLatin(movie.Title)
+	altTitle := TransliterateToLatin(movie.AlternativeTitle)
+	queryTitle := TransliterateToLatin(query)
+
+	if title == "" && origTitle != "" {
+		title = origTitle
+	}
+	if title == "" && origTitle == "" {
+		Log("no title!", movie)
+		return 0, false
+	}
+
+	useJaroWinkler := false
+	if year != "" && year != movie.Year {
+		if movie.Year != "" {
+			queryTitle += " (" + year + ")"
+		}
+		if origTitle != "" {
+			origTitle += " (" + movie.Year + ")"
+		}
+		if altTitle != "" {
+			altTitle += " (" + movie.Year + ")"
+		}
+		title += " (" + movie.Year + ")"
+	} else if year == movie.Year {
+		// give more points if the titles have common beginning
+		useJaroWinkler = true
+	}
+
+	// Log(movie.Id, "➡️ checking", origTitle, title, "⬅", queryTitle)
+	if origTitle != "" && origTitle != title {
+		score = max(computeSimilarityScore(title, queryTitle, useJaroWinkler),
+			computeSimilarityScore(origTitle, queryTitle, useJaroWinkler))
+	} else {
+		score = computeSimilarityScore(title, queryTitle, useJaroWinkler)
+	}
+	if altTitle != "" && altTitle != title && altTitle != origTitle {
+		score = max(score, computeSimilarityScore(altTitle, queryTitle, useJaroWinkler))
+	}
+
+	if year != "" && movie.Year != "" {
+		y1, _ := strconv.Atoi(year)
+		y2, _ := strconv.Atoi(movie.Year)
+
+		// consider totally different year if more than 2 years difference
+		if max(y1, y2)-min(y1, y2) > 2 {
+			score = max(0, score-20)
+		}
+	}
+
+	// Log("⬅️ score:", score)
+	return score, true
+}
+
+// ScoredMediaInfo is a search result with its similarity score
+type ScoredMediaInfo struct {
+	Info  MediaInfo
+	Score int
+}
+
+// findMovieCandidates returns the scored results of the first search page, best first
+func findMovieCandidates[API MovieAPI](ctx context.Context, api API, title string, year string) ([]ScoredMediaInfo, error) {
+	result, err := api.FindMovies(ctx, title, year, 1)
+	if err != nil {
+		return nil, err
+	}
+	var candidates []ScoredMediaInfo
+	for _, movie := range result.Results {
+		if score, ok := scoreMediaInfo(movie, title, year); ok {
+			candidates = append(candidates, ScoredMediaInfo{Info: movie, Score: score})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Score > candidates[j].Score
+	})
+	return candidates, nil
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// the movie box is read into memory up to this size
+const mp4MaxMoovSize = 64 << 20
+
+// mp4Boxes calls fn for each box in the data of a container box
+func mp4Boxes(data []byte, fn func(boxType string, body []byte)) {
+	for len(data) >= 8 {
+		size := uint64(binary.BigEndian.Uint32(data))
+		boxType := string(data[4:8])
+		headerSize := uint64(8)
+		if size == 1 && len(data) >= 16 {
+			size = binary.BigEndian.Uint64(data[8:])
+			headerSize = 16
+		} else if size == 0 {
+			size = uint64(len(data))
+		}
+		if size < headerSize || size > uint64(len(data)) {
+			return
+		}
+		fn(boxType, data[headerSize:size])
+		data = data[size:]
+	}
+}
+
+// parseMP4 finds the movie box among the top-level boxes and reads its tracks
+func parseMP4(r io.ReadSeeker) (StreamDetails, error) {
+	header := make([]byte, 16)
+	for {
+		if _, err := io.ReadFull(r, header[:8]); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return StreamDetails{}, fmt.Errorf("no MP4 movie box found")
+			}
+			return StreamDetails{}, err
+		}
+		size := uint64(binary.BigEndian.Uint32(header))
+		boxType := string(header[4:8])
+		headerSize := uint64(8)
+		if size == 1 {
+			if _, err := io.ReadFull(r, header[8:16]); err != nil {
+				return StreamDetails{}, err
+			}
+			size = binary.BigEndian.Uint64(header[8:])
+			headerSize = 16
+		} else if size == 0 && boxType != "moov" {
+			// the last box runs to the end of the file
+			return StreamDetails{}, fmt.Errorf("no MP4 movie box found")
+		}
+		if size != 0 && size < headerSize {
+			return StreamDetails{}, fmt.Errorf("invalid MP4 box size %d", size)
+		}
+
+		if boxType != "moov" {
+			if _, err := r.Seek(int64(size-headerSize), io.SeekCurrent); err != nil {
+				return StreamDetails{}, err
+			}
+			continue
+		}
+		var data []byte
+		var err error
+		if size == 0 {
+			data, err = io.ReadAll(io.LimitReader(r, mp4MaxMoovSize))
+		} else if size-headerSize > mp4MaxMoovSize {
+			return StreamDetails{}, fmt.Errorf("MP4 movie box too large: %d bytes", size)
+		} else {
+			data = make([]byte, size-headerSize)
+			_, err = io.ReadFull(r, data)
+		}
+		if err != nil {
+			return StreamDetails{}, err
+		}
+		return parseMP4Movie(data), nil
+	}
+}
+
+func parseMP4Movie(moov []byte) StreamDetails {
+	var details StreamDetails
+	mp4Boxes(moov, func(boxType string, body []byte) {
+		switch boxType {
+		case "mvhd":
+			details.Duration = parseMP4Duration(body, 12, 20)
+		case "trak":
+			parseMP4Track(body, &details)
+		}
+	})
+	return details
+}
+
+// parseMP4Duration reads the timescale and duration of a movie or media header,
+// offsets are those of version 0 and version 1 headers
+func parseMP4Duration(header []byte, offset0 int, offset1 int) time.Duration {
+	if len(header) < 4 {
+		return 0
+	}
+	var timescale, duration uint64
+	if header[0] == 1 {
+		if len(header) < offset1+12 {
+			return 0
+		}
+		timescale = uint64(binary.BigEndian.Uint32(header[offset1:]))
+		duration = binary.BigEndian.Uint64(header[offset1+4:])
+	} else {
+		if len(header) < offset0+8 {
+			return 0
+		}
+		timescale = uint64(binary.BigEndian.Uint32(header[offset0:]))
+		duration = uint64(binary.BigEndian.Uint32(header[offset0+4:]))
+	}
+	if timescale == 0 {
+		return 0
+	}
+	return time.Duration(float64(duration) / float64(timescale) * float64(time.Second))
+}
+
+func parseMP4Track(trak []byte, details *StreamDetails) {
+	var handler, language string
+	var sampleEntryType string
+	var sampleEntry []byte
+	mp4Boxes(trak, func(boxType string, body []byte) {
+		if boxType != "mdia" {
+			return
+		}
+		mp4Boxes(body, func(boxType string, body []byte) {
+			switch boxType {
+			case "mdhd":
+				language = parseMP4Language(body)
+			case "hdlr":
+				if len(body) >= 12 {
+					handler = string(body[8:12])
+				}
+			case "minf":
+				mp4Boxes(body, func(boxType string, body []byte) {
+					if boxType != "stbl" {
+						return
+					}
+					mp4Boxes(body, func(boxType string, body []byte) {
+						// the first sample description after the version, flags and entry count
+						if boxType == "stsd" && len(body) > 8 {
+							mp4Boxes(body[8:], func(boxType string, body []byte) {
+								if sampleEntry == nil {
+									sampleEntryType, sampleEntry = boxType, body
+								}
+							})
+						}
+					})
+				})
+			}
+		})
+	})
+
+	switch handler {
+	case "vide":
+		video := VideoStream{Codec: mp4CodecName(sampleEntryType)}
+		if sampleEntryType == "dvh1" || sampleEntryType == "dvhe" || sampleEntryType == "dvav" || sampleEntryType == "dva1" {
+			video.HDR = "dolbyvision"
+		}
+		// visual sample entry fields are followed by boxes like `colr`
+		if len(sampleEntry) >= 78 {
+			video.Width = int(binary.BigEndian.Uint16(sampleEntry[24:]))
+			video.Height = int(binary.BigEndian.Uint16(sampleEntry[26:]))
+			mp4Boxes(sampleEntry[78:], func(boxType string, body []byte) {
+				switch boxType {
+				case "colr":
+					if video.HDR == "" && len(body) >= 8 && (string(body[:4]) == "nclx" || string(body[:4]) == "nclc") {
+						video.HDR = hdrTypeOfTransfer(uint64(binary.BigEndian.Uint16(body[6:])))
+					}
+				case "dvcC", "dvvC":
+					video.HDR = "dolbyvision"
+				}
+			})
+		}
+		details.Video = append(details.Video, video)
+	case "soun":
+		audio := AudioStream{Codec: mp4CodecName(sampleEntryType), Language: streamLanguage(language)}
+		if len(sampleEntry) >= 18 {
+			audio.Channels = int(binary.BigEndian.Uint16(sampleEntry[16:]))
+		}
+		details.Audio = append(details.Audio, audio)
+	case "sbtl", "subt", "text":
+		details.Subtitles = append(details.Subtitles, SubtitleStream{Codec: mp4CodecName(sampleEntryType), Language: streamLanguage(language)})
+	}
+}
+
+// parseMP4Language unpacks the ISO 639-2 language of a media header
+func parseMP4Language(mdhd []byte) string {
+	offset := 20
+	if len(mdhd) > 0 && mdhd[0] == 1 {
+		offset = 32
+	}
+	if len(mdhd) < offset+2 {
+		return ""
+	}
+	packed := binary.BigEndian.Uint16(mdhd[offset:])
+	if packed == 0 || packed == 0x7FFF {
+		return ""
+	}
+	return string([]byte{byte(packed>>10&0x1F) + 0x60, byte(packed>>5&0x1F) + 0x60, byte(packed&0x1F) + 0x60})
+}
+
+var mp4Codecs = map[string]string{
+	"avc1": "h264", "avc3": "h264", "dvav": "h264", "dva1": "h264",
+	"hvc1": "hevc", "hev1": "hevc", "dvh1": "hevc", "dvhe": "hevc",
+	"av01": "av1", "vp09": "vp9", "mp4v": "mpeg4",
+	"mp4a": "aac", "ac-3": "ac3", "ec-3": "eac3", "Opus": "opus", "fLaC": "flac", "dtsc": "dca", "dtsh": "dtshd_ma", "dtsl": "dtshd_ma",
+	"tx3g": "mov_text", "wvtt": "webvtt", "stpp": "ttml",
+}
+
+// mp4CodecName returns the Kodi name of a sample entry type like `avc1`
+func mp4CodecName(sampleEntryType string) string {
+	if name, ok := mp4Codecs[sampleEntryType]; ok {
+		return name
+	}
+	return sampleEntryType
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// NamingConfig overrides output names of a profile with templates, e.g.
+// movie: `{title} ({year})/{title} ({year})`,
+// episode: `{show} ({year})/Season {season:02}/{show} S{season:02}E{episode:02} {episode_title}`
+// `/` separates folders, the last segment is the video file name without extension
+type NamingConfig struct {
+	Movie   string `json:"movie,omitempty"`
+	Episode string `json:"episode,omitempty"`
+}
+
+var movieNamingVariables = []string{"title", "original_title", "year", "imdb", "tmdb", "id_tag", "edition"}
+var episodeNamingVariables = []string{"show", "original_title", "year", "imdb", "tmdb", "tvdb", "id_tag", "season", "episode", "episode_title"}
+
+var namingVariableRegex = regexp.MustCompile(`\{(\w+)(?::(\d+))?\}`)
+
+// brackets left empty by missing values, e.g. `Title ()`
+var emptyBracketsRegex = regexp.MustCompile(`\s*(\(\s*\)|\[\s*\])`)
+
+func validateNamingTemplate(template string, variables []string) error {
+	if strings.HasPrefix(template, "/") || strings.Contains(template, "..") {
+		return fmt.Errorf("naming template `%s` must be relative", template)
+	}
+	for _, match := range namingVariableRegex.FindAllStringSubmatch(template, -1) {
+		if findIndex(variables, match[1]) == -1 {
+			return fmt.Errorf("unknown variable `%s` in naming template `%s`, expected one of %v", match[1], template, variables)
+		}
+	}
+	return nil
+}
+
+// validateShowFolderTemplate checks the first folder of a nested episode template names the show,
+// it's shared by all episodes so e.g. `Season {season:02}/…` would put every show into `Season 00`
+func validateShowFolderTemplate(template string) error {
+	if !strings.Contains(template, "/") {
+		return nil
+	}
+	showFolder := strings.Split(template, "/")[0]
+	if !strings.Contains(showFolder, "{show}") && !strings.Contains(showFolder, "{original_title}") {
+		return fmt.Errorf("the first folder of naming template `%s` must contain {show}", template)
+	}
+	for _, match := range namingVariableRegex.FindAllStringSubmatch(showFolder, -1) {
+		switch match[1] {
+		case "season", "episode", "episode_title":
+			return fmt.Errorf("the show folder of naming template `%s` can't depend on {%s}", template, match[1])
+		}
+	}
+	return nil
+}
+
+// renderNamingTemplate substitutes variables and returns sanitized path segments
+// `{season:02}` pads numbers with zeroes to the given width
+func renderNamingTemplate(template string, values map[string]interface{}) []string {
+	var segments []string
+	for _, segment := range strings.Split(template, "/") {
+		rendered := namingVariableRegex.ReplaceAllStringFunc(segment, func(variable string) string {
+			match := namingVariableRegex.FindStringSubmatch(variable)
+			switch value := values[match[1]].(type) {
+			case int:
+				if match[2] != "" {
+					return fmt.Sprintf("%0"+match[2]+"d", value)
+				}
+				return fmt.Sprint(value)
+			case string:
+				return value
+			default:
+				return ""
+			}
+		})
+		rendered = emptyBracketsRegex.ReplaceAllString(rendered, "")
+		rendered = sanitizeFileName(strings.TrimRight(strings.TrimSpace(rendered), " -_"))
+		if rendered != "" {
+			segments = append(segments, rendered)
+		}
+	}
+	return segments
+}
+
+func (d OutputDir) movieNamingValues(info MediaInfo, edition string) map[string]interface{} {
+	values := map[string]interface{}{
+		"title":          Coalesce(info.Title, info.OriginalTitle),
+		"original_title": Coalesce(info.OriginalTitle, info.Title),
+		"year":           info.Year,
+		"imdb":           info.ImdbId,
+		"id_tag":         d.profileIdTag(info),
+		"edition":        edition,
+	}
+	switch info.Id.idType {
+	case IMDB:
+		values["imdb"] = info.Id.id
+	case TMDB:
+		values["tmdb"] = info.Id.id
+	}
+	return values
+}
+
+func (d OutputDir) episodeNamingValues(show MediaInfo, season int, episode int, episodeTitle string) map[string]interface{} {
+	values := d.movieNamingValues(show, "")
+	values["show"] = values["title"]
+	values["tvdb"] = show.TvdbId
+	values["season"] = season
+	values["episode"] = episode
+	values["episode_title"] = episodeTitle
+	return values
+}
+
+// profileIdTag returns the id tag the profile puts into folder names, empty for Kodi
+func (d OutputDir) profileIdTag(info MediaInfo) string {
+	switch d.profile() {
+	case PlexProfile:
+		return plexIdTag(info)
+	case JellyfinProfile, EmbyProfile:
+		return d.idTag(info.Id)
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestRenderNamingTemplate(t *testing.T) {
+	values := map[string]interface{}{
+		"show":          "Doctor Who: Specials",
+		"year":          "",
+		"season":        1,
+		"episode":       2,
+		"episode_title": "",
+	}
+	segments := renderNamingTemplate("{show} ({year})/Season {season:02}/{show} S{season:02}E{episode:02} - {episode_title}", values)
+	expected := []string{"Doctor Who - Specials", "Season 01", "Doctor Who - Specials S01E02"}
+	if !reflect.DeepEqual(segments, expected) {
+		t.Errorf("expected %v, got %v", expected, segments)
+	}
+}
+
+func TestNamingTemplateValidation(t *testing.T) {
+	var output OutputDir
+	if err := json.Unmarshal([]byte(`{"path": "/out", "naming": {"movie": "{title} ({year})/{title}"}}`), &output); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(`{"path": "/out", "naming": {"movie": "{name}"}}`), &output); err == nil {
+		t.Errorf("expected an error for unknown variable")
+	}
+	if err := json.Unmarshal([]byte(`{"path": "/out", "naming": {"episode": "../{show}"}}`), &output); err == nil {
+		t.Errorf("expected an error for template leaving the output dir")
+	}
+	if err := json.Unmarshal([]byte(`{"path": "/out", "naming": {"episode": "Season {season:02}/{show} - S{season:02}E{episode:02}"}}`), &output); err == nil {
+		t.Errorf("expected an error for show folder without the show")
+	}
+	if err := json.Unmarshal([]byte(`{"path": "/out", "naming": {"episode": "{show} S{season:02}/{show} E{episode:02}"}}`), &output); err == nil {
+		t.Errorf("expected an error for show folder depending on the season")
+	}
+	if err := json.Unmarshal([]byte(`{"path": "/out", "naming": {"episode": "{show} S{season:02}E{episode:02}"}}`), &output); err != nil {
+		t.Errorf("unexpected error for flat episode template: %v", err)
+	}
+}
+
+func TestTemplatedOutputLayout(t *testing.T) {
+	movie := MediaFilesInfo{
+		Path:       "/media/Goodfellas.1990.720p.BluRay.11xRus.Eng-DON.mkv",
+		VideoFiles: []Path{"/media/Goodfellas.1990.720p.BluRay.11xRus.Eng-DON.mkv"},
+		Info:       MediaInfo{Id: MediaId{id: "769", idType: TMDB}, Title: "Goodfellas", Year: "1990"},
+	}
+
+	flat := OutputDir{Path: "/out/movies", Naming: NamingConfig{Movie: "{title} ({year})"}}
+	dir, fileName, item := flat.movieLocation(movie)
+	if dir != "/out/movies" || fileName != "Goodfellas (1990)" || item != "/out/movies/Goodfellas (1990).mkv" {
+		t.Errorf("unexpected movie location %s, %s, %s", dir, fileName, item)
+	}
+	upperCase := movie
+	upperCase.VideoFiles = []Path{"/media/Goodfellas.1990.MKV"}
+	if _, _, item := flat.movieLocation(upperCase); item != "/out/movies/Goodfellas (1990).MKV" {
+		t.Errorf("output item %s doesn't keep the extension of the link", item)
+	}
+	if flat.usesSourceNames(false) || !flat.usesSourceNames(true) {
+		t.Errorf("unexpected source naming for templated movies")
+	}
+
+	nested := OutputDir{Path: "/out/movies", Profile: JellyfinProfile, Naming: NamingConfig{Movie: "{year}/{title} {id_tag}/{title}"}}
+	dir, fileName, item = nested.movieLocation(movie)
+	if dir != "/out/movies/1990/Goodfellas [tmdbid-769]" || fileName != "Goodfellas" || item != dir {
+		t.Errorf("unexpected movie location %s, %s, %s", dir, fileName, item)
+	}
+
+	series := OutputDir{Path: "/out/series", Naming: NamingConfig{Episode: "{show} ({year})/Season {season:02}/{show} S{season:02}E{episode:02} {episode_title}"}}
+	show := MediaInfo{Title: "Game of Thrones", Year: "2011", IsTvShow: true}
+	showDir := series.tvShowDir(MediaFilesInfo{Path: "/media/GoT.S01.1080p", Info: show})
+	if showDir != "/out/series/Game of Thrones (2011)" {
+		t.Errorf("unexpected show dir %s", showDir)
+	}
+	episodeDir, episodeName := series.episodeLocation(showDir, show, 1, 2, "The Kingsroad", "/media/GoT.S01.1080p/got.s01e02.mkv")
+	if episodeDir != "/out/series/Game of Thrones (2011)/Season 01" || episodeName != "Game of Thrones S01E02 The Kingsroad" {
+		t.Errorf("unexpected episode location %s/%s", episodeDir, episodeName)
+	}
+}
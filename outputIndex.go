@@ -0,0 +1,373 @@
+package main
+
+import (
+	"database/sql"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// OutputIndex maps source media items to the output items made for them
+// it's used to find already processed items when output names don't match source names,
+// the methods are safe for concurrent use
+type OutputIndex struct {
+	// lowercased link target → top-level output item (movie file or folder, TV Show folder)
+	items map[string]Path
+	// hard linked output video file → top-level output item
+	identities map[FileIdentity]Path
+	// top-level output item → source media items, recorded in the database;
+	// a TV Show folder may be made of several season torrents
+	sources map[Path][]Path
+	// lowercased source media item and each of its parent folders → output items of the source or nested sources
+	sourceItems map[string][]Path
+	// lowercased source file → files placed into output dirs, recorded in the database
+	links map[string][]Path
+	// hard linked, copied or reflinked output file → source file, recorded in the database
+	linkedSources map[FileIdentity]Path
+	// lowercased source file → identities of its hard linked, copied or reflinked output files
+	linkedIdentities map[string][]FileIdentity
+	db               *sql.DB
+	// guards the maps and serializes database writes
+	mutex sync.Mutex
+}
+
+// load recorded output items from the database and scan output directories for video links
+func buildOutputIndex(config Config) (*OutputIndex, error) {
+	index := &OutputIndex{
+		items:      make(map[string]Path),
+		identities: make(map[FileIdentity]Path),
+		sources:    make(map[Path][]Path),
+		links:      make(map[string][]Path),
+
+		sourceItems:      make(map[string][]Path),
+		linkedSources:    make(map[FileIdentity]Path),
+		linkedIdentities: make(map[string][]FileIdentity),
+	}
+	if config.Database != "" {
+		db, err := initializeDB(string(config.Database))
+		if err != nil {
+			return nil, err
+		}
+		index.db = db
+		outputItems, err := loadOutputItems(db)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		for outputItem, sources := range outputItems {
+			index.sources[Path(outputItem)] = mapSlice(sources, func(source string) Path { return Path(source) })
+			for _, source := range sources {
+				index.indexOutputItemSource(Path(source), Path(outputItem))
+			}
+		}
+		linkedFiles, err := loadLinkedFiles(db)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		for _, linkedFile := range linkedFiles {
+			source := strings.ToLower(linkedFile.SourcePath)
+			index.links[source] = append(index.links[source], Path(linkedFile.LinkPath))
+			if linkedFile.Inode != 0 {
+				index.rememberLinkedIdentity(Path(linkedFile.SourcePath), FileIdentity{Device: linkedFile.Device, Inode: linkedFile.Inode})
+			}
+		}
+	}
+
+	for idx, outputDirs := range [][]OutputDir{config.Output.Movies, config.Output.Series} {
+		isTvShow := idx == 1
+		for _, output := range outputDirs {
+			if !output.Path.isDirectory() {
+				continue
+			}
+			root := string(output.Path)
+			filepath.WalkDir(root, func(s string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return nil
+				}
+				// skip the trash and other hidden folders
+				if d.IsDir() && s != root && strings.HasPrefix(d.Name(), ".") {
+					return filepath.SkipDir
+				}
+				if d.IsDir() || !Path(s).isVideoFile() {
+					return nil
+				}
+				relPath, err := filepath.Rel(root, s)
+				if err != nil {
+					return nil
+				}
+				item := output.outputItemOfFile(relPath, isTvShow)
+				if d.Type()&fs.ModeSymlink != 0 {
+					if target, err := output.readLinkTarget(Path(s)); err == nil {
+						index.items[strings.ToLower(string(target))] = item
+					}
+				} else if identity, ok := fileIdentity(Path(s)); ok {
+					// copies and reflinks are known by the recorded identities only
+					if _, recorded := index.linkedSources[identity.withoutLinks()]; recorded || identity.Links > 1 {
+						index.identities[identity.withoutLinks()] = item
+					}
+				}
+				return nil
+			})
+		}
+	}
+	Log("indexed", len(index.sources), "recorded output items,", len(index.items), "output video symlinks,", len(index.identities), "hardlinks and copies")
+	return index, nil
+}
+
+func (index *OutputIndex) Close() error {
+	if index == nil || index.db == nil {
+		return nil
+	}
+	return index.db.Close()
+}
+
+// find top-level output items recorded for the source item or its nested files, or linking any of the video files
+func (index *OutputIndex) findOutputItems(sourcePath Path, videoFiles []Path) []Path {
+	if index == nil {
+		return nil
+	}
+	// files are checked outside the lock, so workers don't wait for each other's disk access
+	hardLinked := make(map[Path]FileIdentity)
+	for _, videoFile := range videoFiles {
+		if identity, ok := fileIdentity(videoFile); ok && identity.Links > 1 {
+			hardLinked[videoFile] = identity.withoutLinks()
+		}
+	}
+
+	index.mutex.Lock()
+	recorded := append([]Path(nil), index.sourceItems[strings.ToLower(string(sourcePath))]...)
+	var linked []Path
+	for _, videoFile := range videoFiles {
+		if item, ok := index.items[strings.ToLower(string(videoFile))]; ok {
+			linked = appendOutputItem(linked, item)
+		}
+		if identity, ok := hardLinked[videoFile]; ok {
+			if item, ok := index.identities[identity]; ok {
+				linked = appendOutputItem(linked, item)
+			}
+		}
+		for _, identity := range index.linkedIdentities[strings.ToLower(string(videoFile))] {
+			if item, ok := index.identities[identity]; ok {
+				linked = appendOutputItem(linked, item)
+			}
+		}
+	}
+	index.mutex.Unlock()
+
+	sort.Slice(recorded, func(i, j int) bool { return recorded[i] < recorded[j] })
+	var items []Path
+	for _, outputItem := range recorded {
+		if outputItem.exists() {
+			items = appendOutputItem(items, outputItem)
+		}
+	}
+	for _, item := range linked {
+		items = appendOutputItem(items, item)
+	}
+	return items
+}
+
+// sourceOfLinkedFile returns the source file recorded for a hard linked, copied or reflinked output file
+func (index *OutputIndex) sourceOfLinkedFile(linkedFile Path) (Path, bool) {
+	if index == nil {
+		return "", false
+	}
+	identity, ok := fileIdentity(linkedFile)
+	if !ok {
+		return "", false
+	}
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	source, ok := index.linkedSources[identity.withoutLinks()]
+	return source, ok
+}
+
+func (index *OutputIndex) rememberLinkedIdentity(source Path, identity FileIdentity) {
+	index.linkedSources[identity] = source
+	sourceLower := strings.ToLower(string(source))
+	index.linkedIdentities[sourceLower] = appendUnique(index.linkedIdentities[sourceLower], identity)
+}
+
+// isLinked tells whether the source file was placed into the output dir in any link mode
+func (index *OutputIndex) isLinked(source Path, outputDir Path) bool {
+	if index == nil {
+		return false
+	}
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	outputPrefix := strings.ToLower(strings.TrimSuffix(string(outputDir.appendingPathComponent("a")), "a"))
+	for _, link := range index.links[strings.ToLower(string(source))] {
+		if strings.HasPrefix(strings.ToLower(string(link)), outputPrefix) && link.exists() {
+			return true
+		}
+	}
+	return false
+}
+
+// remember files placed into an output dir for the source media item
+func (index *OutputIndex) recordLinkedFiles(sourcePath Path, linkedFiles []LinkedFile) error {
+	if index == nil {
+		return nil
+	}
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	identities := make(map[Path]FileIdentity)
+	for _, linkedFile := range linkedFiles {
+		source := strings.ToLower(string(linkedFile.Source))
+		index.links[source] = append(index.links[source], linkedFile.Link)
+		// hard links and copies can't be traced back to the source like symlinks, remember their inodes
+		if identity, ok := fileIdentity(linkedFile.Link); ok && !linkedFile.Mode.isSymlink() {
+			identities[linkedFile.Link] = identity.withoutLinks()
+			index.rememberLinkedIdentity(linkedFile.Source, identity.withoutLinks())
+		}
+	}
+	if index.db == nil || len(linkedFiles) == 0 {
+		return nil
+	}
+	entityId, err := insertMediaEntity(index.db, string(sourcePath))
+	if err != nil {
+		return err
+	}
+	for _, linkedFile := range linkedFiles {
+		relativePath, err := filepath.Rel(string(sourcePath), string(linkedFile.Source))
+		if err != nil || relativePath == "." {
+			relativePath = ""
+		}
+		record := LinkedFileRecord{LinkPath: string(linkedFile.Link), LinkMode: string(linkedFile.Mode)}
+		if identity, ok := identities[linkedFile.Link]; ok {
+			record.Device, record.Inode = identity.Device, identity.Inode
+		}
+		if err := insertLinkedFile(index.db, entityId, relativePath, record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// source media items recorded for a top-level output item
+func (index *OutputIndex) sourcesOfOutputItem(outputItem Path) []Path {
+	if index == nil {
+		return nil
+	}
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	return append([]Path(nil), index.sources[outputItem]...)
+}
+
+// remember the output item made for a source media item, keeping other sources of the item
+func (index *OutputIndex) recordOutputItem(sourcePath Path, outputItem Path) error {
+	if index == nil || outputItem == "" {
+		return nil
+	}
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	index.sources[outputItem] = appendUnique(index.sources[outputItem], sourcePath)
+	index.indexOutputItemSource(sourcePath, outputItem)
+	if index.db == nil {
+		return nil
+	}
+	entityId, err := insertMediaEntity(index.db, string(sourcePath))
+	if err != nil {
+		return err
+	}
+	return insertOutputItem(index.db, entityId, string(outputItem))
+}
+
+// forget a removed output item
+func (index *OutputIndex) forgetOutputItem(outputItem Path) error {
+	if index == nil {
+		return nil
+	}
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	sources := index.sources[outputItem]
+	delete(index.sources, outputItem)
+	for _, source := range sources {
+		index.unindexOutputItemSource(source, outputItem)
+	}
+	if index.db == nil {
+		return nil
+	}
+	if err := deleteLinkedFiles(index.db, string(outputItem)); err != nil {
+		return err
+	}
+	return deleteOutputItem(index.db, string(outputItem))
+}
+
+// forget a single source of the output item, e.g. when a run recording it is undone
+func (index *OutputIndex) forgetOutputItemSource(sourcePath Path, outputItem Path) error {
+	if index == nil {
+		return nil
+	}
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	sources := filterSlice(index.sources[outputItem], func(source Path) bool { return source != sourcePath })
+	if len(sources) == 0 {
+		delete(index.sources, outputItem)
+	} else {
+		index.sources[outputItem] = sources
+	}
+	index.unindexOutputItemSource(sourcePath, outputItem)
+	if index.db == nil {
+		return nil
+	}
+	return deleteOutputItemSource(index.db, string(sourcePath), string(outputItem))
+}
+
+// keep the LLM's decision for review, failures are only logged
+func (index *OutputIndex) recordLLMDecision(decision *LLMDecision) {
+	if index == nil || index.db == nil || decision == nil {
+		return
+	}
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	if err := insertLLMDecision(index.db, *decision); err != nil {
+		Log("❌ failed to record LLM decision", decision.Path, err)
+	}
+}
+
+// sourceIndexKeys returns the lowercased source path and its parent folders
+func sourceIndexKeys(source Path) []string {
+	var keys []string
+	path := string(source)
+	for {
+		keys = append(keys, strings.ToLower(path))
+		parent := filepath.Dir(path)
+		if parent == path || parent == "." {
+			return keys
+		}
+		path = parent
+	}
+}
+
+func (index *OutputIndex) indexOutputItemSource(source Path, outputItem Path) {
+	for _, key := range sourceIndexKeys(source) {
+		index.sourceItems[key] = appendUnique(index.sourceItems[key], outputItem)
+	}
+}
+
+// unindexOutputItemSource drops the source of the output item, index.sources already lacks it
+func (index *OutputIndex) unindexOutputItemSource(source Path, outputItem Path) {
+	for _, key := range sourceIndexKeys(source) {
+		items := filterSlice(index.sourceItems[key], func(item Path) bool { return item != outputItem })
+		if len(items) == 0 {
+			delete(index.sourceItems, key)
+		} else {
+			index.sourceItems[key] = items
+		}
+	}
+	// remaining sources of the item may be in the same folders
+	for _, other := range index.sources[outputItem] {
+		index.indexOutputItemSource(other, outputItem)
+	}
+}
+
+func appendOutputItem(items []Path, item Path) []Path {
+	if findIndex(items, item) == -1 {
+		items = append(items, item)
+	}
+	return items
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOutputIndexRecordsItemsInDatabase(t *testing.T) {
+	dir := Path(t.TempDir())
+	source := dir.appendingPathComponent("media/Goodfellas.1990.720p.BluRay")
+	output := dir.appendingPathComponent("out/Goodfellas (1990)")
+	for _, path := range []Path{source, output} {
+		if err := os.MkdirAll(string(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config := Config{Database: dir.appendingPathComponent("media.db")}
+
+	index, err := buildOutputIndex(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := index.recordOutputItem(source.appendingPathComponent("movie.mkv"), output); err != nil {
+		t.Fatal(err)
+	}
+	index.Close()
+
+	// a new run finds the item by the source folder although the names differ
+	index, err = buildOutputIndex(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer index.Close()
+	if items := index.findOutputItems(source, nil); len(items) != 1 || items[0] != output {
+		t.Errorf("expected %s, got %v", output, items)
+	}
+	if items := index.findOutputItems(source+"2", nil); len(items) != 0 {
+		t.Errorf("unexpected items %v for another source", items)
+	}
+	if items := index.findOutputItems(dir.appendingPathComponent("MEDIA"), nil); len(items) != 1 || items[0] != output {
+		t.Errorf("expected %s for the parent folder, got %v", output, items)
+	}
+	if recorded := index.sourcesOfOutputItem(output); len(recorded) != 1 || recorded[0] != source.appendingPathComponent("movie.mkv") {
+		t.Errorf("unexpected sources %v", recorded)
+	}
+
+	if err := index.forgetOutputItem(output); err != nil {
+		t.Fatal(err)
+	}
+	if items := index.findOutputItems(source, nil); len(items) != 0 {
+		t.Errorf("expected no items after forgetting, got %v", items)
+	}
+	if items := index.findOutputItems(dir.appendingPathComponent("media"), nil); len(items) != 0 {
+		t.Errorf("expected no items for the parent folder after forgetting, got %v", items)
+	}
+}
+
+func TestOutputItemsMigrationAllowsSeveralSources(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "media.db")
+	db, err := openDB(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, statement := range []string{
+		"CREATE TABLE mediaEntities (id INTEGER PRIMARY KEY AUTOINCREMENT, path TEXT NOT NULL COLLATE NOCASE UNIQUE)",
+		"CREATE TABLE outputItems (id INTEGER PRIMARY KEY AUTOINCREMENT, entityId INTEGER NOT NULL, path TEXT NOT NULL COLLATE NOCASE UNIQUE)",
+		"INSERT INTO mediaEntities (path) VALUES ('/media/Show.S01')",
+		"INSERT INTO outputItems (entityId, path) VALUES (1, '/tv/Show')",
+	} {
+		if _, err := db.Exec(statement); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	db, err = initializeDB(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	entityId, err := insertMediaEntity(db, "/media/Show.S02")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := insertOutputItem(db, entityId, "/tv/Show"); err != nil {
+		t.Fatal(err)
+	}
+	items, err := loadOutputItems(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sources := items["/tv/Show"]; len(sources) != 2 || sources[0] != "/media/Show.S01" || sources[1] != "/media/Show.S02" {
+		t.Errorf("unexpected sources %v", sources)
+	}
+}
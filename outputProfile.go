@@ -0,0 +1,508 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// OutputProfile defines file and folder naming in an output directory
+type OutputProfile string
+
+const (
+	// flat movie links with `-poster.jpg` siblings, episodes prefixed with `S01E02 `
+	KodiProfile OutputProfile = "kodi"
+	// `Title (Year) [tmdbid-123]/Title (Year).mkv`, `Show (Year)/Season 01/Show S01E02.mkv`
+	JellyfinProfile OutputProfile = "jellyfin"
+	// same as Jellyfin but with `[tmdbid=123]` id tags
+	EmbyProfile OutputProfile = "emby"
+	// `Title (Year) {imdb-tt123}/Title (Year).mkv`, `Show (Year) {tvdb-123}/Season 01/Show - s01e02 - Episode Title.mkv`, no NFOs
+	PlexProfile OutputProfile = "plex"
+)
+
+type OutputConfig struct {
+	Movies []OutputDir `json:"movies"`
+	Series []OutputDir `json:"series"`
+
+	// explicit source → output directories for multi-disk setups
+	Mappings []OutputMapping `json:"mappings,omitempty"`
+}
+
+// OutputMapping sends media items from the source directory to the output directories
+type OutputMapping struct {
+	Source Path `json:"source"`
+	Movies Path `json:"movies,omitempty"`
+	Series Path `json:"series,omitempty"`
+}
+
+// validateMappings checks mapped outputs are configured output directories, which have profiles and link modes and get cleaned up
+func (o OutputConfig) validateMappings() error {
+	for _, mapping := range o.Mappings {
+		if mapping.Movies != "" && findOutputDir(o.Movies, mapping.Movies) == nil {
+			return fmt.Errorf("mapped output %s of %s is not listed in output movies", mapping.Movies, mapping.Source)
+		}
+		if mapping.Series != "" && findOutputDir(o.Series, mapping.Series) == nil {
+			return fmt.Errorf("mapped output %s of %s is not listed in output series", mapping.Series, mapping.Source)
+		}
+	}
+	return nil
+}
+
+func findOutputDir(directories []OutputDir, path Path) *OutputDir {
+	for idx, directory := range directories {
+		if filepath.Clean(string(directory.Path)) == filepath.Clean(string(path)) {
+			return &directories[idx]
+		}
+	}
+	return nil
+}
+
+type OutputDir struct {
+	Path     Path          `json:"path"`
+	Profile  OutputProfile `json:"profile,omitempty"`
+	Naming   NamingConfig  `json:"naming,omitempty"`
+	LinkMode LinkMode      `json:"link_mode,omitempty"`
+
+	// host → media player path prefixes for symlink targets
+	PathRewrites []PathRewrite `json:"path_rewrites,omitempty"`
+}
+
+// output directories may be listed as plain paths or as objects with a profile
+func (d *OutputDir) UnmarshalJSON(data []byte) error {
+	var path string
+	if err := json.Unmarshal(data, &path); err == nil {
+		*d = OutputDir{Path: Path(path)}
+		return nil
+	}
+
+	type outputDir OutputDir
+	var dir outputDir
+	if err := json.Unmarshal(data, &dir); err != nil {
+		return err
+	}
+	*d = OutputDir(dir)
+
+	switch d.profile() {
+	case KodiProfile, JellyfinProfile, EmbyProfile, PlexProfile:
+	default:
+		return fmt.Errorf("unknown output profile `%s` for %s", d.Profile, d.Path)
+	}
+	if !d.linkMode().isValid() {
+		return fmt.Errorf("unknown link mode `%s` for %s", d.LinkMode, d.Path)
+	}
+	if err := validateNamingTemplate(d.Naming.Movie, movieNamingVariables); err != nil {
+		return err
+	}
+	if err := validateNamingTemplate(d.Naming.Episode, episodeNamingVariables); err != nil {
+		return err
+	}
+	return validateShowFolderTemplate(d.Naming.Episode)
+}
+
+func (d OutputDir) profile() OutputProfile {
+	if d.Profile == "" {
+		return KodiProfile
+	}
+	return OutputProfile(strings.ToLower(string(d.Profile)))
+}
+
+func (d OutputDir) linkMode() LinkMode {
+	if d.LinkMode == "" {
+		return SymlinkMode
+	}
+	return d.LinkMode
+}
+
+// `Title (Year)`
+func titleWithYear(info MediaInfo) string {
+	title := Coalesce(info.Title, info.OriginalTitle)
+	if info.Year != "" {
+		title += " (" + info.Year + ")"
+	}
+	return title
+}
+
+// Jellyfin `[tmdbid-123]` or Emby `[tmdbid=123]` folder name tag
+func (d OutputDir) idTag(id MediaId) string {
+	separator := "-"
+	if d.profile() == EmbyProfile {
+		separator = "="
+	}
+	switch id.idType {
+	case TMDB:
+		return "[tmdbid" + separator + id.id + "]"
+	case IMDB:
+		return "[imdbid" + separator + id.id + "]"
+	default:
+		return ""
+	}
+}
+
+// Plex `{imdb-tt123}`, `{tvdb-123}` or `{tmdb-123}` folder name hint
+func plexIdTag(info MediaInfo) string {
+	imdbId := info.ImdbId
+	if info.Id.idType == IMDB {
+		imdbId = info.Id.id
+	}
+	tmdbId := ""
+	if info.Id.idType == TMDB {
+		tmdbId = info.Id.id
+	}
+
+	switch {
+	case info.IsTvShow && info.TvdbId != "":
+		return "{tvdb-" + info.TvdbId + "}"
+	case !info.IsTvShow && imdbId != "":
+		return "{imdb-" + imdbId + "}"
+	case tmdbId != "":
+		return "{tmdb-" + tmdbId + "}"
+	case imdbId != "":
+		return "{imdb-" + imdbId + "}"
+	default:
+		return ""
+	}
+}
+
+// folder named after the title with an id hint, e.g. `Title (Year) [tmdbid-123]`
+func (d OutputDir) titleFolderName(info MediaInfo) string {
+	name := sanitizeFileName(titleWithYear(info))
+	if tag := d.profileIdTag(info); tag != "" {
+		name += " " + tag
+	}
+	return name
+}
+
+// usesSourceNames tells whether output items are named after the source items (Kodi without naming templates)
+func (d OutputDir) usesSourceNames(isTvShow bool) bool {
+	if isTvShow {
+		return d.profile() == KodiProfile && d.Naming.Episode == ""
+	}
+	return d.profile() == KodiProfile && d.Naming.Movie == ""
+}
+
+// `S01E02 ` prepended to source names of Kodi episodes
+var episodeLinkPrefixRegex = regexp.MustCompile(`^S\d{2,}E\d{2,} `)
+
+// isSourceNamedLink checks a link of an output directory using source names is named after its target;
+// names are compared in NFC since file systems like HFS+ keep them decomposed
+func (d OutputDir) isSourceNamedLink(link Path, target Path, isTvShow bool) bool {
+	if !d.usesSourceNames(isTvShow) {
+		return true
+	}
+	linkName := norm.NFC.String(link.lastPathComponent())
+	targetName := norm.NFC.String(target.lastPathComponent())
+	if linkName == targetName {
+		return true
+	}
+	if isTvShow {
+		return episodeLinkPrefixRegex.MatchString(linkName) && linkName[len(episodeLinkPrefixRegex.FindString(linkName)):] == targetName
+	}
+	// parts of multipart movies are renamed inside their folders
+	return link.removingLastPathComponent() != d.Path
+}
+
+// needsExternalIds tells whether IMDb/TVDB ids are used in output names
+func (d OutputDir) needsExternalIds() bool {
+	templates := d.Naming.Movie + d.Naming.Episode
+	return d.profile() == PlexProfile || strings.Contains(templates, "{imdb") || strings.Contains(templates, "{tvdb")
+}
+
+// writesNfo tells whether NFO files are written; Plex relies on names only
+func (d OutputDir) writesNfo() bool {
+	return d.profile() != PlexProfile
+}
+
+// movieLocation returns the directory to put a movie files into, video file name without extension
+// and the top-level output item representing the movie
+func (d OutputDir) movieLocation(mediaInfo MediaFilesInfo) (Path, string, Path) {
+	if d.Naming.Movie != "" {
+		return d.templatedMovieLocation(mediaInfo)
+	}
+
+	edition := mediaInfo.release().Edition
+	switch d.profile() {
+	case JellyfinProfile, EmbyProfile:
+		// versions share the folder, `Title (Year) - Edition.mkv`
+		dir := d.Path.appendingPathComponent(d.titleFolderName(mediaInfo.Info))
+		fileName := titleWithYear(mediaInfo.Info)
+		if edition != "" {
+			fileName += " - " + edition
+		}
+		return dir, sanitizeFileName(fileName), dir
+
+	case PlexProfile:
+		// editions get own folders, `Title (Year) {imdb-tt123} {edition-Director's Cut}/Title (Year) {edition-Director's Cut}.mkv`
+		folderName := d.titleFolderName(mediaInfo.Info)
+		fileName := sanitizeFileName(titleWithYear(mediaInfo.Info))
+		if edition != "" {
+			tag := "{edition-" + sanitizeFileName(edition) + "}"
+			folderName += " " + tag
+			fileName += " " + tag
+		}
+		dir := d.Path.appendingPathComponent(folderName)
+		return dir, fileName, dir
+
+	default:
+		// source names differ between versions
+		fileName := movieFileNameWithoutExtension(mediaInfo.VideoFiles)
+		dir := d.Path
+		// make folder for multipart movie and disc folders
+		if !mediaInfo.Path.isVideoFile() || mediaInfo.Path.isDirectory() {
+			dir = d.Path.appendingPathComponent(mediaInfo.Path.lastPathComponent())
+		}
+		return dir, fileName, d.Path.appendingPathComponent(mediaInfo.Path.lastPathComponent())
+	}
+}
+
+func (d OutputDir) templatedMovieLocation(mediaInfo MediaFilesInfo) (Path, string, Path) {
+	edition := mediaInfo.release().Edition
+	segments := renderNamingTemplate(d.Naming.Movie, d.movieNamingValues(mediaInfo.Info, edition))
+	if len(segments) == 0 {
+		segments = []string{sanitizeFileName(titleWithYear(mediaInfo.Info))}
+	}
+	if edition != "" && !strings.Contains(d.Naming.Movie, "{edition}") {
+		// keep versions of the movie apart
+		segments[len(segments)-1] = sanitizeFileName(segments[len(segments)-1] + " - " + edition)
+	}
+	fileName := segments[len(segments)-1]
+
+	if len(segments) == 1 {
+		// make folder for multipart movie and disc folders
+		if len(mediaInfo.VideoFiles) > 1 || mediaInfo.VideoFiles[0].isDirectory() {
+			dir := d.Path.appendingPathComponent(fileName)
+			return dir, fileName, dir
+		}
+		return d.Path, fileName, d.Path.appendingPathComponent(fileName).appendingPathExtension(mediaInfo.VideoFiles[0].extension())
+	}
+
+	// the movie folder is the output item; upper folders (e.g. `{year}`) may be shared with other movies
+	dir := d.Path
+	for _, segment := range segments[:len(segments)-1] {
+		dir = dir.appendingPathComponent(segment)
+	}
+	return dir, fileName, dir
+}
+
+// versionFileName keeps versions of a movie sharing its folder apart, e.g. 1080p and 2160p releases without an edition:
+// when the name is taken by another source the resolution or the source of the release is appended, `Title (Year) - 2160p`
+func (d OutputDir) versionFileName(mediaInfo MediaFilesInfo, outputDir Path, fileName string, index *OutputIndex) string {
+	if len(mediaInfo.VideoFiles) != 1 || mediaInfo.VideoFiles[0].isDirectory() {
+		return fileName
+	}
+	source := mediaInfo.VideoFiles[0]
+	release := mediaInfo.release()
+	candidates := []string{fileName}
+	for _, suffix := range []string{release.Resolution, release.Source} {
+		if suffix != "" {
+			candidates = append(candidates, sanitizeFileName(fileName+" - "+suffix))
+		}
+	}
+
+	contents, _ := outputDir.getDirectoryContents()
+	// the name already given to the source is kept, otherwise the first free one is taken
+	free := ""
+	for _, candidate := range candidates {
+		taken := false
+		for _, path := range contents {
+			if !path.isVideoFile() || !strings.EqualFold(path.removingPathExtension().lastPathComponent(), candidate) {
+				continue
+			}
+			if d.linksSource(path, source, index) {
+				return candidate
+			}
+			taken = true
+		}
+		if !taken && free == "" {
+			free = candidate
+		}
+	}
+	if free == "" {
+		Log("⚠️ no free name for another version of", fileName, "in", outputDir, "for", source)
+		return fileName
+	}
+	return free
+}
+
+// linksSource tells whether the output file was linked (or copied) from the source file
+func (d OutputDir) linksSource(file Path, source Path, index *OutputIndex) bool {
+	if target, err := d.readLinkTarget(file); err == nil {
+		return strings.EqualFold(filepath.Clean(string(target)), filepath.Clean(string(source)))
+	}
+	if recorded, ok := index.sourceOfLinkedFile(file); ok {
+		return recorded == source
+	}
+	fileId, okFile := fileIdentity(file)
+	sourceId, okSource := fileIdentity(source)
+	return okFile && okSource && fileId.withoutLinks() == sourceId.withoutLinks()
+}
+
+// movieItemDepth returns the folder depth of movie output items, e.g. 2 for the `{year}/{title}/{title}` template;
+// upper folders are shared by movies and aren't output items themselves
+func (d OutputDir) movieItemDepth() int {
+	return max(1, strings.Count(d.Naming.Movie, "/"))
+}
+
+// outputItemOfFile returns the output item containing the file, relPath is relative to the output directory
+func (d OutputDir) outputItemOfFile(relPath string, isTvShow bool) Path {
+	components := strings.Split(relPath, string(filepath.Separator))
+	depth := 1
+	if !isTvShow {
+		// empty template segments are dropped, so the movie folder may be closer
+		depth = max(1, min(d.movieItemDepth(), len(components)-1))
+		for depth > 1 && isMovieSubfolder(components[depth-1]) {
+			depth--
+		}
+	}
+	item := d.Path
+	for _, component := range components[:depth] {
+		item = item.appendingPathComponent(component)
+	}
+	return item
+}
+
+// isMovieSubfolder tells extras and disc structure folders inside a movie folder
+func isMovieSubfolder(name string) bool {
+	name = strings.ToLower(name)
+	for _, folder := range extrasFolderNames {
+		if name == folder {
+			return true
+		}
+	}
+	for _, folder := range discStructureFolders {
+		if strings.EqualFold(name, folder) {
+			return true
+		}
+	}
+	return false
+}
+
+func (d OutputDir) movieArtworkFileName(artworkType ArtworkType, movieFileName string, hasOwnFolder bool) string {
+	if d.Naming.Movie != "" {
+		if hasOwnFolder {
+			return jellyfinArtworkFileName(artworkType)
+		}
+		return movieFileName + artworkType.movieFileSuffix()
+	}
+
+	switch d.profile() {
+	case JellyfinProfile, EmbyProfile, PlexProfile:
+		// every movie has its own folder
+		return jellyfinArtworkFileName(artworkType)
+	default:
+		return movieFileName + artworkType.movieFileSuffix()
+	}
+}
+
+func (d OutputDir) tvShowDir(mediaInfo MediaFilesInfo) Path {
+	if strings.Contains(d.Naming.Episode, "/") {
+		segments := renderNamingTemplate(d.Naming.Episode, d.episodeNamingValues(mediaInfo.Info, 0, 0, ""))
+		if len(segments) > 1 {
+			return d.Path.appendingPathComponent(segments[0])
+		}
+	}
+
+	switch d.profile() {
+	case JellyfinProfile, EmbyProfile:
+		return d.Path.appendingPathComponent(sanitizeFileName(titleWithYear(mediaInfo.Info)))
+	case PlexProfile:
+		return d.Path.appendingPathComponent(d.titleFolderName(mediaInfo.Info))
+	default:
+		return d.Path.appendingPathComponent(mediaInfo.Path.lastPathComponent())
+	}
+}
+
+func (d OutputDir) tvShowArtworkFileName(artworkType ArtworkType) string {
+	switch d.profile() {
+	case JellyfinProfile, EmbyProfile, PlexProfile:
+		return jellyfinArtworkFileName(artworkType)
+	default:
+		return artworkType.tvShowFileName()
+	}
+}
+
+// episodeLocation returns the directory and the file name without extension for an episode video file
+func (d OutputDir) episodeLocation(showDir Path, show MediaInfo, season int, episode int, episodeTitle string, videoFile Path) (Path, string) {
+	seasonEpisode := fmt.Sprintf("S%02dE%02d", season, episode)
+	seasonDir := showDir.appendingPathComponent(fmt.Sprintf("Season %02d", season))
+
+	if d.Naming.Episode != "" {
+		segments := renderNamingTemplate(d.Naming.Episode, d.episodeNamingValues(show, season, episode, episodeTitle))
+		if strings.Contains(d.Naming.Episode, "/") && len(segments) > 1 {
+			// the first segment is the show folder
+			segments = segments[1:]
+		}
+		if len(segments) > 0 {
+			dir := showDir
+			for _, segment := range segments[:len(segments)-1] {
+				dir = dir.appendingPathComponent(segment)
+			}
+			return dir, segments[len(segments)-1]
+		}
+	}
+
+	switch d.profile() {
+	case JellyfinProfile, EmbyProfile:
+		return seasonDir, sanitizeFileName(Coalesce(show.Title, show.OriginalTitle) + " " + seasonEpisode)
+
+	case PlexProfile:
+		name := Coalesce(show.Title, show.OriginalTitle) + " - " + strings.ToLower(seasonEpisode)
+		if episodeTitle != "" {
+			name += " - " + episodeTitle
+		}
+		return seasonDir, sanitizeFileName(name)
+
+	default:
+		targetFileName := videoFile.removingPathExtension().lastPathComponent()
+		if !strings.Contains(strings.ToUpper(targetFileName), seasonEpisode) {
+			// prepend S01E02 if not already present in the file name
+			targetFileName = seasonEpisode + " " + targetFileName
+		}
+		return showDir, targetFileName
+	}
+}
+
+// Jellyfin/Emby/Plex folders of extras
+var extrasFolderNames = map[VideoKind]string{
+	TrailerVideo:         "trailers",
+	FeaturetteVideo:      "featurettes",
+	BehindTheScenesVideo: "behind the scenes",
+	DeletedSceneVideo:    "deleted scenes",
+	InterviewVideo:       "interviews",
+	ExtraVideo:           "extras",
+}
+
+// extraLocation returns the directory and the file name without extension for an extra of a movie or TV Show;
+// extras are skipped for movies without own folders but trailers
+func (d OutputDir) extraLocation(extra ExtraFile, dir Path, movieFileName string, hasOwnFolder bool) (Path, string, bool) {
+	name := extra.Path.removingPathExtension().lastPathComponent()
+	if d.profile() == KodiProfile && d.Naming.Movie == "" {
+		// `Movie-trailer.mkv` next to the movie, others in `Extras/`
+		if extra.Kind == TrailerVideo && movieFileName != "" {
+			return dir, movieFileName + "-trailer", true
+		}
+		return dir.appendingPathComponent("Extras"), name, hasOwnFolder
+	}
+	if !hasOwnFolder {
+		if extra.Kind == TrailerVideo && movieFileName != "" {
+			return dir, movieFileName + "-trailer", true
+		}
+		return "", "", false
+	}
+	return dir.appendingPathComponent(extrasFolderNames[extra.Kind]), name, true
+}
+
+// Jellyfin/Emby/Plex local image names
+func jellyfinArtworkFileName(artworkType ArtworkType) string {
+	switch artworkType {
+	case ArtworkClearLogo:
+		return "logo.png"
+	case ArtworkDiscArt:
+		return "disc.png"
+	default:
+		return artworkType.tvShowFileName()
+	}
+}
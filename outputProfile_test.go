@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+func TestOutputDirUnmarshal(t *testing.T) {
+	var output OutputConfig
+	err := json.Unmarshal([]byte(`{
+		"movies": ["/media/kodi/movies", {"path": "/media/jellyfin/movies", "profile": "jellyfin"}],
+		"series": [{"path": "/media/emby/series", "profile": "emby"}]
+	}`), &output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(output.Movies) != 2 || output.Movies[0].Path != "/media/kodi/movies" || output.Movies[0].profile() != KodiProfile {
+		t.Errorf("unexpected movies output %+v", output.Movies)
+	}
+	if output.Movies[1].Path != "/media/jellyfin/movies" || output.Movies[1].profile() != JellyfinProfile {
+		t.Errorf("unexpected movies output %+v", output.Movies[1])
+	}
+	if len(output.Series) != 1 || output.Series[0].profile() != EmbyProfile {
+		t.Errorf("unexpected series output %+v", output.Series)
+	}
+
+	if err := json.Unmarshal([]byte(`{"movies": [{"path": "/media", "profile": "winamp"}]}`), &output); err == nil {
+		t.Errorf("expected an error for unknown profile")
+	}
+}
+
+func TestJellyfinOutputLayout(t *testing.T) {
+	output := OutputDir{Path: "/out/movies", Profile: JellyfinProfile}
+	mediaInfo := MediaFilesInfo{
+		Path:       "/media/Goodfellas.1990.720p.BluRay.mkv",
+		VideoFiles: []Path{"/media/Goodfellas.1990.720p.BluRay.mkv"},
+		Info: MediaInfo{
+			Id:    MediaId{id: "769", idType: TMDB},
+			Title: "Славные парни: история",
+			Year:  "1990",
+		},
+	}
+
+	dir, fileName, item := output.movieLocation(mediaInfo)
+	if dir != "/out/movies/Славные парни - история (1990) [tmdbid-769]" || item != dir {
+		t.Errorf("unexpected movie dir %s, item %s", dir, item)
+	}
+	if fileName != "Славные парни - история (1990)" {
+		t.Errorf("unexpected movie file name %s", fileName)
+	}
+	if name := output.movieArtworkFileName(ArtworkClearLogo, fileName, true); name != "logo.png" {
+		t.Errorf("unexpected logo name %s", name)
+	}
+
+	emby := OutputDir{Path: "/out/movies", Profile: EmbyProfile}
+	if dir, _, _ := emby.movieLocation(mediaInfo); dir != "/out/movies/Славные парни - история (1990) [tmdbid=769]" {
+		t.Errorf("unexpected emby movie dir %s", dir)
+	}
+
+	series := OutputDir{Path: "/out/series", Profile: JellyfinProfile}
+	show := MediaInfo{Id: MediaId{id: "1399", idType: TMDB}, Title: "Game of Thrones", Year: "2011", IsTvShow: true}
+	showDir := series.tvShowDir(MediaFilesInfo{Info: show})
+	if showDir != "/out/series/Game of Thrones (2011)" {
+		t.Errorf("unexpected show dir %s", showDir)
+	}
+	episodeDir, episodeName := series.episodeLocation(showDir, show, 1, 2, "", "/media/GoT/got.s01e02.mkv")
+	if episodeDir != "/out/series/Game of Thrones (2011)/Season 01" || episodeName != "Game of Thrones S01E02" {
+		t.Errorf("unexpected episode location %s/%s", episodeDir, episodeName)
+	}
+}
+
+func TestKodiOutputLayout(t *testing.T) {
+	output := OutputDir{Path: "/out/series"}
+	episodeDir, episodeName := output.episodeLocation("/out/series/GoT", MediaInfo{}, 1, 2, "", "/media/GoT/Episode 2.mkv")
+	if episodeDir != "/out/series/GoT" || episodeName != "S01E02 Episode 2" {
+		t.Errorf("unexpected episode location %s/%s", episodeDir, episodeName)
+	}
+	episodeDir, episodeName = output.episodeLocation("/out/series/GoT", MediaInfo{}, 1, 2, "", "/media/GoT/got.s01e02.mkv")
+	if episodeName != "got.s01e02" {
+		t.Errorf("unexpected episode name %s", episodeName)
+	}
+}
+
+func TestPlexOutputLayout(t *testing.T) {
+	movies := OutputDir{Path: "/out/Movies", Profile: PlexProfile}
+	mediaInfo := MediaFilesInfo{
+		Path:       "/media/Shawshank.1994.1080p.mkv",
+		VideoFiles: []Path{"/media/Shawshank.1994.1080p.mkv"},
+		Info: MediaInfo{
+			Id:     MediaId{id: "278", idType: TMDB},
+			ImdbId: "tt0111161",
+			Title:  "The Shawshank Redemption",
+			Year:   "1994",
+		},
+	}
+	dir, fileName, _ := movies.movieLocation(mediaInfo)
+	if dir != "/out/Movies/The Shawshank Redemption (1994) {imdb-tt0111161}" || fileName != "The Shawshank Redemption (1994)" {
+		t.Errorf("unexpected movie location %s/%s", dir, fileName)
+	}
+	if movies.writesNfo() {
+		t.Errorf("plex output should not have NFOs")
+	}
+
+	series := OutputDir{Path: "/out/TV Shows", Profile: PlexProfile}
+	show := MediaInfo{Id: MediaId{id: "1399", idType: TMDB}, TvdbId: "121361", Title: "Game of Thrones", Year: "2011", IsTvShow: true}
+	showDir := series.tvShowDir(MediaFilesInfo{Info: show})
+	if showDir != "/out/TV Shows/Game of Thrones (2011) {tvdb-121361}" {
+		t.Errorf("unexpected show dir %s", showDir)
+	}
+	episodeDir, episodeName := series.episodeLocation(showDir, show, 1, 2, "The Kingsroad", "/media/GoT/got.s01e02.mkv")
+	if episodeDir != showDir+"/Season 01" || episodeName != "Game of Thrones - s01e02 - The Kingsroad" {
+		t.Errorf("unexpected episode location %s/%s", episodeDir, episodeName)
+	}
+
+	show.TvdbId = ""
+	if showDir := series.tvShowDir(MediaFilesInfo{Info: show}); showDir != "/out/TV Shows/Game of Thrones (2011) {tmdb-1399}" {
+		t.Errorf("unexpected show dir without tvdb id %s", showDir)
+	}
+}
+
+func TestMovieEditionLayout(t *testing.T) {
+	info := MediaInfo{Id: MediaId{id: "78", idType: TMDB}, ImdbId: "tt0083658", Title: "Blade Runner", Year: "1982"}
+	theatrical := MediaFilesInfo{Path: "/media/Blade.Runner.1982.1080p.mkv", VideoFiles: []Path{"/media/Blade.Runner.1982.1080p.mkv"}, Info: info}
+	directorsCut := MediaFilesInfo{Path: "/media/Blade.Runner.1982.Directors.Cut.mkv", VideoFiles: []Path{"/media/Blade.Runner.1982.Directors.Cut.mkv"}, Info: info}
+
+	jellyfin := OutputDir{Path: "/out/movies", Profile: JellyfinProfile}
+	dir1, fileName1, _ := jellyfin.movieLocation(theatrical)
+	dir2, fileName2, _ := jellyfin.movieLocation(directorsCut)
+	if dir1 != dir2 || fileName1 != "Blade Runner (1982)" || fileName2 != "Blade Runner (1982) - Director's Cut" {
+		t.Errorf("unexpected jellyfin versions %s/%s, %s/%s", dir1, fileName1, dir2, fileName2)
+	}
+
+	plex := OutputDir{Path: "/out/movies", Profile: PlexProfile}
+	dir, fileName, _ := plex.movieLocation(directorsCut)
+	if dir != "/out/movies/Blade Runner (1982) {imdb-tt0083658} {edition-Director's Cut}" || fileName != "Blade Runner (1982) {edition-Director's Cut}" {
+		t.Errorf("unexpected plex edition location %s/%s", dir, fileName)
+	}
+
+	templated := OutputDir{Path: "/out/movies", Naming: NamingConfig{Movie: "{title} ({year})"}}
+	if _, fileName, _ := templated.movieLocation(directorsCut); fileName != "Blade Runner (1982) - Director's Cut" {
+		t.Errorf("unexpected templated edition file name %s", fileName)
+	}
+	templated.Naming.Movie = "{title} ({year}) [{edition}]"
+	if _, fileName, _ := templated.movieLocation(theatrical); fileName != "Blade Runner (1982)" {
+		t.Errorf("unexpected templated file name without edition %s", fileName)
+	}
+}
+
+func TestMovieVersionsWithoutEdition(t *testing.T) {
+	dir := Path(t.TempDir())
+	info := MediaInfo{Id: MediaId{id: "78", idType: TMDB}, Title: "Blade Runner", Year: "1982"}
+	var versions []MediaFilesInfo
+	for _, name := range []string{"Blade.Runner.1982.1080p.BluRay.mkv", "Blade.Runner.1982.2160p.BluRay.mkv"} {
+		source := dir.appendingPathComponent("media").appendingPathComponent(name)
+		if err := os.MkdirAll(string(source.removingLastPathComponent()), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(string(source), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		versions = append(versions, MediaFilesInfo{Path: source, VideoFiles: []Path{source}, Info: info})
+	}
+
+	jellyfin := OutputDir{Path: dir.appendingPathComponent("jellyfin"), Profile: JellyfinProfile}
+	var fileNames []string
+	for _, version := range versions {
+		outputDir, fileName, _ := jellyfin.movieLocation(version)
+		if err := os.MkdirAll(string(outputDir), 0755); err != nil {
+			t.Fatal(err)
+		}
+		fileName = jellyfin.versionFileName(version, outputDir, fileName, nil)
+		if err := jellyfin.linkFile(version.VideoFiles[0], outputDir.appendingPathComponent(fileName+".mkv")); err != nil {
+			t.Fatal(err)
+		}
+		fileNames = append(fileNames, fileName)
+	}
+	if fileNames[0] != "Blade Runner (1982)" || fileNames[1] != "Blade Runner (1982) - 2160p" {
+		t.Errorf("unexpected version names %v", fileNames)
+	}
+	// the next run keeps the names
+	for idx, version := range versions {
+		outputDir, fileName, _ := jellyfin.movieLocation(version)
+		if fileName = jellyfin.versionFileName(version, outputDir, fileName, nil); fileName != fileNames[idx] {
+			t.Errorf("version %d renamed to %s", idx, fileName)
+		}
+	}
+}
+
+func TestSourceNamedLinks(t *testing.T) {
+	kodi := OutputDir{Path: "/out/kodi"}
+	// decomposed `й` of a name written on macOS
+	decomposed := Path("/out/kodi/Пи\u0306ратЫ.mkv")
+	if !kodi.isSourceNamedLink(decomposed, "/media/ПйратЫ.mkv", false) {
+		t.Errorf("names differing in normalization only must match")
+	}
+	if kodi.isSourceNamedLink("/out/kodi/Other.mkv", "/media/Movie.mkv", false) {
+		t.Errorf("link named unlike its source must not match")
+	}
+	if !kodi.isSourceNamedLink("/out/kodi/Movie/Movie.part1.mkv", "/media/Movie/Movie CD1.mkv", false) {
+		t.Errorf("parts of multipart movies are renamed")
+	}
+	if !kodi.isSourceNamedLink("/out/series/Show/S01E02 show.2.mkv", "/media/Show/show.2.mkv", true) {
+		t.Errorf("episode prefix must be allowed")
+	}
+	if kodi.isSourceNamedLink("/out/series/Show/S01E02 other.mkv", "/media/Show/show.2.mkv", true) {
+		t.Errorf("episode named unlike its source must not match")
+	}
+	jellyfin := OutputDir{Path: "/out/jellyfin", Profile: JellyfinProfile}
+	if !jellyfin.isSourceNamedLink("/out/jellyfin/Movie (2020)/Movie (2020).mkv", "/media/Movie.2020.mkv", false) {
+		t.Errorf("renaming profiles don't keep source names")
+	}
+}
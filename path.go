@@ -82,7 +82,7 @@ func (p Path) appendingPathExtension(ext string) Path {
 	return Path(string(p) + "." + ext)
 }
 
-var videoExtensions []string = []string{"mov", "m4v", "mkv", "avi", "mp4", "mpg", "wmv", "flv", "webm", "ts", "m2ts", "mxf", "ogv", "3gp", "3g2"}
+var videoExtensions []string = []string{"mov", "m4v", "mkv", "avi", "mp4", "mpg", "wmv", "flv", "webm", "ts", "m2ts", "mxf", "ogv", "3gp", "3g2", "iso"}
 
 func (p Path) isVideoFile() bool {
 	if strings.HasPrefix(p.lastPathComponent(), ".") {
@@ -90,7 +90,7 @@ func (p Path) isVideoFile() bool {
 	}
 
 	if p.isDirectory() {
-		return p.appendingPathComponent("VIDEO_TS").isDirectory()
+		return p.isDiscFolder()
 	}
 	ext := p.extension()
 	for _, videoExt := range videoExtensions {
@@ -103,31 +103,63 @@ func (p Path) isVideoFile() bool {
 }
 
 func (p Path) findRelatedVideoSymlink() Path {
+	if path := p.findRelatedVideoFile(); path.isSymlink() {
+		return path
+	}
+	return ""
+}
+
+// findRelatedVideoFile returns the linked file of an output item: the item itself,
+// the first video in a folder, or the video an NFO/artwork file belongs to
+func (p Path) findRelatedVideoFile() Path {
 	if p.isSymlink() {
 		return p
 	} else if p.isDirectory() {
 		videoFiles := getVideoFiles(p)
+		if len(videoFiles) > 0 && videoFiles[0].isDirectory() {
+			// symlinked `BDMV/` or `VIDEO_TS/` of a disc folder
+			for _, folder := range discStructureFolders {
+				if link := videoFiles[0].appendingPathComponent(folder); link.isSymlink() {
+					return link
+				}
+			}
+		}
 		if len(videoFiles) > 0 {
 			return videoFiles[0]
 		}
 		return ""
+	} else if p.isVideoFile() {
+		return p
 	}
 	fileName := p.lastPathComponent()
 
-	fileName = strings.TrimSuffix(fileName, "-poster.jpg")
-	fileName = strings.TrimSuffix(fileName, "-fanart.jpg")
+	for _, artworkType := range allArtworkTypes {
+		fileName = strings.TrimSuffix(fileName, artworkType.movieFileSuffix())
+	}
 	fileName = strings.TrimSuffix(fileName, ".nfo")
 
 	base := p.removingLastPathComponent()
 	for _, ext := range videoExtensions {
 		path := base.appendingPathComponent(fileName + "." + ext)
-		if path.isSymlink() {
+		if path.exists() {
 			return path
 		}
 	}
 	return ""
 }
 
+// readSymlink returns the symlink target, relative targets are resolved against the symlink folder
+func (p Path) readSymlink() (Path, error) {
+	target, err := os.Readlink(string(p))
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(target) {
+		return p.removingLastPathComponent().appendingPathComponent(target), nil
+	}
+	return Path(target), nil
+}
+
 func (p Path) isSymlink() bool {
 	if info, err := os.Lstat(string(p)); err == nil && info.Mode()&os.ModeSymlink != 0 {
 		return true
@@ -135,17 +167,28 @@ func (p Path) isSymlink() bool {
 	return false
 }
 
-// Function to find all video files in a directory recursively
+// Function to find all video files in a directory recursively, disc folders are single videos
 func (p Path) findVideoFilesInFolder() []Path {
-	paths, err := p.getDirectoryContentsRecursively()
-	if err != nil {
-		return nil
-	}
 	var filteredPaths []Path
-	for _, path := range paths {
+	err := filepath.Walk(string(p), func(s string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		path := Path(s)
+		if info.IsDir() {
+			if path.isDiscFolder() {
+				filteredPaths = append(filteredPaths, path)
+				return filepath.SkipDir
+			}
+			return nil
+		}
 		if path.isVideoFile() {
 			filteredPaths = append(filteredPaths, path)
 		}
+		return nil
+	})
+	if err != nil {
+		return nil
 	}
 	return filteredPaths
 }
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+)
+
+// PathRewrite replaces the host path prefix with the one the media player sees,
+// e.g. `/mnt/media` → `/media` for a containerized Kodi/Jellyfin or `D:\Media` → `/media` for a NAS player
+type PathRewrite struct {
+	From Path `json:"from"`
+	To   Path `json:"to"`
+}
+
+// rewritePathPrefix replaces the prefix on a path component boundary, separators follow the new prefix style
+func rewritePathPrefix(path Path, from Path, to Path) (Path, bool) {
+	fromStr := strings.TrimRight(string(from), `/\`)
+	if fromStr == "" || len(path) < len(fromStr) || !strings.EqualFold(string(path[:len(fromStr)]), fromStr) {
+		return path, false
+	}
+	rest := string(path[len(fromStr):])
+	if rest != "" && rest[0] != '/' && rest[0] != '\\' {
+		return path, false
+	}
+	toStr := strings.TrimRight(string(to), `/\`)
+	if strings.Contains(toStr, `\`) && !strings.Contains(toStr, "/") {
+		rest = strings.ReplaceAll(rest, "/", `\`)
+	} else if strings.Contains(toStr, "/") {
+		rest = strings.ReplaceAll(rest, `\`, "/")
+	}
+	return Path(toStr + rest), true
+}
+
+// playerPath returns the path as seen by the media player of the output directory
+func (d OutputDir) playerPath(hostPath Path) Path {
+	for _, rule := range d.PathRewrites {
+		if path, ok := rewritePathPrefix(hostPath, rule.From, rule.To); ok {
+			return path
+		}
+	}
+	return hostPath
+}
+
+// hostPath reverts playerPath
+func (d OutputDir) hostPath(playerPath Path) Path {
+	for _, rule := range d.PathRewrites {
+		if path, ok := rewritePathPrefix(playerPath, rule.To, rule.From); ok {
+			return path
+		}
+	}
+	return playerPath
+}
+
+// readLinkTarget returns the host path of a symlink target written for the media player
+func (d OutputDir) readLinkTarget(symlink Path) (Path, error) {
+	target, err := symlink.readSymlink()
+	if err != nil {
+		return "", err
+	}
+	return d.hostPath(target), nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestRewritePathPrefix(t *testing.T) {
+	tests := []struct {
+		path, from, to, expected string
+		ok                       bool
+	}{
+		{"/mnt/media/Movies/Movie.mkv", "/mnt/media", "/media", "/media/Movies/Movie.mkv", true},
+		{"/mnt/media/Movies/Movie.mkv", "/mnt/media/", "/media/", "/media/Movies/Movie.mkv", true},
+		{"/mnt/mediastore/Movie.mkv", "/mnt/media", "/media", "/mnt/mediastore/Movie.mkv", false},
+		{`D:\Media\Movies\Movie.mkv`, `d:\media`, "/media", "/media/Movies/Movie.mkv", true},
+		{"/media/Movies/Movie.mkv", "/media", `D:\Media`, `D:\Media\Movies\Movie.mkv`, true},
+	}
+	for _, test := range tests {
+		path, ok := rewritePathPrefix(Path(test.path), Path(test.from), Path(test.to))
+		if string(path) != test.expected || ok != test.ok {
+			t.Errorf("%s with %s → %s: expected %s, got %s", test.path, test.from, test.to, test.expected, path)
+		}
+	}
+}
+
+func TestRewrittenSymlinkTargets(t *testing.T) {
+	dir := Path(t.TempDir())
+	mediaDir := dir.appendingPathComponent("media")
+	source := mediaDir.appendingPathComponent("Movie.2020.mkv")
+	output := OutputDir{
+		Path:         dir.appendingPathComponent("kodi"),
+		PathRewrites: []PathRewrite{{From: mediaDir, To: "/media"}},
+	}
+	for _, path := range []Path{mediaDir, output.Path} {
+		if err := os.MkdirAll(string(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(string(source), []byte("video"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	link := output.Path.appendingPathComponent("Movie.2020.mkv")
+	if err := output.linkFile(source, link); err != nil {
+		t.Fatal(err)
+	}
+	if target, _ := os.Readlink(string(link)); target != "/media/Movie.2020.mkv" {
+		t.Errorf("expected the player path in the symlink, got %s", target)
+	}
+	if target, err := output.readLinkTarget(link); err != nil || target != source {
+		t.Errorf("expected the host path %s, got %s (%v)", source, target, err)
+	}
+
+	// cleanup understands rewritten targets
+	config := Config{Directories: []Path{mediaDir}, Output: OutputConfig{Movies: []OutputDir{output}}}
+	targetPath, sourceDir, err := config.sourceDirectoryForVideoSymlink(link)
+	if err != nil || targetPath != source || sourceDir != mediaDir {
+		t.Errorf("unexpected symlink source %s in %s (%v)", targetPath, sourceDir, err)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimit limits requests to an API host
+type RateLimit struct {
+	// sustained requests per second
+	PerSecond float64 `json:"per_second,omitempty"`
+	// requests allowed at once after idling, PerSecond by default
+	Burst int `json:"burst,omitempty"`
+	// requests per day, counted across runs
+	PerDay int `json:"per_day,omitempty"`
+}
+
+// limits of the public APIs, overridden by `rate_limits` in the config
+var defaultRateLimits = map[string]RateLimit{
+	"api.themoviedb.org":   {PerSecond: 40},
+	"api.kinopoisk.dev":    {PerDay: 200},
+	"api.openai.com":       {PerSecond: 5},
+	"webservice.fanart.tv": {PerSecond: 10},
+}
+
+// QuotaExceededError is returned when the daily quota of the host is used up
+type QuotaExceededError struct {
+	Host  string
+	Quota int
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("daily quota of %d requests to %s is exceeded", e.Quota, e.Host)
+}
+
+// tokenBucket spreads requests to a host over time
+type tokenBucket struct {
+	mutex  sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// wait reserves a token and sleeps until it's available
+func (b *tokenBucket) wait(ctx context.Context) error {
+	b.mutex.Lock()
+	now := time.Now()
+	if !b.last.IsZero() {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	b.last = now
+	b.tokens--
+	var delay time.Duration
+	if b.tokens < 0 {
+		delay = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	b.mutex.Unlock()
+
+	return sleepContext(ctx, delay)
+}
+
+// dailyQuota is the request count of a host for a day, stored in the cache dir
+type dailyQuota struct {
+	Day   string `json:"day"`
+	Count int    `json:"count"`
+}
+
+// RateLimiter applies rate limits and daily quotas per host, it's safe for concurrent use
+type RateLimiter struct {
+	mutex   sync.Mutex
+	limits  map[string]RateLimit
+	buckets map[string]*tokenBucket
+}
+
+var rateLimiter = newRateLimiter(nil)
+
+// newRateLimiter merges the configured limits over the default ones
+func newRateLimiter(limits map[string]RateLimit) *RateLimiter {
+	merged := make(map[string]RateLimit)
+	for host, limit := range defaultRateLimits {
+		merged[host] = limit
+	}
+	for host, limit := range limits {
+		merged[strings.ToLower(host)] = limit
+	}
+	return &RateLimiter{limits: merged, buckets: make(map[string]*tokenBucket)}
+}
+
+// configureRateLimits applies `rate_limits` from the config
+func configureRateLimits(limits map[string]RateLimit) {
+	rateLimiter = newRateLimiter(limits)
+}
+
+// waitForRateLimit blocks until a request to the URL is allowed by the limits of its host;
+// retries are spread like other requests but counted against the daily quota once with the request
+func waitForRateLimit(ctx context.Context, rawURL string, retry bool) error {
+	return rateLimiter.wait(ctx, rawURL, retry)
+}
+
+func (r *RateLimiter) wait(ctx context.Context, rawURL string, retry bool) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	host := strings.ToLower(parsed.Hostname())
+	limit, ok := r.limits[host]
+	if !ok {
+		return nil
+	}
+
+	if limit.PerDay > 0 && !retry {
+		if err := r.countDailyRequest(host, limit.PerDay); err != nil {
+			return err
+		}
+	}
+	if limit.PerSecond > 0 {
+		return r.bucket(host, limit).wait(ctx)
+	}
+	return nil
+}
+
+func (r *RateLimiter) bucket(host string, limit RateLimit) *tokenBucket {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	bucket, ok := r.buckets[host]
+	if !ok {
+		burst := float64(limit.Burst)
+		if burst <= 0 {
+			burst = limit.PerSecond
+		}
+		if burst < 1 {
+			burst = 1
+		}
+		bucket = &tokenBucket{rate: limit.PerSecond, burst: burst, tokens: burst}
+		r.buckets[host] = bucket
+	}
+	return bucket
+}
+
+// countDailyRequest counts the request against the daily quota of the host
+func (r *RateLimiter) countDailyRequest(host string, perDay int) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	quotaPath := filepath.Join(CacheDir, "quotas.json")
+	quotas := make(map[string]dailyQuota)
+	if data, err := os.ReadFile(quotaPath); err == nil {
+		if err := json.Unmarshal(data, &quotas); err != nil {
+			Log("⚠️ resetting broken quotas file", quotaPath, err)
+		}
+	}
+
+	today := time.Now().Format("2006-01-02")
+	quota := quotas[host]
+	if quota.Day != today {
+		quota = dailyQuota{Day: today}
+	}
+	if quota.Count >= perDay {
+		return &QuotaExceededError{Host: host, Quota: perDay}
+	}
+	quota.Count++
+	quotas[host] = quota
+
+	data, err := json.MarshalIndent(quotas, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(CacheDir, 0755); err != nil {
+		return err
+	}
+	return writeFileAtomically(Path(quotaPath), data)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterSpreadsRequests(t *testing.T) {
+	limiter := newRateLimiter(map[string]RateLimit{"api.example.com": {PerSecond: 20, Burst: 1}})
+	started := time.Now()
+	for i := 0; i < 5; i++ {
+		if err := limiter.wait(context.Background(), "https://api.example.com/movie/1", false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the first request is free, 4 more take 50ms each
+	if elapsed := time.Since(started); elapsed < 190*time.Millisecond {
+		t.Errorf("requests were not rate limited, took %v", elapsed)
+	}
+
+	started = time.Now()
+	if err := limiter.wait(context.Background(), "https://unlimited.example.com/", false); err != nil || time.Since(started) > 10*time.Millisecond {
+		t.Errorf("hosts without limits must not wait")
+	}
+}
+
+func TestRateLimiterDailyQuota(t *testing.T) {
+	originalCacheDir := CacheDir
+	defer func() { CacheDir = originalCacheDir }()
+	CacheDir = t.TempDir()
+
+	limiter := newRateLimiter(map[string]RateLimit{"api.kinopoisk.dev": {PerDay: 2}})
+	for i := 0; i < 2; i++ {
+		if err := limiter.wait(context.Background(), "https://api.kinopoisk.dev/v1.4/movie", false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the count is kept across runs
+	limiter = newRateLimiter(map[string]RateLimit{"api.kinopoisk.dev": {PerDay: 2}})
+	var quotaErr *QuotaExceededError
+	if err := limiter.wait(context.Background(), "https://api.kinopoisk.dev/v1.4/movie", false); !errors.As(err, &quotaErr) {
+		t.Errorf("expected quota error, got %v", err)
+	}
+}
+
+func TestRetriesCountOnceAgainstDailyQuota(t *testing.T) {
+	originalCacheDir, originalClient, originalLimiter := CacheDir, httpClient, rateLimiter
+	defer func() { CacheDir, httpClient, rateLimiter = originalCacheDir, originalClient, originalLimiter }()
+	CacheDir = t.TempDir()
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+	httpClient = newHTTPClient(HTTPConfig{})
+	httpClient.retryDelay = 0
+	httpClient.client.Transport = redirectTransport{server}
+	rateLimiter = newRateLimiter(map[string]RateLimit{"api.kinopoisk.dev": {PerDay: 2}})
+
+	// a request retried twice takes one request of the quota
+	for i := 0; i < 2; i++ {
+		atomic.StoreInt32(&requests, 0)
+		if _, err := httpClient.get(context.Background(), "https://api.kinopoisk.dev/v1.4/movie/1", nil); err != nil {
+			t.Fatalf("request %d failed: %v", i, err)
+		}
+		if requests != 3 {
+			t.Fatalf("expected 3 attempts, got %d", requests)
+		}
+	}
+	var quotaErr *QuotaExceededError
+	if _, err := httpClient.get(context.Background(), "https://api.kinopoisk.dev/v1.4/movie/1", nil); !errors.As(err, &quotaErr) {
+		t.Errorf("expected quota error after 2 requests, got %v", err)
+	}
+}
+
+func TestForEachConcurrentlyStopsOnError(t *testing.T) {
+	var processed int32
+	failure := errors.New("failed")
+	err := forEachConcurrently(context.Background(), 100, 4, func(i int) error {
+		atomic.AddInt32(&processed, 1)
+		if i == 2 {
+			return failure
+		}
+		time.Sleep(time.Millisecond)
+		return nil
+	})
+	if err != failure {
+		t.Errorf("expected the item error, got %v", err)
+	}
+	if processed == 100 {
+		t.Errorf("items should not be started after an error")
+	}
+}
@@ -0,0 +1,20 @@
+//go:build linux
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// FICLONE ioctl from linux/fs.h
+const ficlone = 0x40049409
+
+// cloneFile makes the destination share the source extents (btrfs, xfs)
+func cloneFile(destination *os.File, source *os.File) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, destination.Fd(), ficlone, source.Fd())
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+func cloneFile(destination *os.File, source *os.File) error {
+	return errors.New("reflink is not supported on this platform")
+}
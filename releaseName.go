@@ -0,0 +1,523 @@
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// ReleaseName is what a release name like `Movie.2010.Extended.1080p.BluRay.x264.DTS.Rus.Eng-GROUP` tells about the media
+type ReleaseName struct {
+	Title string
+	Year  string
+	// seasons and episodes, ranges like S01-S03 or E01-E05 are expanded
+	Seasons  []int
+	Episodes []int
+	// canonical tag values, e.g. `1080p`, `BluRay`, `h264`, `HDR10`
+	Resolution string
+	Source     string
+	Codec      string
+	HDR        string
+	// audio codecs like `DTS` or `AC3` and channel layouts like `5.1`
+	Audio    []string
+	Channels string
+	// ISO 639-2 codes like `rus`
+	Languages []string
+	// e.g. `Extended`, `Unrated Extended`, `Director's Cut`
+	Edition string
+	Group   string
+	// part number of movies split into several files
+	Part int
+	// other recognized tags, e.g. voice-over kinds
+	Other []string
+}
+
+type ReleaseTagKind string
+
+const (
+	ResolutionTag ReleaseTagKind = "resolution"
+	SourceTag     ReleaseTagKind = "source"
+	CodecTag      ReleaseTagKind = "codec"
+	HDRTag        ReleaseTagKind = "hdr"
+	AudioTag      ReleaseTagKind = "audio"
+	ChannelsTag   ReleaseTagKind = "channels"
+	LanguageTag   ReleaseTagKind = "language"
+	EditionTag    ReleaseTagKind = "edition"
+	OtherTag      ReleaseTagKind = "other"
+	// channel or studio names dropped from the start of the title, e.g. `BBC`
+	PrefixTag ReleaseTagKind = "prefix"
+)
+
+type ReleaseTag struct {
+	Kind  ReleaseTagKind
+	Value string
+}
+
+// canonical tag values and their lowercased spellings by kind, multi-word spellings are separated by spaces
+var defaultReleaseTags = map[ReleaseTagKind]map[string][]string{
+	ResolutionTag: {
+		"2160p": {"2160p", "4k", "uhd"},
+		"1080p": {"1080p", "1080i"},
+		"720p":  {"720p"},
+		"576p":  {"576p"},
+		"480p":  {"480p"},
+	},
+	SourceTag: {
+		"BluRay": {"bluray", "blu ray", "bdremux", "remux"},
+		"WEB-DL": {"web dl", "webdl", "web"},
+		"HDTV":   {"hdtv"},
+		"DVD":    {"dvd", "dvd5", "dvd9"},
+		"TS":     {"ts", "telesync"},
+	},
+	CodecTag: {
+		"h264":  {"x264", "h264", "h 264", "avc"},
+		"hevc":  {"x265", "h265", "h 265", "hevc"},
+		"xvid":  {"xvid"},
+		"divx":  {"divx"},
+		"av1":   {"av1"},
+		"mpeg2": {"mpeg2"},
+	},
+	HDRTag: {
+		"HDR10":        {"hdr", "hdr10"},
+		"HDR10+":       {"hdr10+", "hdr10plus"},
+		"Dolby Vision": {"dolby vision", "dovi"},
+		"SDR":          {"sdr"},
+	},
+	AudioTag: {
+		"AAC":       {"aac"},
+		"AC3":       {"ac3", "dd"},
+		"E-AC3":     {"eac3", "ddp", "dd+"},
+		"DTS":       {"dts"},
+		"DTS-HD MA": {"dts hd ma", "dts hd", "dtshd"},
+		"TrueHD":    {"truehd"},
+		"Atmos":     {"atmos"},
+		"FLAC":      {"flac"},
+		"MP3":       {"mp3"},
+	},
+	ChannelsTag: {
+		"7.1": {"7 1"},
+		"5.1": {"5 1"},
+		"2.0": {"2 0"},
+	},
+	LanguageTag: {
+		"rus": {"rus", "russian"},
+		"eng": {"eng", "english"},
+		"ukr": {"ukr", "ukrainian"},
+		"ger": {"ger", "german"},
+		"fre": {"fre", "french"},
+		"spa": {"spa", "spanish"},
+		"ita": {"ita", "italian"},
+		"jpn": {"jpn", "japanese"},
+	},
+	EditionTag: {
+		"Extended":        {"extended", "extended cut", "extended edition", "расширенная версия"},
+		"Unrated":         {"unrated"},
+		"Uncut":           {"uncut"},
+		"Director's Cut":  {"director's cut", "directors cut", "director s cut", "режиссерская версия", "режиссёрская версия"},
+		"Theatrical":      {"theatrical", "theatrical cut", "театральная версия"},
+		"Remastered":      {"remastered"},
+		"IMAX":            {"imax"},
+		"Special Edition": {"special edition"},
+		"Criterion":       {"criterion"},
+	},
+	OtherTag: {
+		"MVO":      {"mvo"},
+		"DVO":      {"dvo"},
+		"AVO":      {"avo"},
+		"Dub":      {"dub", "dubbed"},
+		"Matroska": {"matroska"},
+		"Proper":   {"proper"},
+		"Repack":   {"repack"},
+	},
+	PrefixTag: {
+		"BBC":                 {"bbc"},
+		"National Geographic": {"national geographic", "natgeo"},
+		"Сериал":              {"сериал"},
+	},
+}
+
+// releaseTags maps lowercased spellings to tags, built from the defaults and `release_tags` of the config
+var releaseTags = buildReleaseTags(nil)
+
+// spellings have up to this many words
+var releaseTagMaxWords = 3
+
+func buildReleaseTags(extra map[string]map[string][]string) map[string]ReleaseTag {
+	tags := make(map[string]ReleaseTag)
+	add := func(kind ReleaseTagKind, value string, spellings []string) {
+		for _, spelling := range spellings {
+			key := strings.Join(releaseTokenRE.FindAllString(strings.ToLower(spelling), -1), " ")
+			if key != "" {
+				tags[key] = ReleaseTag{Kind: kind, Value: value}
+			}
+		}
+	}
+	for kind, values := range defaultReleaseTags {
+		for value, spellings := range values {
+			add(kind, value, spellings)
+		}
+	}
+	for kind, values := range extra {
+		if _, ok := defaultReleaseTags[ReleaseTagKind(kind)]; !ok {
+			Log("⚠️ unknown release tag kind", kind)
+			continue
+		}
+		for value, spellings := range values {
+			// the value is a spelling too
+			add(ReleaseTagKind(kind), value, append([]string{value}, spellings...))
+		}
+	}
+	return tags
+}
+
+// configureReleaseTags merges tags by kind, canonical value and spellings over the defaults
+func configureReleaseTags(extra map[string]map[string][]string) {
+	releaseTags = buildReleaseTags(extra)
+	for key := range releaseTags {
+		releaseTagMaxWords = max(releaseTagMaxWords, len(strings.Fields(key)))
+	}
+}
+
+var (
+	releaseTokenRE         = regexp.MustCompile(`[\p{L}\p{N}']+\+?`)
+	releaseYearRE          = regexp.MustCompile(`^(?:19|20)\d\d$`)
+	releaseGluedYearRE     = regexp.MustCompile(`^(.*\D)((?:19|20)\d\d)$`)
+	releaseSeasonEpisodeRE = regexp.MustCompile(`^s(\d{1,2})((?:e\d{1,3})+)$`)
+	releaseSeasonRE        = regexp.MustCompile(`^s(\d{1,2})$`)
+	releaseEpisodeRE       = regexp.MustCompile(`^ep?(\d{1,3})$`)
+	releaseCrossEpisodeRE  = regexp.MustCompile(`^(\d{1,2})x(\d{1,3})$`)
+	releasePartRE          = regexp.MustCompile(`^(?:cd|disc|disk|part|pt)(\d{1,2})$`)
+	releaseRipRE           = regexp.MustCompile(`^[a-z]+rip$`)
+	releaseLanguageCountRE = regexp.MustCompile(`^\d{1,2}x(\p{L}+)$`)
+	releaseFullWordRE      = regexp.MustCompile(`^\p{L}{4,}$`)
+	releaseNumberRE        = regexp.MustCompile(`^\d{1,3}$`)
+	releaseAudioChannelsRE = regexp.MustCompile(`^(\p{L}+\+?)([2578])$`)
+	releaseGroupRE         = regexp.MustCompile(`[^\s\-]-([\p{L}\p{N}]{2,})$`)
+)
+
+type releaseToken struct {
+	text  string
+	lower string
+	// inside (), [] or {}
+	bracketed bool
+	// follows an opening bracket
+	opensBracket bool
+}
+
+func tokenizeReleaseName(name string) []releaseToken {
+	var tokens []releaseToken
+	depth := 0
+	opened := false
+	last := 0
+	for _, loc := range releaseTokenRE.FindAllStringIndex(name, -1) {
+		for _, r := range name[last:loc[0]] {
+			switch r {
+			case '(', '[', '{':
+				depth++
+				opened = true
+			case ')', ']', '}':
+				depth = max(depth-1, 0)
+			}
+		}
+		text := name[loc[0]:loc[1]]
+		tokens = append(tokens, releaseToken{text: text, lower: strings.ToLower(text), bracketed: depth > 0, opensBracket: opened})
+		opened = false
+		last = loc[1]
+	}
+	return tokens
+}
+
+// matchReleaseTag finds the longest tag spelling starting at the token, returns the tag and number of tokens
+func matchReleaseTag(tokens []releaseToken, idx int) (ReleaseTag, int) {
+	for n := min(releaseTagMaxWords, len(tokens)-idx); n > 0; n-- {
+		words := make([]string, n)
+		for i := range words {
+			words[i] = tokens[idx+i].lower
+		}
+		if tag, ok := releaseTags[strings.Join(words, " ")]; ok {
+			return tag, n
+		}
+	}
+	if releaseRipRE.MatchString(tokens[idx].lower) {
+		return ReleaseTag{Kind: SourceTag, Value: tokens[idx].text}, 1
+	}
+	if match := releaseLanguageCountRE.FindStringSubmatch(tokens[idx].lower); match != nil {
+		if tag, ok := releaseTags[match[1]]; ok && tag.Kind == LanguageTag {
+			return tag, 1
+		}
+	}
+	return ReleaseTag{}, 0
+}
+
+// mayBeTitleWord tells if a token is a tag spelled as an ordinary word, a full language name or `Web`
+func mayBeTitleWord(tokens []releaseToken, idx int) bool {
+	tag, n := matchReleaseTag(tokens, idx)
+	if n != 1 {
+		return false
+	}
+	switch tag.Kind {
+	case LanguageTag:
+		return releaseFullWordRE.MatchString(tokens[idx].lower)
+	case SourceTag:
+		return tokens[idx].lower == "web"
+	}
+	return false
+}
+
+// parseReleaseName extracts the title, year, episodes and release tags from a file or folder name,
+// the title ends at the first year, episode, bracket or tag following it
+func parseReleaseName(name string, multipleVideoFiles bool) ReleaseName {
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(name), "."))
+	for _, videoExt := range videoExtensions {
+		if ext == videoExt {
+			name = strings.TrimSuffix(name, filepath.Ext(name))
+			break
+		}
+	}
+	name = strings.ReplaceAll(norm.NFC.String(name), "’", "'")
+	tokens := tokenizeReleaseName(name)
+
+	var release ReleaseName
+	// the title starts after bracketed prefixes like `[Kinozal.TV]`
+	start := 0
+	for start < len(tokens) && tokens[start].bracketed {
+		start++
+	}
+	if start == len(tokens) {
+		start = 0
+	}
+	if multipleVideoFiles && start+1 < len(tokens) && releaseNumberRE.MatchString(tokens[start].lower) {
+		// episode number of files like `01. Pilot`
+		start++
+	}
+	for start+1 < len(tokens) {
+		if tag, n := matchReleaseTag(tokens, start); n > 0 && tag.Kind == PrefixTag && start+n < len(tokens) {
+			start += n
+		} else {
+			break
+		}
+	}
+
+	// the title zone ends at the first marker other than a year, the last year in it follows the title;
+	// words like `English` or `Web` are markers only after a year, before it they may be a part of the title
+	titleEnd := len(tokens)
+	yearIdx := -1
+	for idx := start; idx < len(tokens); idx++ {
+		token := tokens[idx]
+		if idx > start && (token.opensBracket || token.bracketed && !tokens[start].bracketed) {
+			titleEnd = idx
+			break
+		}
+		if releaseYearRE.MatchString(token.lower) {
+			if idx > start {
+				yearIdx = idx
+			}
+			continue
+		}
+		if idx > start && (yearIdx >= 0 || !mayBeTitleWord(tokens, idx)) && release.parseToken(tokens, idx) > 0 {
+			titleEnd = idx
+			break
+		}
+	}
+	// nothing recognized is kept until the next token is parsed
+	release = ReleaseName{}
+
+	titleTokens := tokens[start:titleEnd]
+	if yearIdx >= 0 {
+		release.Year = tokens[yearIdx].text
+		titleTokens = tokens[start:yearIdx]
+	}
+	words := make([]string, 0, len(titleTokens))
+	for _, token := range titleTokens {
+		words = append(words, strings.TrimSuffix(token.text, "+"))
+	}
+	if release.Year == "" && len(words) > 0 {
+		// year glued to the title like `Movie2010`
+		if match := releaseGluedYearRE.FindStringSubmatch(words[len(words)-1]); match != nil {
+			words[len(words)-1] = match[1]
+			release.Year = match[2]
+		}
+	}
+	release.Title = strings.Join(words, " ")
+	if release.Title == "" {
+		release.Title = strings.Join(releaseTokenRE.FindAllString(name, -1), " ")
+	}
+
+	// tags anywhere after the title
+	for idx := titleEnd; idx < len(tokens); {
+		if release.Year == "" && releaseYearRE.MatchString(tokens[idx].lower) {
+			release.Year = tokens[idx].text
+			idx++
+			continue
+		}
+		idx += max(release.parseToken(tokens, idx), 1)
+	}
+	// release group of scene names like `Movie.2010.1080p.BluRay.x264-GROUP`
+	if last := len(tokens) - 1; last > titleEnd {
+		if match := releaseGroupRE.FindStringSubmatch(name); match != nil && match[1] == tokens[last].text {
+			_, tagWords := matchReleaseTag(tokens, last)
+			_, joinedWords := matchReleaseTag(tokens, last-1)
+			if tagWords == 0 && joinedWords < 2 {
+				release.Group = tokens[last].text
+			}
+		}
+	}
+	return release
+}
+
+// parseToken records what the token at idx and following ones tell, returns the number of tokens used or 0
+func (r *ReleaseName) parseToken(tokens []releaseToken, idx int) int {
+	token := tokens[idx].lower
+	next := ""
+	if idx+1 < len(tokens) {
+		next = tokens[idx+1].lower
+	}
+	if match := releaseSeasonEpisodeRE.FindStringSubmatch(token); match != nil {
+		r.addSeasons(atoi(match[1]), atoi(match[1]))
+		var episodes []int
+		for _, episode := range strings.Split(match[2], "e")[1:] {
+			episodes = append(episodes, atoi(episode))
+		}
+		if episode := releaseEpisodeRE.FindStringSubmatch(next); episode != nil {
+			// S01E01-E05
+			r.addEpisodes(episodes[0], atoi(episode[1]))
+			return 2
+		}
+		r.addEpisodes(episodes[0], episodes[len(episodes)-1])
+		return 1
+	}
+	if match := releaseSeasonRE.FindStringSubmatch(token); match != nil {
+		if season := releaseSeasonRE.FindStringSubmatch(next); season != nil {
+			// S01-S03
+			r.addSeasons(atoi(match[1]), atoi(season[1]))
+			return 2
+		}
+		r.addSeasons(atoi(match[1]), atoi(match[1]))
+		return 1
+	}
+	if match := releaseCrossEpisodeRE.FindStringSubmatch(token); match != nil {
+		r.addSeasons(atoi(match[1]), atoi(match[1]))
+		r.addEpisodes(atoi(match[2]), atoi(match[2]))
+		return 1
+	}
+	if match := releaseEpisodeRE.FindStringSubmatch(token); match != nil {
+		r.addEpisodes(atoi(match[1]), atoi(match[1]))
+		return 1
+	}
+	if match := releasePartRE.FindStringSubmatch(token); match != nil {
+		r.Part = atoi(match[1])
+		return 1
+	}
+	if releaseNumberRE.MatchString(next) {
+		switch token {
+		case "season", "сезон":
+			r.addSeasons(atoi(next), atoi(next))
+			return 2
+		case "episode", "ep", "серия":
+			r.addEpisodes(atoi(next), atoi(next))
+			return 2
+		case "part", "pt", "часть":
+			r.Part = atoi(next)
+			return 2
+		}
+	}
+	if releaseNumberRE.MatchString(token) && next == "сезон" {
+		r.addSeasons(atoi(token), atoi(token))
+		return 2
+	}
+
+	if match := releaseAudioChannelsRE.FindStringSubmatch(token); match != nil && (next == "1" || next == "0") {
+		// DD5.1, AAC2.0
+		if tag, ok := releaseTags[match[1]]; ok && tag.Kind == AudioTag {
+			r.Audio = appendUnique(r.Audio, tag.Value)
+			r.Channels = Coalesce(r.Channels, match[2]+"."+next)
+			return 2
+		}
+	}
+
+	tag, n := matchReleaseTag(tokens, idx)
+	switch tag.Kind {
+	case ResolutionTag:
+		r.Resolution = Coalesce(r.Resolution, tag.Value)
+	case SourceTag:
+		r.Source = Coalesce(r.Source, tag.Value)
+	case CodecTag:
+		r.Codec = Coalesce(r.Codec, tag.Value)
+	case HDRTag:
+		r.HDR = Coalesce(r.HDR, tag.Value)
+	case AudioTag:
+		r.Audio = appendUnique(r.Audio, tag.Value)
+	case ChannelsTag:
+		r.Channels = Coalesce(r.Channels, tag.Value)
+	case LanguageTag:
+		r.Languages = appendUnique(r.Languages, tag.Value)
+	case EditionTag:
+		// e.g. `Unrated.Extended.Cut`
+		if r.Edition == "" {
+			r.Edition = tag.Value
+		} else if !strings.Contains(r.Edition, tag.Value) {
+			r.Edition += " " + tag.Value
+		}
+	case OtherTag:
+		r.Other = appendUnique(r.Other, tag.Value)
+	case PrefixTag:
+		// only meaningful before the title
+		return 0
+	}
+	return n
+}
+
+func (r *ReleaseName) addSeasons(from int, to int) {
+	for season := from; season <= to && season-from < 100; season++ {
+		r.Seasons = appendUnique(r.Seasons, season)
+	}
+}
+
+func (r *ReleaseName) addEpisodes(from int, to int) {
+	for episode := from; episode <= to && episode-from < 1000; episode++ {
+		r.Episodes = appendUnique(r.Episodes, episode)
+	}
+}
+
+// merge fills what the release doesn't tell from the other one, e.g. an episode file from its season folder
+func (r ReleaseName) merge(other ReleaseName) ReleaseName {
+	r.Title = Coalesce(r.Title, other.Title)
+	r.Year = Coalesce(r.Year, other.Year)
+	r.Resolution = Coalesce(r.Resolution, other.Resolution)
+	r.Source = Coalesce(r.Source, other.Source)
+	r.Codec = Coalesce(r.Codec, other.Codec)
+	r.HDR = Coalesce(r.HDR, other.HDR)
+	r.Channels = Coalesce(r.Channels, other.Channels)
+	r.Edition = Coalesce(r.Edition, other.Edition)
+	r.Group = Coalesce(r.Group, other.Group)
+	if len(r.Seasons) == 0 {
+		r.Seasons = other.Seasons
+	}
+	if len(r.Audio) == 0 {
+		r.Audio = other.Audio
+	}
+	if len(r.Languages) == 0 {
+		r.Languages = other.Languages
+	}
+	if r.Part == 0 {
+		r.Part = other.Part
+	}
+	return r
+}
+
+func appendUnique[T comparable](items []T, item T) []T {
+	for _, existing := range items {
+		if existing == item {
+			return items
+		}
+	}
+	return append(items, item)
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseReleaseName(t *testing.T) {
+	tests := []struct {
+		name     string
+		multiple bool
+		expected ReleaseName
+	}{
+		{"Goodfellas.1990.720p.BluRay.11xRus.Eng-DON", false, ReleaseName{
+			Title: "Goodfellas", Year: "1990", Resolution: "720p", Source: "BluRay", Languages: []string{"rus", "eng"}, Group: "DON"}},
+		{"Зеленая миля / The Green Mile (1999) BDRip 1080p", false, ReleaseName{
+			Title: "Зеленая миля The Green Mile", Year: "1999", Resolution: "1080p", Source: "BDRip"}},
+		{"Blade.Runner.2049.2017.1080p.BluRay.x264-SPARKS.mkv", false, ReleaseName{
+			Title: "Blade Runner 2049", Year: "2017", Resolution: "1080p", Source: "BluRay", Codec: "h264", Group: "SPARKS"}},
+		{"Interstellar.2014.IMAX.2160p.UHD.BluRay.x265.HDR.TrueHD.7.1.Atmos-TERMiNAL", false, ReleaseName{
+			Title: "Interstellar", Year: "2014", Resolution: "2160p", Source: "BluRay", Codec: "hevc", HDR: "HDR10",
+			Audio: []string{"TrueHD", "Atmos"}, Channels: "7.1", Edition: "IMAX", Group: "TERMiNAL"}},
+		{"Aliens.1986.Directors.Cut.BDRip", false, ReleaseName{Title: "Aliens", Year: "1986", Source: "BDRip", Edition: "Director's Cut"}},
+		{"Limitless.2011.Unrated.Extended.Cut.BDRip", false, ReleaseName{Title: "Limitless", Year: "2011", Source: "BDRip", Edition: "Unrated Extended"}},
+		{"Odin_doma_1990_BDRip_[REMASTERED]", false, ReleaseName{Title: "Odin doma", Year: "1990", Source: "BDRip", Edition: "Remastered"}},
+		{"Бегущий по лезвию (1982) Режиссёрская версия", false, ReleaseName{Title: "Бегущий по лезвию", Year: "1982", Edition: "Director's Cut"}},
+		{"Movie.Name.Unrated.2008.HDRip", false, ReleaseName{Title: "Movie Name", Year: "2008", Source: "HDRip", Edition: "Unrated"}},
+		{"1917 (2019) WEB-DL 2160p", false, ReleaseName{Title: "1917", Year: "2019", Resolution: "2160p", Source: "WEB-DL"}},
+		{"BBC.Planet.Earth.II.2016", false, ReleaseName{Title: "Planet Earth II", Year: "2016"}},
+		{"[Kinozal.TV] Movie Name (2010)", false, ReleaseName{Title: "Movie Name", Year: "2010"}},
+		{"Movie2010", false, ReleaseName{Title: "Movie", Year: "2010"}},
+		{"Spider-Man", false, ReleaseName{Title: "Spider Man"}},
+		{"Chernobyl.S01.1080p.AMZN.WEB-DL.DDP5.1.H.264", true, ReleaseName{
+			Title: "Chernobyl", Seasons: []int{1}, Resolution: "1080p", Source: "WEB-DL", Codec: "h264", Audio: []string{"E-AC3"}, Channels: "5.1"}},
+		{"Chernobyl.S01E01-E03.1080p", true, ReleaseName{Title: "Chernobyl", Seasons: []int{1}, Episodes: []int{1, 2, 3}, Resolution: "1080p"}},
+		{"Friends.S01-S03.BDRip", false, ReleaseName{Title: "Friends", Seasons: []int{1, 2, 3}, Source: "BDRip"}},
+		{"The 100 S02", false, ReleaseName{Title: "The 100", Seasons: []int{2}}},
+		{"Друзья 1 сезон", false, ReleaseName{Title: "Друзья", Seasons: []int{1}}},
+		{"01. Pilot", true, ReleaseName{Title: "Pilot"}},
+		{"Matrix.Part.2.avi", false, ReleaseName{Title: "Matrix", Part: 2}},
+		{"The English Patient 1996", false, ReleaseName{Title: "The English Patient", Year: "1996"}},
+		{"The Italian Job (2003)", false, ReleaseName{Title: "The Italian Job", Year: "2003"}},
+		{"The French Connection 1971", false, ReleaseName{Title: "The French Connection", Year: "1971"}},
+		{"Johnny English.2003.BDRip", false, ReleaseName{Title: "Johnny English", Year: "2003", Source: "BDRip"}},
+		{"Movie.Name.2010.English.WEB.1080p", false, ReleaseName{
+			Title: "Movie Name", Year: "2010", Resolution: "1080p", Source: "WEB-DL", Languages: []string{"eng"}}},
+		{"Метод (2015) MVO", false, ReleaseName{Title: "Метод", Year: "2015", Other: []string{"MVO"}}},
+	}
+	for _, test := range tests {
+		release := parseReleaseName(test.name, test.multiple)
+		if !reflect.DeepEqual(release, test.expected) {
+			t.Errorf("%s:\nexpected %+v\n     got %+v", test.name, test.expected, release)
+		}
+	}
+}
+
+func TestConfigureReleaseTags(t *testing.T) {
+	defer configureReleaseTags(nil)
+
+	configureReleaseTags(map[string]map[string][]string{
+		"edition": {"Final Cut": {"final cut"}},
+		"source":  {"VHS": {"vhsrip"}},
+	})
+	release := parseReleaseName("Blade.Runner.1982.The.Final.Cut.VHSRip", false)
+	if release.Title != "Blade Runner" || release.Edition != "Final Cut" || release.Source != "VHS" {
+		t.Errorf("unexpected release %+v", release)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// configured API keys and passwords, redacted from all log output
+var secrets []string
+var secretsMutex sync.RWMutex
+
+// secrets passed in query parameters of URLs that weren't registered, e.g. taken from a cached URL
+var secretQueryParamRegex = regexp.MustCompile(`(?i)((?:api_key|apikey|access_token|token)=)[^&\s"']+`)
+
+const redactedSecret = "***"
+
+// registerSecret adds the value to the redacted secrets, short values are ignored to keep logs readable
+func registerSecret(secret string) {
+	if len(secret) < 6 {
+		return
+	}
+	secretsMutex.Lock()
+	defer secretsMutex.Unlock()
+	for _, existing := range secrets {
+		if existing == secret {
+			return
+		}
+	}
+	secrets = append(secrets, secret)
+}
+
+// registerConfigSecrets registers API keys and the Transmission RPC password of the config
+func registerConfigSecrets(config Config) {
+	for _, key := range []string{config.TMDbApiKey, config.OpenAiApiKey, config.KinopoiskApiKey, config.FanartTvApiKey, config.LLM.ApiKey} {
+		registerSecret(key)
+	}
+	if rpc, err := url.Parse(config.Transmission.Rpc); err == nil && rpc.User != nil {
+		if password, ok := rpc.User.Password(); ok {
+			registerSecret(password)
+		}
+	}
+}
+
+// redactSecrets replaces registered secrets and secret query parameters in the text
+func redactSecrets(text string) string {
+	secretsMutex.RLock()
+	for _, secret := range secrets {
+		text = strings.ReplaceAll(text, secret, redactedSecret)
+	}
+	secretsMutex.RUnlock()
+	return secretQueryParamRegex.ReplaceAllString(text, "${1}"+redactedSecret)
+}
+
+// redactingWriter redacts secrets from everything written to the log
+type redactingWriter struct {
+	w io.Writer
+}
+
+func newRedactingWriter(w io.Writer) io.Writer {
+	return redactingWriter{w: w}
+}
+
+func (r redactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(r.w, redactSecrets(string(p))); err != nil {
+		return 0, err
+	}
+	// report the original length, log.Logger treats shorter writes as errors
+	return len(p), nil
+}
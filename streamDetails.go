@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// StreamDetails describes the streams of a video file with Kodi codec names and ISO 639-2 languages
+type StreamDetails struct {
+	Duration  time.Duration
+	Video     []VideoStream
+	Audio     []AudioStream
+	Subtitles []SubtitleStream
+}
+
+type VideoStream struct {
+	Codec  string
+	Width  int
+	Height int
+	// `hdr10`, `hlg` or `dolbyvision`
+	HDR string
+}
+
+type AudioStream struct {
+	Codec    string
+	Channels int
+	Language string
+}
+
+type SubtitleStream struct {
+	Codec    string
+	Language string
+}
+
+func (d StreamDetails) isEmpty() bool {
+	return d.Duration == 0 && len(d.Video) == 0 && len(d.Audio) == 0 && len(d.Subtitles) == 0
+}
+
+// probeStreams reads the stream details from Matroska or MP4 headers, or the duration of a Blu-ray folder
+func probeStreams(path Path) (StreamDetails, error) {
+	if path.isDirectory() {
+		return probeDisc(path)
+	}
+	file, err := os.Open(string(path))
+	if err != nil {
+		return StreamDetails{}, err
+	}
+	defer file.Close()
+
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(file, header); err != nil {
+		return StreamDetails{}, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return StreamDetails{}, err
+	}
+	switch {
+	case binary.BigEndian.Uint32(header) == ebmlHeaderId:
+		return parseMatroska(file)
+	case string(header[4:8]) == "ftyp":
+		return parseMP4(file)
+	default:
+		return StreamDetails{}, fmt.Errorf("unsupported container of %s", path.lastPathComponent())
+	}
+}
+
+// probeStreamDetails probes the video files of an item, durations of parts are summed up;
+// what the release name tells is used for other containers
+func probeStreamDetails(videoFiles []Path, release ReleaseName) StreamDetails {
+	var details StreamDetails
+	for idx, videoFile := range videoFiles {
+		probed, err := probeStreams(videoFile)
+		if err != nil {
+			if ext := videoFile.extension(); ext == "mkv" || ext == "mp4" || ext == "m4v" || ext == "mov" {
+				Log("⚠️ could not read streams of", videoFile, err)
+			}
+			return streamDetailsFromRelease(release)
+		}
+		if idx == 0 {
+			details = probed
+		} else {
+			details.Duration += probed.Duration
+		}
+	}
+	if details.isEmpty() {
+		return streamDetailsFromRelease(release)
+	} else if len(details.Video) == 0 && len(details.Audio) == 0 {
+		// discs tell the duration only
+		fromRelease := streamDetailsFromRelease(release)
+		fromRelease.Duration = details.Duration
+		return fromRelease
+	}
+	return details
+}
+
+// Kodi names of release name tags
+var (
+	kodiResolutions = map[string][2]int{"2160p": {3840, 2160}, "1080p": {1920, 1080}, "720p": {1280, 720}, "576p": {720, 576}, "480p": {720, 480}}
+	kodiVideoCodecs = map[string]string{"mpeg2": "mpeg2video"}
+	kodiHDRTypes    = map[string]string{"HDR10": "hdr10", "HDR10+": "hdr10", "Dolby Vision": "dolbyvision"}
+	kodiAudioCodecs = map[string]string{"AAC": "aac", "AC3": "ac3", "E-AC3": "eac3", "DTS": "dca", "DTS-HD MA": "dtshd_ma", "TrueHD": "truehd", "FLAC": "flac", "MP3": "mp3"}
+	kodiChannels    = map[string]int{"7.1": 8, "5.1": 6, "2.0": 2}
+)
+
+// streamDetailsFromRelease guesses the streams from release name tags
+func streamDetailsFromRelease(release ReleaseName) StreamDetails {
+	var details StreamDetails
+	resolution, hasResolution := kodiResolutions[release.Resolution]
+	if hasResolution || release.Codec != "" || kodiHDRTypes[release.HDR] != "" {
+		details.Video = []VideoStream{{
+			Codec:  Coalesce(kodiVideoCodecs[release.Codec], release.Codec),
+			Width:  resolution[0],
+			Height: resolution[1],
+			HDR:    kodiHDRTypes[release.HDR],
+		}}
+	}
+
+	audioCodec := ""
+	for _, audio := range release.Audio {
+		if codec, ok := kodiAudioCodecs[audio]; ok {
+			audioCodec = codec
+			break
+		}
+	}
+	if audioCodec == "" && release.Channels == "" && len(release.Languages) == 0 {
+		return details
+	}
+	// a stream per language, the codec is known for the first one only
+	languages := release.Languages
+	if len(languages) == 0 {
+		languages = []string{""}
+	}
+	for idx, language := range languages {
+		stream := AudioStream{Language: language}
+		if idx == 0 {
+			stream.Codec = audioCodec
+			stream.Channels = kodiChannels[release.Channels]
+		}
+		details.Audio = append(details.Audio, stream)
+	}
+	return details
+}
+
+// languages of undetermined tracks aren't written
+func streamLanguage(language string) string {
+	if language == "und" {
+		return ""
+	}
+	return language
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"math"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func ebmlElement(id uint64, body ...[]byte) []byte {
+	var element []byte
+	for shift := 24; shift >= 0; shift -= 8 {
+		if b := byte(id >> shift); b != 0 || len(element) > 0 {
+			element = append(element, b)
+		}
+	}
+	data := bytes.Join(body, nil)
+	size := make([]byte, 8)
+	binary.BigEndian.PutUint64(size, uint64(len(data)))
+	size[0] = 0x01
+	return append(append(element, size...), data...)
+}
+
+func ebmlUintBody(value uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, value)
+}
+
+func mp4Box(boxType string, body ...[]byte) []byte {
+	data := bytes.Join(body, nil)
+	box := binary.BigEndian.AppendUint32(nil, uint32(len(data)+8))
+	return append(append(box, boxType...), data...)
+}
+
+func mp4Track(handler string, language string, sampleEntry []byte) []byte {
+	packed := uint16(language[0]-0x60)<<10 | uint16(language[1]-0x60)<<5 | uint16(language[2]-0x60)
+	mdhd := append(make([]byte, 20), binary.BigEndian.AppendUint16(nil, packed)...)
+	hdlr := append(append(make([]byte, 8), handler...), make([]byte, 13)...)
+	stsd := append(make([]byte, 8), sampleEntry...)
+	return mp4Box("trak", mp4Box("mdia", mp4Box("mdhd", mdhd, make([]byte, 2)), mp4Box("hdlr", hdlr), mp4Box("minf", mp4Box("stbl", mp4Box("stsd", stsd)))))
+}
+
+func TestProbeMatroska(t *testing.T) {
+	file := bytes.Join([][]byte{
+		ebmlElement(ebmlHeaderId, ebmlElement(0x4282, []byte("matroska"))),
+		ebmlElement(mkvSegmentId,
+			ebmlElement(mkvInfoId,
+				ebmlElement(mkvTimecodeScaleId, ebmlUintBody(1000000)),
+				ebmlElement(mkvDurationId, binary.BigEndian.AppendUint64(nil, math.Float64bits(5400000)))),
+			// void elements are skipped
+			ebmlElement(0xEC, make([]byte, 100)),
+			ebmlElement(mkvTracksId,
+				ebmlElement(mkvTrackEntryId,
+					ebmlElement(mkvTrackTypeId, ebmlUintBody(mkvVideoTrack)),
+					ebmlElement(mkvCodecId, []byte("V_MPEGH/ISO/HEVC")),
+					ebmlElement(mkvVideoId,
+						ebmlElement(mkvPixelWidthId, ebmlUintBody(3840)),
+						ebmlElement(mkvPixelHeightId, ebmlUintBody(2160)),
+						ebmlElement(mkvColourId, ebmlElement(mkvTransferCharacteristicsId, ebmlUintBody(16))))),
+				ebmlElement(mkvTrackEntryId,
+					ebmlElement(mkvTrackTypeId, ebmlUintBody(mkvAudioTrack)),
+					ebmlElement(mkvCodecId, []byte("A_AC3")),
+					ebmlElement(mkvLanguageId, []byte("rus")),
+					ebmlElement(mkvAudioId, ebmlElement(mkvChannelsId, ebmlUintBody(6)))),
+				ebmlElement(mkvTrackEntryId,
+					ebmlElement(mkvTrackTypeId, ebmlUintBody(mkvAudioTrack)),
+					ebmlElement(mkvCodecId, []byte("A_AAC/MPEG4/LC")),
+					ebmlElement(mkvLanguageIETFId, []byte("en-US")),
+					ebmlElement(mkvAudioId, ebmlElement(mkvChannelsId, ebmlUintBody(2)))),
+				ebmlElement(mkvTrackEntryId,
+					ebmlElement(mkvTrackTypeId, ebmlUintBody(mkvSubtitleTrack)),
+					ebmlElement(mkvCodecId, []byte("S_TEXT/UTF8")),
+					ebmlElement(mkvLanguageId, []byte("rus")))),
+			ebmlElement(0x1F43B675, make([]byte, 1000))),
+	}, nil)
+	path := Path(t.TempDir()).appendingPathComponent("movie.mkv")
+	if err := os.WriteFile(string(path), file, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	details, err := probeStreams(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := StreamDetails{
+		Duration:  90 * time.Minute,
+		Video:     []VideoStream{{Codec: "hevc", Width: 3840, Height: 2160, HDR: "hdr10"}},
+		Audio:     []AudioStream{{Codec: "ac3", Channels: 6, Language: "rus"}, {Codec: "aac", Channels: 2, Language: "eng"}},
+		Subtitles: []SubtitleStream{{Codec: "srt", Language: "rus"}},
+	}
+	if !reflect.DeepEqual(details, expected) {
+		t.Errorf("expected %+v, got %+v", expected, details)
+	}
+}
+
+func TestProbeMP4(t *testing.T) {
+	visual := make([]byte, 78)
+	binary.BigEndian.PutUint16(visual[24:], 1920)
+	binary.BigEndian.PutUint16(visual[26:], 1080)
+	colr := mp4Box("colr", []byte("nclx"), []byte{0, 9, 0, 18, 0, 9, 0})
+	sound := make([]byte, 28)
+	binary.BigEndian.PutUint16(sound[16:], 6)
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[12:], 1000)
+	binary.BigEndian.PutUint32(mvhd[16:], 5400000)
+
+	file := bytes.Join([][]byte{
+		mp4Box("ftyp", []byte("isom"), make([]byte, 4), []byte("isomavc1")),
+		// media data before the movie box is skipped
+		mp4Box("mdat", make([]byte, 1000)),
+		mp4Box("moov",
+			mp4Box("mvhd", mvhd),
+			mp4Track("vide", "und", mp4Box("hvc1", visual, colr)),
+			mp4Track("soun", "rus", mp4Box("ec-3", sound)),
+			mp4Track("sbtl", "eng", mp4Box("tx3g", make([]byte, 8)))),
+	}, nil)
+	path := Path(t.TempDir()).appendingPathComponent("movie.mp4")
+	if err := os.WriteFile(string(path), file, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	details, err := probeStreams(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := StreamDetails{
+		Duration:  90 * time.Minute,
+		Video:     []VideoStream{{Codec: "hevc", Width: 1920, Height: 1080, HDR: "hlg"}},
+		Audio:     []AudioStream{{Codec: "eac3", Channels: 6, Language: "rus"}},
+		Subtitles: []SubtitleStream{{Codec: "mov_text", Language: "eng"}},
+	}
+	if !reflect.DeepEqual(details, expected) {
+		t.Errorf("expected %+v, got %+v", expected, details)
+	}
+}
+
+func TestWriteStreamDetailsXML(t *testing.T) {
+	// streams of other containers are guessed from the release name
+	path := Path(t.TempDir()).appendingPathComponent("Movie.2010.1080p.x265.DTS.5.1.Rus.Eng.avi")
+	if err := os.WriteFile(string(path), []byte("RIFF....AVI LIST"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	streams := probeStreamDetails([]Path{path}, parseReleaseName(path.lastPathComponent(), false))
+
+	var buffer bytes.Buffer
+	enc := xml.NewEncoder(&buffer)
+	writeStreamDetailsXML(enc, streams)
+	enc.Flush()
+	expected := "<fileinfo><streamdetails>" +
+		"<video><codec>hevc</codec><aspect>1.78</aspect><width>1920</width><height>1080</height></video>" +
+		"<audio><codec>dca</codec><language>rus</language><channels>6</channels></audio>" +
+		"<audio><language>eng</language></audio>" +
+		"</streamdetails></fileinfo>"
+	if buffer.String() != expected {
+		t.Errorf("unexpected stream details %s", buffer.String())
+	}
+
+	buffer.Reset()
+	writeStreamDetailsXML(enc, streamDetailsFromRelease(parseReleaseName("Movie (2010)", false)))
+	enc.Flush()
+	if buffer.Len() != 0 {
+		t.Errorf("expected no stream details, got %s", buffer.String())
+	}
+}
@@ -3,7 +3,6 @@ package main
 import (
 	"fmt"
 	"net/url"
-	"path/filepath"
 	"regexp"
 	"strings"
 	"unicode"
@@ -171,104 +170,13 @@ func computeSimilarityScore(title1, title2 string, useJaroWinkler bool) int {
 }
 
 func cleanupMovieFileName(fileName string, multipleVideoFiles bool) (string, string) {
-	// Regular expression to match the release year in the file name
-	yearRegex := regexp.MustCompile(`\b((?:19\d\d|20\d\d))\b`)
-
-	// Find the release year in the file name
-	yearMatches := yearRegex.FindStringSubmatch(fileName)
-	var year string
-	if len(yearMatches) > 0 {
-		year = yearMatches[0]
-	}
-
-	// Extract the movie name by removing everything after the release year
-	movieName := ""
-	if len(yearMatches) > 0 {
-		yearIndex := yearRegex.FindStringIndex(fileName)[0]
-		movieName = fileName[:yearIndex]
-	} else {
-		movieName = fileName
-	}
-	// Log("1", movieName) // TODO: make debug levels: verbose, debug, info..
-
-	seasonFolderRE := regexp.MustCompile(`(?:[Ss](?:eason)?)\s*(\d{1,2})\b`)
-	seasonMatches := seasonFolderRE.FindStringSubmatch(movieName)
-	if len(seasonMatches) > 0 {
-		seasonIndex := seasonFolderRE.FindStringIndex(movieName)[0]
-		movieName = movieName[:seasonIndex]
-	}
-
-	if multipleVideoFiles {
-		leadingNumberRE := regexp.MustCompile(`^(\d{1,3})(?:[\. _]|$)`)
-		trimmed := leadingNumberRE.ReplaceAllString(movieName, "")
-		if trimmed != "" {
-			movieName = trimmed
-		}
-	}
-
-	episodeRE := regexp.MustCompile(`(?i)e(?:p(?:isode)?)?\s*(\d{1,3})`)
-	if match := episodeRE.FindStringSubmatch(movieName); len(match) == 2 {
-		epIndex := episodeRE.FindStringIndex(movieName)[0]
-		trimmed := movieName[:epIndex]
-		if trimmed != "" {
-			movieName = trimmed
-		}
-	}
-
-	// Log("2", movieName)
-	if movieName == "" {
-		movieName = strings.TrimSuffix(fileName, filepath.Ext(fileName))
-	}
-	// Log("3", movieName)
-	mediaInfoRE := regexp.MustCompile(`(?i)[^a-z0-9]([a-z]+rip|ts|avc|hdr|sdr|uhd|dvd|mvo|matroska|web|dub|Сериал)(?:[^a-z0-9]|$)`)
-	mediaInfoMatches := mediaInfoRE.FindStringSubmatch(movieName)
-	if len(mediaInfoMatches) > 0 {
-		mediaInfoIndex := mediaInfoRE.FindStringIndex(movieName)[0]
-		movieName = movieName[:mediaInfoIndex]
-	}
-	// Log("4", movieName)
-	if movieName == "" {
-		movieName = strings.TrimSuffix(fileName, filepath.Ext(fileName))
-	}
-	// Log("5", movieName)
-
-	// Regular expression to match parentheses and extract text before it
-	parenRegex := regexp.MustCompile(`^([^(\[\{]*?)\s*[(\[{].+`)
-	parenMatches := parenRegex.FindStringSubmatch(movieName)
-	if len(parenMatches) > 1 {
-		// Extract the movie name from the part before the parentheses
-		// Logf("extracting movie name before paren: %s\n", parenMatches[1])
-		movieName = parenMatches[1]
-	}
-	// Log("6", movieName)
-
-	if strings.HasPrefix(strings.ToLower(movieName), "bbc") && len(movieName) > 4 {
-		movieName = movieName[3:]
-	}
-	// Log("8", movieName)
-
-	// try extracting year from the movie name (again)
-	if year == "" {
-		yearRegex = regexp.MustCompile(`^.*[^\d]((?:19\d\d|20\d\d))$`)
-		// Find the release year in the file name
-		yearMatches = yearRegex.FindStringSubmatch(movieName)
-		if len(yearMatches) > 1 {
-			year = yearMatches[1]
-			movieName = strings.TrimSuffix(movieName, year)
-		}
-	}
-	// Log("8", movieName)
-
-	movieName = norm.NFC.String(movieName)
-	nonAlphaNumRegex := regexp.MustCompile(`[^'\p{L}\p{N}]+`)
-	cleanedMovieName := strings.Trim(nonAlphaNumRegex.ReplaceAllString(movieName, " "), " ")
-
+	release := parseReleaseName(fileName, multipleVideoFiles)
 	y := ""
-	if year != "" {
-		y = "(" + year + ")"
+	if release.Year != "" {
+		y = "(" + release.Year + ")"
 	}
-	Log("initial:", movieName, "clean:", cleanedMovieName, y)
-	return cleanedMovieName, year
+	Log("initial:", fileName, "clean:", release.Title, y)
+	return release.Title, release.Year
 }
 
 func commonPrefix(str1, str2 string) string {
@@ -354,3 +262,22 @@ func FindCommonItems(arr1 []string, arr2 []string, caseSensitive bool) int {
 	}
 	return result
 }
+
+// sanitizeFileName makes a metadata string usable as a file name on all common filesystems
+func sanitizeFileName(name string) string {
+	replacer := strings.NewReplacer(
+		":", " -",
+		"/", "-",
+		"\\", "-",
+		"|", "-",
+		"\"", "'",
+		"?", "",
+		"*", "",
+		"<", "",
+		">", "",
+	)
+	name = replacer.Replace(norm.NFC.String(name))
+	name = strings.Join(strings.Fields(name), " ")
+	// Windows doesn't allow trailing dots and spaces
+	return strings.TrimRight(name, ". ")
+}
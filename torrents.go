@@ -6,30 +6,30 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
-	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"sync"
 
 	"github.com/hekmon/transmissionrpc/v3"
 	"github.com/kazhuravlev/go-rutracker/parser"
 )
 
-func getTorrentsByPath(transmissionURL string) (map[string]transmissionrpc.Torrent, error) {
+func getTorrentsByPath(ctx context.Context, transmissionURL string) (map[string]transmissionrpc.Torrent, error) {
 	endpoint, err := url.Parse(transmissionURL)
 	if err != nil {
 		panic(err)
 	}
 
 	// Initialize Transmission RPC client
-	client, err := transmissionrpc.New(endpoint, nil)
+	client, err := transmissionrpc.New(endpoint, &transmissionrpc.Config{CustomClient: httpClient.client, UserAgent: httpClient.userAgent})
 	if err != nil {
 		return nil, err
 	}
 
 	// Fetch all torrents
-	// torrents, err := client.TorrentGetAll(context.Background())
-	torrents, err := client.TorrentGet(context.Background(), []string{"id", "downloadDir", "name", "comment"}, nil)
+	// torrents, err := client.TorrentGetAll(ctx)
+	torrents, err := client.TorrentGet(ctx, []string{"id", "downloadDir", "name", "comment"}, nil)
 
 	if err != nil {
 		return nil, err
@@ -48,63 +48,85 @@ func getTorrentsByPath(transmissionURL string) (map[string]transmissionrpc.Torre
 	return torrentMap, nil
 }
 
-func moveTorrent(id int64, newLocation Path, transmissionURL string) error {
+// TorrentIndex finds torrents by their root paths, the list is loaded once on first use
+// and is safe for concurrent use
+type TorrentIndex struct {
+	rpc    string
+	once   sync.Once
+	byPath map[string]transmissionrpc.Torrent
+}
+
+func newTorrentIndex(transmissionURL string) *TorrentIndex {
+	return &TorrentIndex{rpc: transmissionURL}
+}
+
+// find the torrent by the lowercased path of its root item
+func (index *TorrentIndex) find(ctx context.Context, path Path) (transmissionrpc.Torrent, bool) {
+	if index == nil {
+		return transmissionrpc.Torrent{}, false
+	}
+	index.once.Do(func() {
+		if index.rpc == "" {
+			return
+		}
+		torrents, err := getTorrentsByPath(ctx, index.rpc)
+		if err != nil {
+			Log("❌ could not load torrent list", err)
+			return
+		}
+		Log("loaded", len(torrents), "torrents")
+		index.byPath = torrents
+	})
+	torrent, ok := index.byPath[strings.ToLower(string(path))]
+	return torrent, ok
+}
+
+func moveTorrent(ctx context.Context, id int64, newLocation Path, transmissionURL string) error {
 	endpoint, err := url.Parse(transmissionURL)
 	if err != nil {
 		panic(err)
 	}
 
 	// Initialize Transmission RPC client
-	client, err := transmissionrpc.New(endpoint, nil)
+	client, err := transmissionrpc.New(endpoint, &transmissionrpc.Config{CustomClient: httpClient.client, UserAgent: httpClient.userAgent})
 	if err != nil {
 		return err
 	}
 
-	return client.TorrentSetLocation(context.Background(), id, string(newLocation), true)
+	return client.TorrentSetLocation(ctx, id, string(newLocation), true)
 }
 
-func loadTitleYearIMDbIdFromRutracker(url string) (string, string, string, error) {
+func loadTitleYearIMDbIdFromRutracker(ctx context.Context, url string) (string, string, string, error) {
 	_, err := parseTopicID(url)
 	if err != nil {
 		return "", "", "", err
 	}
 
-	// Generate a cache key for this URL
-	cacheKey := ReplaceInvalidFilenameChars(url) + "_rutracker.json"
-	cacheFilename := filepath.Join(CacheDir, cacheKey)
-
-	// Check if the cached data exists
-	if _, err := os.Stat(cacheFilename); err == nil {
-		// If cached data exists, read and return it
+	// the parsed topic is cached, not the page
+	key := "rutracker:" + url
+	if cached, ok := loadCachedResponse("rutracker", key); ok {
 		Log("🔄 Using cached Rutracker data for URL:", url)
-		data, err := os.ReadFile(cacheFilename)
-		if err != nil {
-			return "", "", "", err
-		}
-
 		var cachedResponse struct {
 			Title  string `json:"title"`
 			Year   string `json:"year"`
 			IMDbID string `json:"imdb_id"`
 		}
-		if err := json.Unmarshal(data, &cachedResponse); err != nil {
+		if err := json.Unmarshal(cached.Body, &cachedResponse); err != nil {
 			return "", "", "", err
 		}
 
 		return cachedResponse.Title, cachedResponse.Year, cachedResponse.IMDbID, nil
 	}
 
-	// Cache miss - making a real API call
-	if os.Getenv("TEST_MODE") == "true" {
-		Log("💥💥💥 TEST MODE: Making real Rutracker request (cache miss) for:", url)
-	}
-
 	// Fetch HTML content
-	resp, err := http.Get(url)
+	resp, err := httpClient.do(ctx, http.MethodGet, url, nil, nil)
 	if err != nil {
 		return "", "", "", err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", "", "", &HTTPStatusError{Url: url, StatusCode: resp.StatusCode}
+	}
 
 	p, _ := parser.NewParser()
 
@@ -139,10 +161,8 @@ func loadTitleYearIMDbIdFromRutracker(url string) (string, string, string, error
 	data, err := json.Marshal(cachedResponse)
 	if err != nil {
 		Log("Error marshaling Rutracker response for cache:", err)
-	} else {
-		if err := os.WriteFile(cacheFilename, data, 0644); err != nil {
-			Log("Error writing Rutracker cache file:", err)
-		}
+	} else if err := storeCachedResponse(CachedResponse{Key: key, Provider: "rutracker", Status: http.StatusOK, Body: data}); err != nil {
+		Log("Error writing Rutracker cache file:", err)
 	}
 
 	return title, year, topic.IMDbID, nil
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// forEachConcurrently calls process for indices 0..<count using up to `workers` goroutines;
+// no new items are started after the first error, which is returned, or once the context is cancelled
+func forEachConcurrently(ctx context.Context, count int, workers int, process func(int) error) error {
+	if workers < 1 {
+		workers = 1
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+	failed := make(chan struct{})
+
+	for w := 0; w < workers && w < count; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if err := process(i); err != nil {
+					once.Do(func() {
+						firstErr = err
+						close(failed)
+					})
+				}
+			}
+		}()
+	}
+
+Dispatch:
+	for i := 0; i < count; i++ {
+		select {
+		case jobs <- i:
+		case <-failed:
+			break Dispatch
+		case <-ctx.Done():
+			break Dispatch
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	if firstErr == nil {
+		return ctx.Err()
+	}
+	return firstErr
+}
+
+// PathLocks serializes work on the same output item (e.g. two season folders of one TV Show)
+type PathLocks struct {
+	mutex sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+var outputItemLocks = &PathLocks{locks: make(map[string]*sync.Mutex)}
+
+// lock the lowercased path, the returned function unlocks it
+func (l *PathLocks) lock(path Path) func() {
+	key := strings.ToLower(string(path))
+	l.mutex.Lock()
+	lock, ok := l.locks[key]
+	if !ok {
+		lock = &sync.Mutex{}
+		l.locks[key] = lock
+	}
+	l.mutex.Unlock()
+
+	lock.Lock()
+	return lock.Unlock
+}